@@ -1,31 +1,52 @@
 package commands
 
 import (
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/btfs"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/cgroups"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/links"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/maps"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/netdevs"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/progs"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/stats"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/tasks"
+	"github.com/ebpfdev/dev-agent/pkg/k8s"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
+	"strconv"
+	"time"
 )
 
 func App() *cli.App {
 	logger := log.Logger.Level(zerolog.InfoLevel)
 	progsRepo := progs.NewWatcher(logger)
-	tasksRepo := tasks.NewTaskWatcher()
+	tasksRepo := tasks.NewTaskWatcher(logger)
+	statsRepo := stats.NewController(logger)
+	linksRepo := links.NewWatcher(logger)
 	progsCommands := &ProgsCommands{
 		ProgsRepo: progsRepo,
 	}
+	linksCommands := &LinksCommands{
+		LinksRepo: linksRepo,
+	}
 	mapsCommands := func(bpfDir string) *MapsCommands {
 		return &MapsCommands{
 			MapsRepo: maps.NewWatcher(logger, bpfDir),
 		}
 	}
-	serverCommands := func(bpfDir string) *ServerCommands {
+	serverCommands := func(bpfDir string, cgroupDir string, k8sRoot string) *ServerCommands {
 		return &ServerCommands{
-			ProgsRepo: progsRepo,
-			MapsRepo:  maps.NewWatcher(logger, bpfDir),
-			TasksRepo: tasksRepo,
+			ProgsRepo:   progsRepo,
+			MapsRepo:    maps.NewWatcher(logger, bpfDir),
+			TasksRepo:   tasksRepo,
+			StatsRepo:   statsRepo,
+			LinksRepo:   linksRepo,
+			NetdevsRepo: netdevs.NewWatcher(logger),
+			CgroupsRepo: cgroups.NewWatcher(logger, cgroupDir),
+			PodsRepo:    k8s.NewResolver(logger, k8sRoot, tasksRepo),
+			BtfRepo:     btfs.NewWatcher(logger),
 		}
 	}
 
@@ -50,6 +71,47 @@ func App() *cli.App {
 						Value:    "/sys/fs/bpf",
 						EnvVars:  []string{"BPF_DIR"},
 					},
+					&cli.StringFlag{
+						Name:     "cgroup_dir",
+						Category: "eBPF",
+						Usage:    "path to the cgroup v2 filesystem, its 'unified' subdirectory is used on hybrid hierarchy hosts",
+						Value:    "/sys/fs/cgroup",
+						EnvVars:  []string{"CGROUP_DIR"},
+					},
+					&cli.StringFlag{
+						Name:     "k8s-root",
+						Category: "Kubernetes",
+						Usage: "root of the host filesystem to read kubelet pod logs and container runtime bundles from,\n\t" +
+							"e.g. /host if it's mounted to the agent container",
+						Value:   "/",
+						EnvVars: []string{"K8S_ROOT"},
+					},
+					&cli.BoolFlag{
+						Name:     "k8s-pod-metrics",
+						Category: "Kubernetes",
+						Usage:    "export prog_pod_info and map_pod_info metrics with pods of processes holding programs and maps",
+						EnvVars:  []string{"K8S_POD_METRICS"},
+					},
+					&cli.DurationFlag{
+						Name:     "tasks-refresh-interval",
+						Category: "eBPF",
+						Usage: "how often file descriptors of processes are scanned for perf events and BPF objects,\n\t" +
+							"only processes with changed descriptors or holding BPF objects are examined again",
+						Value:   time.Second,
+						EnvVars: []string{"TASKS_REFRESH_INTERVAL"},
+					},
+					&cli.BoolFlag{
+						Name:     "enable-stats",
+						Category: "eBPF",
+						Usage: "enable collection of programs run statistics (BPF_ENABLE_STATS) while the agent is running,\n\t" +
+							"an alternative to 'sysctl -w kernel.bpf_stats_enabled=1'",
+						EnvVars: []string{"ENABLE_STATS"},
+					},
+					&cli.DurationFlag{
+						Name:     "enable-stats-duration",
+						Category: "eBPF",
+						Usage:    "if set along with --enable-stats, statistics are turned off after this period (e.g. 10m)",
+					},
 					&cli.StringFlag{
 						Name:     "path-prefix",
 						Category: "Web server",
@@ -61,6 +123,19 @@ func App() *cli.App {
 						Category: "Web server",
 						Usage:    "skip welcome message",
 					},
+					&cli.StringSliceFlag{
+						Name:     "dangerous-helpers",
+						Category: "Security",
+						Usage:    "helpers reported in the security summary, if a program calls them",
+						Value:    cli.NewStringSlice(progs.DefaultDangerousHelpers...),
+					},
+					&cli.StringFlag{
+						Name:     "confirmation-token",
+						Category: "Security",
+						Usage: "token to pass as 'confirm' argument of mutations that detach links or (un)pin objects,\n\t" +
+							"only dry-run of such mutations is allowed if not set",
+						EnvVars: []string{"CONFIRMATION_TOKEN"},
+					},
 					&cli.MultiStringFlag{
 						Target: &cli.StringSliceFlag{
 							Name:     "entries-to-metrics",
@@ -74,9 +149,28 @@ func App() *cli.App {
 							Aliases: []string{"etm"},
 						},
 					},
+					&cli.StringFlag{
+						Name:     "map-journal",
+						Category: "eBPF",
+						Usage: "file to keep the journal of map writes made by the agent in (mapMutationHistory, undoMapMutation),\n\t" +
+							"so they can be undone after a restart; the journal is kept in memory only if it's not set",
+						EnvVars: []string{"MAP_JOURNAL"},
+					},
+					&cli.MultiStringFlag{
+						Target: &cli.StringSliceFlag{
+							Name:     "map-capacity",
+							Category: "Metrics",
+							Usage: "Configure which maps should be counted to track how full they are (map_fill_ratio metric, Map.capacity), " +
+								"in the format: id_start-id_end:name_regexp:interval.\n\t" +
+								"Example: '-:.*:1m' to count all hash-like maps every minute, or '-:^conn_:10s' for maps with names starting with conn_.\n\t" +
+								"Only keys are iterated, but it's still a syscall per entry, so large maps should be counted less often.\n\t" +
+								"If a map matches multiple entries, the first one is used, interval 0 disables counting.",
+							Aliases: []string{"mc"},
+						},
+					},
 				},
 				Action: func(c *cli.Context) error {
-					commands := serverCommands(c.String("bpf_dir"))
+					commands := serverCommands(c.String("bpf_dir"), c.String("cgroup_dir"), c.String("k8s-root"))
 
 					for _, etm := range c.StringSlice("entries-to-metrics") {
 						etmConfig, err := maps.ParseMapExportConfiguration(etm)
@@ -85,10 +179,28 @@ func App() *cli.App {
 						}
 						commands.MapsRepo.AddExportConfig(etmConfig)
 					}
+					for _, mc := range c.StringSlice("map-capacity") {
+						mcConfig, err := maps.ParseMapCapacityConfiguration(mc)
+						if err != nil {
+							return err
+						}
+						commands.MapsRepo.AddCapacityConfig(mcConfig)
+					}
+					if journal := c.String("map-journal"); journal != "" {
+						if err := commands.MapsRepo.PersistJournal(journal); err != nil {
+							return err
+						}
+					}
 
 					return commands.ServerStart(&ServerStartOptions{
-						PathPrefix:  c.String("path-prefix"),
-						SkipWelcome: c.Bool("skip-welcome"),
+						PathPrefix:           c.String("path-prefix"),
+						SkipWelcome:          c.Bool("skip-welcome"),
+						EnableStats:          c.Bool("enable-stats"),
+						EnableStatsDuration:  c.Duration("enable-stats-duration"),
+						DangerousHelpers:     c.StringSlice("dangerous-helpers"),
+						ConfirmationToken:    c.String("confirmation-token"),
+						PodMetrics:           c.Bool("k8s-pod-metrics"),
+						TasksRefreshInterval: c.Duration("tasks-refresh-interval"),
 					})
 				},
 			},
@@ -104,6 +216,31 @@ func App() *cli.App {
 									return progsCommands.ProgsList()
 								},
 							},
+							{
+								Name:      "dump",
+								Usage:     "print xlated (or JIT'ed) instructions of a program",
+								ArgsUsage: "<id>",
+								Flags: []cli.Flag{
+									&cli.BoolFlag{
+										Name:  "jited",
+										Usage: "print native code instead of xlated instructions (x86-64 only)",
+									},
+									&cli.BoolFlag{
+										Name:  "raw",
+										Usage: "along with --jited, write raw JIT'ed image to stdout",
+									},
+								},
+								Action: func(c *cli.Context) error {
+									id, err := strconv.Atoi(c.Args().First())
+									if err != nil {
+										return fmt.Errorf("program ID is required: %w", err)
+									}
+									if c.Bool("jited") {
+										return progsCommands.ProgsDumpJited(ebpf.ProgramID(id), c.Bool("raw"))
+									}
+									return progsCommands.ProgsDump(ebpf.ProgramID(id))
+								},
+							},
 						},
 					},
 					{
@@ -123,6 +260,43 @@ func App() *cli.App {
 									return mapsCommands(c.String("bpf_dir")).MapsList()
 								},
 							},
+							{
+								Name:      "create",
+								Usage:     "create a map pinned at a path relative to bpf_dir",
+								ArgsUsage: "<path>",
+								Flags: append(mapSpecFlags("", true), append(mapSpecFlags("inner-", false),
+									&cli.BoolFlag{
+										Name:  "dry-run",
+										Usage: "only validate the spec against kernel feature probes",
+									},
+								)...),
+								Action: func(c *cli.Context) error {
+									if c.Args().First() == "" {
+										return fmt.Errorf("pin path is required")
+									}
+									spec, err := mapSpecFromFlags(c, "")
+									if err != nil {
+										return err
+									}
+									if c.IsSet("inner-type") {
+										if spec.InnerMap, err = mapSpecFromFlags(c, "inner-"); err != nil {
+											return fmt.Errorf("inner map: %w", err)
+										}
+									}
+									return mapsCommands(c.String("bpf_dir")).MapsCreate(spec, c.Args().First(), c.Bool("dry-run"))
+								},
+							},
+						},
+					},
+					{
+						Name: "links",
+						Subcommands: []*cli.Command{
+							{
+								Name: "list",
+								Action: func(c *cli.Context) error {
+									return linksCommands.LinksList()
+								},
+							},
 						},
 					},
 				},
@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/links"
+)
+
+type LinksCommands struct {
+	LinksRepo links.LinkWatcher
+}
+
+func (lc *LinksCommands) LinksList() error {
+	linksList, err := lc.LinksRepo.GetLinks()
+	if err != nil {
+		return err
+	}
+	fmt.Println("ID\tType\tProgramID\tAttachType\tTarget")
+	for _, link := range linksList {
+		if link.Error != nil {
+			fmt.Printf("%d\t%v\n", link.ID, link.Error)
+			continue
+		}
+		attachType := ""
+		if link.HasAttachType() {
+			attachType = links.AttachTypeName(link.AttachType)
+		}
+		fmt.Printf(
+			"%d\t%s\t%d\t%s\t%s\n",
+			link.ID,
+			link.Type,
+			link.ProgramID,
+			attachType,
+			link.Target(),
+		)
+	}
+	return nil
+}
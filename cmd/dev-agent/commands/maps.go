@@ -3,6 +3,8 @@ package commands
 import (
 	"fmt"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/maps"
+	"github.com/urfave/cli/v2"
+	"strings"
 )
 
 type MapsCommands struct {
@@ -14,18 +16,19 @@ func (mc *MapsCommands) MapsList() error {
 	if err != nil {
 		return err
 	}
-	fmt.Println("ID\tName\tType\tFlags\tIsPinned\tKeySize\tValueSize\tMaxEntries")
+	fmt.Println("ID\tName\tType\tFlags\tFrozen\tIsPinned\tKeySize\tValueSize\tMaxEntries")
 	for _, emap := range maps {
 		if emap.Error != nil {
 			fmt.Printf("%d\t%v\n", emap.ID, emap.Error)
 			continue
 		}
 		fmt.Printf(
-			"%d\t%s\t%s\t%d\t%v\t%d\t%d\t%d\n",
+			"%d\t%s\t%s\t%s\t%v\t%v\t%d\t%d\t%d\n",
 			emap.ID,
 			emap.Name,
 			emap.Type,
-			emap.Flags,
+			formatMapFlags(emap.Flags),
+			emap.Frozen,
 			len(emap.Pins) > 0,
 			emap.KeySize,
 			emap.ValueSize,
@@ -34,3 +37,96 @@ func (mc *MapsCommands) MapsList() error {
 	}
 	return nil
 }
+
+func formatMapFlags(flags uint32) string {
+	names := maps.FlagNames(flags)
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
+
+func (mc *MapsCommands) MapsCreate(spec *maps.CreateSpec, path string, dryRun bool) error {
+	if dryRun {
+		pinPath, err := mc.MapsRepo.ValidateCreateSpec(spec, path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("spec is valid, the map would be pinned at %s\n", pinPath)
+		return nil
+	}
+	id, err := mc.MapsRepo.CreateMap(spec, path)
+	if err != nil {
+		return err
+	}
+	emap, err := mc.MapsRepo.GetMap(id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created map %d pinned at %s\n", id, strings.Join(emap.Pins, ", "))
+	return nil
+}
+
+// mapSpecFlags are flags of a map spec, prefix distinguishes the inner map of map-in-map types
+func mapSpecFlags(prefix string, required bool) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     prefix + "type",
+			Usage:    "map type, e.g. Hash, LRUHash, Array, ArrayOfMaps",
+			Required: required,
+		},
+		&cli.UintFlag{
+			Name:  prefix + "key-size",
+			Usage: "key size in bytes, may be omitted if --" + prefix + "key-layout is given",
+		},
+		&cli.UintFlag{
+			Name:  prefix + "value-size",
+			Usage: "value size in bytes, may be omitted if --" + prefix + "value-layout is given",
+		},
+		&cli.UintFlag{
+			Name:     prefix + "max-entries",
+			Required: required,
+		},
+		&cli.StringSliceFlag{
+			Name:  prefix + "flags",
+			Usage: "flag names, e.g. NO_PREALLOC",
+		},
+		&cli.StringFlag{
+			Name: prefix + "name",
+		},
+		&cli.StringFlag{
+			Name:  prefix + "key-layout",
+			Usage: "BTF layout of keys, e.g. u32 or saddr:u32,dport:u16",
+		},
+		&cli.StringFlag{
+			Name:  prefix + "value-layout",
+			Usage: "BTF layout of values, e.g. u64 or packets:u64,comm:char[16]",
+		},
+	}
+}
+
+func mapSpecFromFlags(c *cli.Context, prefix string) (*maps.CreateSpec, error) {
+	mapType, err := maps.ParseMapType(c.String(prefix + "type"))
+	if err != nil {
+		return nil, err
+	}
+	spec := &maps.CreateSpec{
+		Type:       mapType,
+		KeySize:    uint32(c.Uint(prefix + "key-size")),
+		ValueSize:  uint32(c.Uint(prefix + "value-size")),
+		MaxEntries: uint32(c.Uint(prefix + "max-entries")),
+		Flags:      c.StringSlice(prefix + "flags"),
+		Name:       c.String(prefix + "name"),
+	}
+	if layout := c.String(prefix + "key-layout"); layout != "" {
+		if spec.KeyLayout, err = maps.ParseLayout(layout); err != nil {
+			return nil, err
+		}
+	}
+	if layout := c.String(prefix + "value-layout"); layout != "" {
+		if spec.ValueLayout, err = maps.ParseLayout(layout); err != nil {
+			return nil, err
+		}
+	}
+	return spec, nil
+}
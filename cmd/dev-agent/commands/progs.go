@@ -2,7 +2,9 @@ package commands
 
 import (
 	"fmt"
+	"github.com/cilium/ebpf"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/progs"
+	"os"
 	"time"
 )
 
@@ -41,3 +43,45 @@ func (pc *ProgsCommands) ProgsList() error {
 	}
 	return nil
 }
+
+func (pc *ProgsCommands) ProgsDump(id ebpf.ProgramID) error {
+	prog, err := pc.ProgsRepo.GetProg(id)
+	if err != nil {
+		return err
+	}
+	if prog.Info == nil {
+		return prog.Error
+	}
+	insns, err := progs.GetInstructions(prog.Info)
+	if err != nil {
+		return err
+	}
+	// source lines are optional, e.g. programs loaded without BTF are dumped without them
+	source, err := progs.GetSourceInfo(id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "source lines are not available: %v\n", err)
+		source = nil
+	}
+	fmt.Print(progs.Disassemble(insns, source))
+	return nil
+}
+
+func (pc *ProgsCommands) ProgsDumpJited(id ebpf.ProgramID, raw bool) error {
+	jited, err := progs.GetJitedImage(id, true)
+	if err != nil {
+		return err
+	}
+	if len(jited.Image) == 0 {
+		return fmt.Errorf("program %d is not JIT'ed", id)
+	}
+	if raw {
+		_, err = os.Stdout.Write(jited.Image)
+		return err
+	}
+	disassembly, err := progs.DisassembleJited(jited)
+	if err != nil {
+		return err
+	}
+	fmt.Print(disassembly)
+	return nil
+}
@@ -2,13 +2,24 @@ package commands
 
 import (
 	"context"
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/btfs"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/cgroups"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/links"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/maps"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/netdevs"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/progs"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/stats"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/tasks"
 	"github.com/ebpfdev/dev-agent/pkg/graph"
 	"github.com/ebpfdev/dev-agent/pkg/graph/generated"
+	"github.com/ebpfdev/dev-agent/pkg/k8s"
+	"github.com/gorilla/websocket"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
@@ -19,14 +30,27 @@ import (
 )
 
 type ServerCommands struct {
-	MapsRepo  maps.MapsWatcher
-	ProgsRepo progs.ProgWatcher
-	TasksRepo tasks.TaskWatcher
+	MapsRepo    maps.MapsWatcher
+	ProgsRepo   progs.ProgWatcher
+	TasksRepo   tasks.TaskWatcher
+	StatsRepo   stats.StatsController
+	LinksRepo   links.LinkWatcher
+	NetdevsRepo netdevs.InterfaceWatcher
+	CgroupsRepo cgroups.CgroupWatcher
+	PodsRepo    k8s.PodResolver
+	BtfRepo     btfs.BtfWatcher
 }
 
 type ServerStartOptions struct {
-	PathPrefix  string
-	SkipWelcome bool
+	PathPrefix          string
+	SkipWelcome         bool
+	EnableStats         bool
+	EnableStatsDuration time.Duration
+	DangerousHelpers    []string
+	ConfirmationToken   string
+	PodMetrics          bool
+	// TasksRefreshInterval is 1 second if not set
+	TasksRefreshInterval time.Duration
 }
 
 const defaultPort = "8080"
@@ -40,22 +64,52 @@ func (sc *ServerCommands) ServerStart(options *ServerStartOptions) error {
 
 	registry := prometheus.NewRegistry()
 
+	if options.EnableStats {
+		if err := sc.StatsRepo.Enable(options.EnableStatsDuration); err != nil {
+			return err
+		}
+		defer sc.StatsRepo.Disable()
+	}
+
 	sc.ProgsRepo.Run(context.Background(), 1*time.Second)
 	sc.MapsRepo.Run(context.Background(), 1*time.Second)
-	sc.TasksRepo.Run(context.Background(), 1*time.Second)
+	tasksRefreshInterval := options.TasksRefreshInterval
+	if tasksRefreshInterval <= 0 {
+		tasksRefreshInterval = 1 * time.Second
+	}
+	sc.TasksRepo.Run(context.Background(), tasksRefreshInterval)
+	sc.LinksRepo.Run(context.Background(), 1*time.Second)
+	sc.NetdevsRepo.Run(context.Background(), 1*time.Second)
+	// walking cgroups is expensive on hosts with many containers
+	sc.CgroupsRepo.Run(context.Background(), 5*time.Second)
+	sc.PodsRepo.Run(context.Background(), 5*time.Second)
+	sc.BtfRepo.Run(context.Background(), 5*time.Second)
 
 	sc.ProgsRepo.RegisterMetrics(registry)
 	sc.MapsRepo.RegisterMetrics(registry)
+	sc.LinksRepo.RegisterMetrics(registry)
+	sc.TasksRepo.RegisterMetrics(registry)
+	if options.PodMetrics {
+		sc.PodsRepo.RegisterMetrics(registry)
+	}
 
 	resolver := &graph.Resolver{
-		ProgsRepository: sc.ProgsRepo,
-		MapsRepository:  sc.MapsRepo,
-		TasksRepository: sc.TasksRepo,
+		ProgsRepository:   sc.ProgsRepo,
+		MapsRepository:    sc.MapsRepo,
+		TasksRepository:   sc.TasksRepo,
+		StatsRepository:   sc.StatsRepo,
+		LinksRepository:   sc.LinksRepo,
+		NetdevsRepository: sc.NetdevsRepo,
+		CgroupsRepository: sc.CgroupsRepo,
+		PodsRepository:    sc.PodsRepo,
+		BtfRepository:     sc.BtfRepo,
+		DangerousHelpers:  options.DangerousHelpers,
+		ConfirmationToken: options.ConfirmationToken,
 	}
 
 	mux := http.NewServeMux()
 
-	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: resolver}))
+	srv := newGraphQLServer(generated.NewExecutableSchema(generated.Config{Resolvers: resolver}))
 
 	mux.Handle("/", playground.Handler("GraphQL playground", options.PathPrefix+"query"))
 	mux.Handle("/query", srv)
@@ -70,3 +124,23 @@ func (sc *ServerCommands) ServerStart(options *ServerStartOptions) error {
 	}
 	return http.ListenAndServe(":"+port, cors.Default().Handler(mux))
 }
+
+// newGraphQLServer is handler.NewDefaultServer accepting websocket connections (used by subscriptions)
+// from any origin, like CORS does for other requests
+func newGraphQLServer(schema graphql.ExecutableSchema) *handler.Server {
+	srv := handler.New(schema)
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+		Upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+	srv.SetQueryCache(lru.New(1000))
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.AutomaticPersistedQuery{Cache: lru.New(100)})
+	return srv
+}
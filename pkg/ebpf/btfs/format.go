@@ -0,0 +1,205 @@
+package btfs
+
+import (
+	"fmt"
+	"github.com/cilium/ebpf/btf"
+	"strings"
+)
+
+// Kind names the BTF kind of a type, e.g. struct, typedef, func_proto
+func Kind(typ btf.Type) string {
+	switch typ.(type) {
+	case *btf.Void:
+		return "void"
+	case *btf.Int:
+		return "int"
+	case *btf.Pointer:
+		return "ptr"
+	case *btf.Array:
+		return "array"
+	case *btf.Struct:
+		return "struct"
+	case *btf.Union:
+		return "union"
+	case *btf.Enum:
+		return "enum"
+	case *btf.Fwd:
+		return "fwd"
+	case *btf.Typedef:
+		return "typedef"
+	case *btf.Volatile:
+		return "volatile"
+	case *btf.Const:
+		return "const"
+	case *btf.Restrict:
+		return "restrict"
+	case *btf.Func:
+		return "func"
+	case *btf.FuncProto:
+		return "func_proto"
+	case *btf.Var:
+		return "var"
+	case *btf.Datasec:
+		return "datasec"
+	case *btf.Float:
+		return "float"
+	default:
+		// decl_tag and type_tag are not exported by cilium/ebpf
+		return "unknown"
+	}
+}
+
+// FuncPrototype formats a BTF function as a C declaration, e.g. `int handler(struct pt_regs *ctx)`
+func FuncPrototype(fn *btf.Func) string {
+	proto, ok := fn.Type.(*btf.FuncProto)
+	if !ok {
+		return fn.Name
+	}
+	params := make([]string, len(proto.Params))
+	for i, param := range proto.Params {
+		params[i] = CDeclaration(param.Type, param.Name)
+	}
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+	return CDeclaration(proto.Return, fn.Name+"("+strings.Join(params, ", ")+")")
+}
+
+// CDeclaration formats a declaration of name with the given type, types are referred to by their names,
+// e.g. `struct task_struct *task`; with empty name, it's the name of the type itself, e.g. `struct task_struct *`
+func CDeclaration(typ btf.Type, name string) string {
+	withName := func(s string) string {
+		if name == "" {
+			return s
+		}
+		return s + " " + name
+	}
+	switch t := typ.(type) {
+	case nil, *btf.Void:
+		return withName("void")
+	case *btf.Pointer:
+		return CDeclaration(t.Target, "*"+name)
+	case *btf.Const:
+		return formatCQualified("const", t.Type, name)
+	case *btf.Volatile:
+		return formatCQualified("volatile", t.Type, name)
+	case *btf.Restrict:
+		return CDeclaration(t.Type, name)
+	case *btf.Array:
+		if strings.HasPrefix(name, "*") {
+			name = "(" + name + ")"
+		}
+		return CDeclaration(t.Type, fmt.Sprintf("%s[%d]", name, t.Nelems))
+	case *btf.Struct:
+		return withName("struct " + t.Name)
+	case *btf.Union:
+		return withName("union " + t.Name)
+	case *btf.Enum:
+		return withName("enum " + t.Name)
+	case *btf.Fwd:
+		return withName(t.Kind.String() + " " + t.Name)
+	case *btf.FuncProto:
+		params := make([]string, len(t.Params))
+		for i, param := range t.Params {
+			params[i] = CDeclaration(param.Type, "")
+		}
+		return CDeclaration(t.Return, "("+name+")("+strings.Join(params, ", ")+")")
+	default:
+		return withName(typ.TypeName())
+	}
+}
+
+func formatCQualified(qualifier string, typ btf.Type, name string) string {
+	switch typ.(type) {
+	case *btf.Pointer, *btf.Array, *btf.FuncProto:
+		return CDeclaration(typ, qualifier+" "+name)
+	default:
+		return qualifier + " " + CDeclaration(typ, name)
+	}
+}
+
+// FormatC renders a definition of a type as C, members of structs and unions are expanded
+// (anonymous ones are inlined), other referred types are left declared by name
+func FormatC(typ btf.Type) string {
+	var sb strings.Builder
+	switch t := typ.(type) {
+	case *btf.Struct, *btf.Union, *btf.Enum:
+		formatCBody(&sb, typ, 0)
+		sb.WriteString(";")
+	case *btf.Typedef:
+		sb.WriteString("typedef ")
+		if isAnonymous(t.Type) {
+			formatCBody(&sb, t.Type, 0)
+			sb.WriteString(" " + t.Name)
+		} else {
+			sb.WriteString(CDeclaration(t.Type, t.Name))
+		}
+		sb.WriteString(";")
+	case *btf.Func:
+		sb.WriteString(FuncPrototype(t) + ";")
+	case *btf.Var:
+		sb.WriteString(CDeclaration(t.Type, t.Name) + ";")
+	case *btf.Datasec:
+		sb.WriteString(fmt.Sprintf("/* section %s, %d bytes */\n", t.Name, t.Size))
+		for _, v := range t.Vars {
+			sb.WriteString(fmt.Sprintf("/* offset %d */ %s\n", v.Offset, FormatC(v.Type)))
+		}
+	case *btf.Int:
+		sb.WriteString(fmt.Sprintf("/* %d-byte %s integer */ %s;", t.Size, t.Encoding, t.Name))
+	case *btf.Float:
+		sb.WriteString(fmt.Sprintf("/* %d-byte float */ %s;", t.Size, t.Name))
+	default:
+		sb.WriteString(CDeclaration(typ, "") + ";")
+	}
+	return sb.String()
+}
+
+func isAnonymous(typ btf.Type) bool {
+	switch typ.(type) {
+	case *btf.Struct, *btf.Union, *btf.Enum:
+		return typ.TypeName() == ""
+	}
+	return false
+}
+
+// formatCBody writes a struct, union or enum with its members, without the trailing semicolon
+func formatCBody(sb *strings.Builder, typ btf.Type, depth int) {
+	indent := strings.Repeat("\t", depth+1)
+	switch t := typ.(type) {
+	case *btf.Enum:
+		sb.WriteString(strings.TrimSpace("enum "+t.Name) + " {\n")
+		for _, value := range t.Values {
+			if t.Signed {
+				sb.WriteString(fmt.Sprintf("%s%s = %d,\n", indent, value.Name, int64(value.Value)))
+			} else {
+				sb.WriteString(fmt.Sprintf("%s%s = %d,\n", indent, value.Name, value.Value))
+			}
+		}
+	case *btf.Struct:
+		sb.WriteString(strings.TrimSpace("struct "+t.Name) + " {\n")
+		formatCMembers(sb, t.Members, depth)
+	case *btf.Union:
+		sb.WriteString(strings.TrimSpace("union "+t.Name) + " {\n")
+		formatCMembers(sb, t.Members, depth)
+	}
+	sb.WriteString(strings.Repeat("\t", depth) + "}")
+}
+
+func formatCMembers(sb *strings.Builder, members []btf.Member, depth int) {
+	indent := strings.Repeat("\t", depth+1)
+	for _, member := range members {
+		sb.WriteString(indent)
+		if isAnonymous(member.Type) {
+			formatCBody(sb, member.Type, depth+1)
+			if member.Name != "" {
+				sb.WriteString(" " + member.Name)
+			}
+		} else {
+			sb.WriteString(CDeclaration(member.Type, member.Name))
+		}
+		if member.BitfieldSize > 0 {
+			sb.WriteString(fmt.Sprintf(": %d", member.BitfieldSize))
+		}
+		sb.WriteString(";\n")
+	}
+}
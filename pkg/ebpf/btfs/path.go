@@ -0,0 +1,145 @@
+package btfs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf/btf"
+	"strconv"
+	"strings"
+)
+
+// FieldAt resolves a path of struct or union members and array indexes, e.g. stats.packets or slots[2].tokens,
+// returning the type of the field and its offset in bytes; members of anonymous structs and unions are found
+// by their own names, like in C
+func FieldAt(typ btf.Type, path string) (btf.Type, uint32, error) {
+	var offset uint32
+	rest := path
+	for rest != "" {
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, 0, fmt.Errorf("unclosed [ in %s", path)
+			}
+			index, err := strconv.ParseUint(rest[1:end], 10, 32)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid index in %s", path)
+			}
+			array, ok := btf.UnderlyingType(typ).(*btf.Array)
+			if !ok {
+				return nil, 0, fmt.Errorf("%s is not an array", strings.TrimSuffix(path, rest))
+			}
+			if uint32(index) >= array.Nelems {
+				return nil, 0, fmt.Errorf("index %d is out of range of %s", index, strings.TrimSuffix(path, rest))
+			}
+			elemSize, err := btf.Sizeof(array.Type)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += uint32(index) * uint32(elemSize)
+			typ = array.Type
+			rest = rest[end+1:]
+		case rest[0] == '.' && len(rest) > 1:
+			rest = rest[1:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			member, memberOffset, err := findMember(typ, rest[:end])
+			if err != nil {
+				return nil, 0, fmt.Errorf("field %s: %w", path, err)
+			}
+			offset += memberOffset
+			typ = member.Type
+			rest = rest[end:]
+		}
+	}
+	return typ, offset, nil
+}
+
+func findMember(typ btf.Type, name string) (*btf.Member, uint32, error) {
+	var members []btf.Member
+	switch t := btf.UnderlyingType(typ).(type) {
+	case *btf.Struct:
+		members = t.Members
+	case *btf.Union:
+		members = t.Members
+	default:
+		return nil, 0, fmt.Errorf("%s is not a struct or union, it has no member %s", Kind(btf.UnderlyingType(typ)), name)
+	}
+	for i := range members {
+		member := &members[i]
+		if member.Name == "" {
+			if found, offset, err := findMember(member.Type, name); err == nil {
+				return found, uint32(member.Offset)/8 + offset, nil
+			}
+			continue
+		}
+		if member.Name != name {
+			continue
+		}
+		if member.BitfieldSize > 0 || member.Offset%8 != 0 {
+			return nil, 0, errors.New("bitfields are not supported")
+		}
+		return member, uint32(member.Offset) / 8, nil
+	}
+	return nil, 0, fmt.Errorf("no member %s", name)
+}
+
+// IntField is an integer field of a type, see IntFields
+type IntField struct {
+	// Path is a path of the field as accepted by FieldAt, it's empty if the type is an integer itself
+	Path   string
+	Offset uint32
+	Size   uint32
+	Signed bool
+}
+
+// IntFields lists integer fields of a type recursively, including elements of integer arrays,
+// but not bitfields, booleans and chars, which are not counters
+func IntFields(typ btf.Type) []IntField {
+	var result []IntField
+	collectIntFields(typ, "", 0, &result)
+	return result
+}
+
+func collectIntFields(typ btf.Type, path string, offset uint32, result *[]IntField) {
+	switch t := btf.UnderlyingType(typ).(type) {
+	case *btf.Int:
+		if t.Encoding == btf.Bool || isChar(t) || (t.Size != 1 && t.Size != 2 && t.Size != 4 && t.Size != 8) {
+			return
+		}
+		*result = append(*result, IntField{Path: path, Offset: offset, Size: t.Size, Signed: t.Encoding == btf.Signed})
+	case *btf.Enum:
+		*result = append(*result, IntField{Path: path, Offset: offset, Size: t.Size, Signed: t.Signed})
+	case *btf.Array:
+		elemSize, err := btf.Sizeof(t.Type)
+		if err != nil || isChar(t.Type) {
+			return
+		}
+		for i := uint32(0); i < t.Nelems; i++ {
+			collectIntFields(t.Type, fmt.Sprintf("%s[%d]", path, i), offset+i*uint32(elemSize), result)
+		}
+	case *btf.Struct:
+		collectMemberIntFields(t.Members, path, offset, result)
+	case *btf.Union:
+		collectMemberIntFields(t.Members, path, offset, result)
+	}
+}
+
+func collectMemberIntFields(members []btf.Member, path string, offset uint32, result *[]IntField) {
+	for _, member := range members {
+		if member.BitfieldSize > 0 || member.Offset%8 != 0 {
+			continue
+		}
+		memberPath := path
+		if member.Name != "" {
+			if memberPath != "" {
+				memberPath += "."
+			}
+			memberPath += member.Name
+		}
+		collectIntFields(member.Type, memberPath, offset+uint32(member.Offset)/8, result)
+	}
+}
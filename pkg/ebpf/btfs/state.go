@@ -0,0 +1,321 @@
+package btfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf/btf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+type BtfInfo struct {
+	ID uint32
+	// Name is vmlinux or a module name for kernel BTF, it's usually empty for BTF of programs and maps
+	Name string
+	// Size of raw BTF in bytes
+	Size     uint32
+	IsKernel bool
+}
+
+func (bi *BtfInfo) IsVmlinux() bool {
+	return bi.IsKernel && bi.Name == "vmlinux"
+}
+
+func (bi *BtfInfo) IsModule() bool {
+	return bi.IsKernel && bi.Name != "vmlinux"
+}
+
+// TypeInfo is a type of a loaded BTF object
+type TypeInfo struct {
+	BtfID uint32
+	ID    btf.TypeID
+	Type  btf.Type
+}
+
+type BtfWatcher interface {
+	Run(ctx context.Context, refreshInterval time.Duration)
+	GetBtfs() ([]*BtfInfo, error)
+	GetBtf(id uint32) (*BtfInfo, error)
+	// SearchTypes finds types which names contain the substring, in a single BTF object or in all of them if btfID is nil
+	SearchTypes(btfID *uint32, name string, limit int) ([]*TypeInfo, error)
+	GetType(btfID uint32, typeID btf.TypeID) (*TypeInfo, error)
+}
+
+type btfWatcher struct {
+	log zerolog.Logger
+	// mu guards results of the last fetch, they are replaced by the watcher while queries read them
+	mu        sync.RWMutex
+	btfs      []*BtfInfo
+	error     error
+	isRunning bool
+}
+
+func NewWatcher(logger zerolog.Logger) BtfWatcher {
+	return &btfWatcher{
+		log: logger,
+	}
+}
+
+func (bw *btfWatcher) Run(ctx context.Context, refreshInterval time.Duration) {
+	if bw.isRunning {
+		return
+	}
+	go func() {
+		bw.isRunning = true
+		ticker := time.NewTicker(refreshInterval)
+		for {
+			select {
+			case <-ticker.C:
+				btfs, err := bw.fetchBtfs()
+				bw.mu.Lock()
+				bw.btfs, bw.error = btfs, err
+				bw.mu.Unlock()
+			case <-ctx.Done():
+				bw.isRunning = false
+				return
+			}
+		}
+	}()
+}
+
+func (bw *btfWatcher) GetBtfs() ([]*BtfInfo, error) {
+	bw.mu.RLock()
+	btfs, err := bw.btfs, bw.error
+	bw.mu.RUnlock()
+	if btfs == nil && err == nil {
+		return bw.fetchBtfs()
+	}
+	return btfs, err
+}
+
+func (bw *btfWatcher) GetBtf(id uint32) (*BtfInfo, error) {
+	btfs, err := bw.GetBtfs()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range btfs {
+		if info.ID == id {
+			return info, nil
+		}
+	}
+	return nil, errors.New("BTF not found")
+}
+
+// bpfBtfInfo mirrors struct bpf_btf_info
+type bpfBtfInfo struct {
+	Btf       uint64
+	BtfSize   uint32
+	ID        uint32
+	Name      uint64
+	NameLen   uint32
+	KernelBtf uint32
+}
+
+func (bw *btfWatcher) fetchBtfs() ([]*BtfInfo, error) {
+	bw.log.Debug().Msg("fetching BTF objects")
+	result := []*BtfInfo{}
+	it := new(btf.HandleIterator)
+	for it.Next() {
+		info, err := getBtfInfo(it.Handle.FD())
+		if err != nil {
+			bw.log.Debug().Err(err).Msgf("failed to get info of BTF %d", it.ID)
+			continue
+		}
+		result = append(result, info)
+	}
+	if err := it.Err(); err != nil {
+		return result, err
+	}
+	forgetSpecs(result)
+	return result, nil
+}
+
+func getBtfInfo(fd int) (*BtfInfo, error) {
+	name := make([]byte, unix.NAME_MAX)
+	raw := bpfBtfInfo{
+		Name:    uint64(uintptr(unsafe.Pointer(&name[0]))),
+		NameLen: uint32(len(name)),
+	}
+	if err := util.ObjGetInfoByFD(fd, unsafe.Pointer(&raw), unsafe.Sizeof(raw)); err != nil {
+		return nil, err
+	}
+	return &BtfInfo{
+		ID:       raw.ID,
+		Name:     unix.ByteSliceToString(name),
+		Size:     raw.BtfSize,
+		IsKernel: raw.KernelBtf != 0,
+	}, nil
+}
+
+// kernel BTF is large, so parsed specs of vmlinux and modules are kept until they are unloaded,
+// a reloaded module gets a new ID. Numbers of vmlinux types are kept by vmlinux ID.
+var (
+	kernelSpecs   = map[uint32]*btf.Spec{}
+	vmlinuxTypes  = map[uint32]btf.TypeID{}
+	kernelSpecsMu sync.Mutex
+)
+
+// forgetSpecs drops cached specs of BTF objects which are not listed anymore
+func forgetSpecs(btfs []*BtfInfo) {
+	listed := make(map[uint32]bool, len(btfs))
+	for _, info := range btfs {
+		listed[info.ID] = true
+	}
+	kernelSpecsMu.Lock()
+	defer kernelSpecsMu.Unlock()
+	for id := range kernelSpecs {
+		if !listed[id] {
+			delete(kernelSpecs, id)
+			delete(vmlinuxTypes, id)
+		}
+	}
+}
+
+// LoadSpec parses a loaded BTF object, specs of kernel BTF are cached
+func LoadSpec(id uint32) (*btf.Spec, *BtfInfo, error) {
+	handle, err := btf.NewHandleFromID(btf.ID(id))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer handle.Close()
+	info, err := getBtfInfo(handle.FD())
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsKernel {
+		spec, err := handle.Spec()
+		return spec, info, err
+	}
+
+	kernelSpecsMu.Lock()
+	defer kernelSpecsMu.Unlock()
+	if spec, ok := kernelSpecs[id]; ok {
+		return spec, info, nil
+	}
+	spec, err := handle.Spec()
+	if err != nil {
+		return nil, info, err
+	}
+	kernelSpecs[id] = spec
+	return spec, info, nil
+}
+
+// VmlinuxID returns the ID of the kernel image BTF
+func VmlinuxID() (uint32, error) {
+	handle, err := btf.FindHandle(func(info *btf.HandleInfo) bool {
+		return info.IsVmlinux()
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer handle.Close()
+	info, err := getBtfInfo(handle.FD())
+	if err != nil {
+		return 0, err
+	}
+	return info.ID, nil
+}
+
+func (bw *btfWatcher) GetType(btfID uint32, typeID btf.TypeID) (*TypeInfo, error) {
+	spec, _, err := LoadSpec(btfID)
+	if err != nil {
+		return nil, err
+	}
+	typ, err := spec.TypeByID(typeID)
+	if err != nil {
+		return nil, err
+	}
+	return &TypeInfo{BtfID: btfID, ID: typeID, Type: typ}, nil
+}
+
+func (bw *btfWatcher) SearchTypes(btfID *uint32, name string, limit int) ([]*TypeInfo, error) {
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	var ids []uint32
+	if btfID != nil {
+		ids = []uint32{*btfID}
+	} else {
+		btfs, err := bw.GetBtfs()
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range btfs {
+			ids = append(ids, info.ID)
+		}
+	}
+
+	result := []*TypeInfo{}
+	var firstModuleID btf.TypeID
+	for _, id := range ids {
+		spec, info, err := LoadSpec(id)
+		if err != nil {
+			if btfID != nil {
+				return nil, err
+			}
+			// e.g. the object has been unloaded since it was listed
+			bw.log.Debug().Err(err).Msgf("failed to load BTF %d", id)
+			continue
+		}
+		// types of modules follow types of vmlinux, which are not repeated for each module
+		firstID := btf.TypeID(0)
+		if info.IsModule() {
+			if firstModuleID == 0 {
+				if firstModuleID, err = firstModuleTypeID(); err != nil {
+					return nil, fmt.Errorf("failed to load vmlinux BTF: %w", err)
+				}
+			}
+			firstID = firstModuleID
+		}
+		for it := spec.Iterate(); it.Next(); {
+			typeName := it.Type.TypeName()
+			if typeName == "" || !strings.Contains(typeName, name) {
+				continue
+			}
+			typeID, err := spec.TypeID(it.Type)
+			if err != nil || typeID < firstID {
+				continue
+			}
+			result = append(result, &TypeInfo{BtfID: id, ID: typeID, Type: it.Type})
+		}
+	}
+	// exact matches first
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Type.TypeName() == name && result[j].Type.TypeName() != name
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// firstModuleTypeID returns the ID of the first type of module BTF, which is the number of vmlinux types;
+// it's counted once per vmlinux spec
+func firstModuleTypeID() (btf.TypeID, error) {
+	id, err := VmlinuxID()
+	if err != nil {
+		return 0, err
+	}
+	spec, _, err := LoadSpec(id)
+	if err != nil {
+		return 0, err
+	}
+	kernelSpecsMu.Lock()
+	defer kernelSpecsMu.Unlock()
+	if count, ok := vmlinuxTypes[id]; ok {
+		return count, nil
+	}
+	count := 0
+	for it := spec.Iterate(); it.Next(); {
+		count++
+	}
+	vmlinuxTypes[id] = btf.TypeID(count)
+	return btf.TypeID(count), nil
+}
@@ -0,0 +1,224 @@
+package btfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf/btf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FormatValue formats raw data of a BTF type as a C initializer, e.g. `{.pid = 1, .comm = "bash"}`,
+// data that can't be interpreted is formatted as hex
+func FormatValue(typ btf.Type, data []byte) string {
+	var sb strings.Builder
+	formatValue(&sb, typ, data)
+	return sb.String()
+}
+
+func formatValue(sb *strings.Builder, typ btf.Type, data []byte) {
+	typ = btf.UnderlyingType(typ)
+	if size, err := btf.Sizeof(typ); err != nil || size > len(data) {
+		fmt.Fprintf(sb, "%x", data)
+		return
+	}
+	switch t := typ.(type) {
+	case *btf.Int:
+		raw := readUint(data, t.Size)
+		switch {
+		case t.Encoding == btf.Bool:
+			sb.WriteString(strconv.FormatBool(raw != 0))
+		case t.Size > 8:
+			fmt.Fprintf(sb, "0x%x", data[:t.Size])
+		case t.Encoding == btf.Signed:
+			sb.WriteString(strconv.FormatInt(signExtend(raw, t.Size), 10))
+		default:
+			sb.WriteString(strconv.FormatUint(raw, 10))
+		}
+	case *btf.Enum:
+		raw := readUint(data, t.Size)
+		for _, value := range t.Values {
+			if uint64(value.Value) == raw || (t.Signed && int64(value.Value) == signExtend(raw, t.Size)) {
+				sb.WriteString(value.Name)
+				return
+			}
+		}
+		if t.Signed {
+			sb.WriteString(strconv.FormatInt(signExtend(raw, t.Size), 10))
+		} else {
+			sb.WriteString(strconv.FormatUint(raw, 10))
+		}
+	case *btf.Pointer:
+		fmt.Fprintf(sb, "0x%x", readUint(data, uint32(len(data))))
+	case *btf.Float:
+		switch t.Size {
+		case 4:
+			sb.WriteString(strconv.FormatFloat(float64(math.Float32frombits(uint32(readUint(data, 4)))), 'g', -1, 32))
+		case 8:
+			sb.WriteString(strconv.FormatFloat(math.Float64frombits(readUint(data, 8)), 'g', -1, 64))
+		default:
+			fmt.Fprintf(sb, "0x%x", data[:t.Size])
+		}
+	case *btf.Array:
+		elemSize, _ := btf.Sizeof(t.Type)
+		if isChar(t.Type) {
+			end := bytes.IndexByte(data[:t.Nelems], 0)
+			if end < 0 {
+				end = int(t.Nelems)
+			}
+			sb.WriteString(strconv.Quote(string(data[:end])))
+			return
+		}
+		sb.WriteString("{")
+		for i := 0; i < int(t.Nelems); i++ {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			formatValue(sb, t.Type, data[i*elemSize:])
+		}
+		sb.WriteString("}")
+	case *btf.Struct:
+		formatMembersValue(sb, t.Members, data)
+	case *btf.Union:
+		formatMembersValue(sb, t.Members, data)
+	default:
+		size, _ := btf.Sizeof(typ)
+		fmt.Fprintf(sb, "%x", data[:size])
+	}
+}
+
+func formatMembersValue(sb *strings.Builder, members []btf.Member, data []byte) {
+	sb.WriteString("{")
+	for i, member := range members {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		if member.Name != "" {
+			fmt.Fprintf(sb, ".%s = ", member.Name)
+		}
+		offset := uint32(member.Offset) / 8
+		if member.BitfieldSize == 0 {
+			formatValue(sb, member.Type, data[offset:])
+			continue
+		}
+		// bitfields are read from the 8 bytes starting at the byte of the first bit, little-endian hosts only
+		buf := make([]byte, 8)
+		copy(buf, data[offset:])
+		raw := util.GetEndian().Uint64(buf) >> (uint32(member.Offset) % 8)
+		raw &= (1 << uint32(member.BitfieldSize)) - 1
+		sb.WriteString(strconv.FormatUint(raw, 10))
+	}
+	sb.WriteString("}")
+}
+
+// ParseValue encodes a number, a boolean, an enum value name or a string (for char arrays) as data of a BTF type
+func ParseValue(typ btf.Type, value string) ([]byte, error) {
+	typ = btf.UnderlyingType(typ)
+	size, err := btf.Sizeof(typ)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, size)
+	switch t := typ.(type) {
+	case *btf.Int:
+		if t.Size > 8 {
+			return nil, fmt.Errorf("%d-byte integers are not supported", t.Size)
+		}
+		if t.Encoding == btf.Bool {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, err
+			}
+			if parsed {
+				result[0] = 1
+			}
+			return result, nil
+		}
+		raw, err := parseInt(value, t.Size, t.Encoding == btf.Signed)
+		if err != nil {
+			return nil, err
+		}
+		writeUint(result, raw)
+	case *btf.Enum:
+		for _, enumValue := range t.Values {
+			if enumValue.Name == value {
+				writeUint(result, uint64(enumValue.Value))
+				return result, nil
+			}
+		}
+		raw, err := parseInt(value, t.Size, t.Signed)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither a value of enum %s nor a number", value, t.Name)
+		}
+		writeUint(result, raw)
+	case *btf.Pointer:
+		raw, err := strconv.ParseUint(value, 0, size*8)
+		if err != nil {
+			return nil, err
+		}
+		writeUint(result, raw)
+	case *btf.Float:
+		parsed, err := strconv.ParseFloat(value, int(t.Size)*8)
+		if err != nil {
+			return nil, err
+		}
+		switch t.Size {
+		case 4:
+			writeUint(result, uint64(math.Float32bits(float32(parsed))))
+		case 8:
+			writeUint(result, math.Float64bits(parsed))
+		default:
+			return nil, fmt.Errorf("%d-byte floats are not supported", t.Size)
+		}
+	case *btf.Array:
+		if !isChar(t.Type) {
+			return nil, errors.New("only char arrays can be set, as strings")
+		}
+		if len(value) > int(t.Nelems) {
+			return nil, fmt.Errorf("string is too long (%d bytes vs %d expected)", len(value), t.Nelems)
+		}
+		copy(result, value)
+	default:
+		return nil, fmt.Errorf("values of %s types can't be set, only numbers, booleans, enums and strings", Kind(typ))
+	}
+	return result, nil
+}
+
+func isChar(typ btf.Type) bool {
+	elem, ok := btf.UnderlyingType(typ).(*btf.Int)
+	return ok && elem.Size == 1 && (elem.Encoding == btf.Char || strings.HasSuffix(elem.Name, "char"))
+}
+
+func parseInt(value string, size uint32, signed bool) (uint64, error) {
+	if signed {
+		parsed, err := strconv.ParseInt(value, 0, int(size)*8)
+		return uint64(parsed), err
+	}
+	return strconv.ParseUint(value, 0, int(size)*8)
+}
+
+func readUint(data []byte, size uint32) uint64 {
+	buf := make([]byte, 8)
+	if size > 8 {
+		size = 8
+	}
+	copy(buf, data[:size])
+	return util.GetEndian().Uint64(buf)
+}
+
+func writeUint(data []byte, value uint64) {
+	buf := make([]byte, 8)
+	util.GetEndian().PutUint64(buf, value)
+	copy(data, buf)
+}
+
+func signExtend(value uint64, size uint32) int64 {
+	if size >= 8 {
+		return int64(value)
+	}
+	shift := 64 - size*8
+	return int64(value<<shift) >> shift
+}
@@ -0,0 +1,275 @@
+package cgroups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// attachTypes are attach types of programs attached to cgroups
+var attachTypes = []ebpf.AttachType{
+	ebpf.AttachCGroupInetIngress,
+	ebpf.AttachCGroupInetEgress,
+	ebpf.AttachCGroupInetSockCreate,
+	ebpf.AttachCGroupSockOps,
+	ebpf.AttachCGroupDevice,
+	ebpf.AttachCGroupInet4Bind,
+	ebpf.AttachCGroupInet6Bind,
+	ebpf.AttachCGroupInet4Connect,
+	ebpf.AttachCGroupInet6Connect,
+	ebpf.AttachCGroupInet4PostBind,
+	ebpf.AttachCGroupInet6PostBind,
+	ebpf.AttachCGroupUDP4Sendmsg,
+	ebpf.AttachCGroupUDP6Sendmsg,
+	ebpf.AttachCGroupSysctl,
+	ebpf.AttachCGroupUDP4Recvmsg,
+	ebpf.AttachCGroupUDP6Recvmsg,
+	ebpf.AttachCGroupGetsockopt,
+	ebpf.AttachCGroupSetsockopt,
+	ebpf.AttachCgroupInet4GetPeername,
+	ebpf.AttachCgroupInet6GetPeername,
+	ebpf.AttachCgroupInet4GetSockname,
+	ebpf.AttachCgroupInet6GetSockname,
+	ebpf.AttachCgroupInetSockRelease,
+	// BPF_LSM_CGROUP and BPF_CGROUP_UNIX_*, not known by cilium/ebpf yet
+	43, 49, 50, 51, 52, 53,
+}
+
+type Attachment struct {
+	AttachType ebpf.AttachType
+	ProgramID  ebpf.ProgramID
+	// Direct is false if the program is inherited from an ancestor cgroup (only effective here)
+	Direct bool
+	// Flags are BPF_F_ALLOW_OVERRIDE/BPF_F_ALLOW_MULTI the programs of this attach type were attached with,
+	// they are reported for direct attachments only
+	Flags uint32
+}
+
+type CgroupInfo struct {
+	// ID is a cgroup ID, it's the inode number of the cgroup directory
+	ID uint64
+	// Path is relative to the cgroup root, e.g. /system.slice/docker.service
+	Path        string
+	Attachments []*Attachment
+}
+
+type CgroupWatcher interface {
+	Run(ctx context.Context, refreshInterval time.Duration)
+	GetCgroups() ([]*CgroupInfo, error)
+	// GetRoot returns the cgroup v2 mount point being walked
+	GetRoot() string
+}
+
+type cgroupWatcher struct {
+	log zerolog.Logger
+	// mu guards results of the last fetch, they are replaced by the watcher while queries read them
+	mu        sync.RWMutex
+	cgroups   []*CgroupInfo
+	error     error
+	isRunning bool
+	cgroupDir string
+}
+
+func NewWatcher(logger zerolog.Logger, cgroupDir string) CgroupWatcher {
+	return &cgroupWatcher{
+		log:       logger,
+		cgroupDir: cgroupDir,
+	}
+}
+
+func (cw *cgroupWatcher) Run(ctx context.Context, refreshInterval time.Duration) {
+	if cw.isRunning {
+		return
+	}
+	go func() {
+		cw.isRunning = true
+		ticker := time.NewTicker(refreshInterval)
+		for {
+			select {
+			case <-ticker.C:
+				cgroups, err := cw.fetchCgroups()
+				cw.mu.Lock()
+				cw.cgroups, cw.error = cgroups, err
+				cw.mu.Unlock()
+			case <-ctx.Done():
+				cw.isRunning = false
+				return
+			}
+		}
+	}()
+}
+
+func (cw *cgroupWatcher) GetCgroups() ([]*CgroupInfo, error) {
+	cw.mu.RLock()
+	cgroups, err := cw.cgroups, cw.error
+	cw.mu.RUnlock()
+	if cgroups == nil && err == nil {
+		return cw.fetchCgroups()
+	}
+	return cgroups, err
+}
+
+func (cw *cgroupWatcher) GetRoot() string {
+	root, err := findCgroup2Root(cw.cgroupDir)
+	if err != nil {
+		return cw.cgroupDir
+	}
+	return root
+}
+
+// findCgroup2Root returns dir if it's cgroup v2 mount, or its "unified" subdirectory on hybrid hierarchy hosts
+func findCgroup2Root(dir string) (string, error) {
+	for _, candidate := range []string{dir, filepath.Join(dir, "unified")} {
+		var statfs unix.Statfs_t
+		if err := unix.Statfs(candidate, &statfs); err != nil {
+			continue
+		}
+		if statfs.Type == unix.CGROUP2_SUPER_MAGIC {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("cgroup v2 is not mounted at %s", dir)
+}
+
+func (cw *cgroupWatcher) fetchCgroups() ([]*CgroupInfo, error) {
+	cw.log.Debug().Msg("fetching cgroups")
+	root, err := findCgroup2Root(cw.cgroupDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// attach types which have programs attached directly to the cgroup or its ancestors,
+	// only these are queried for effective programs
+	attachedTypes := map[string]map[ebpf.AttachType]bool{}
+	// attach types that the kernel doesn't know
+	unsupported := map[ebpf.AttachType]bool{}
+
+	result := []*CgroupInfo{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// cgroups come and go
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		relPath := "/" + strings.TrimPrefix(strings.TrimPrefix(path, root), "/")
+		inherited := attachedTypes[filepath.Dir(relPath)]
+		if relPath == "/" {
+			inherited = nil
+		}
+		info, attached, err := queryCgroup(path, inherited, unsupported)
+		if err != nil {
+			cw.log.Debug().Err(err).Msgf("failed to query cgroup %s", path)
+			return nil
+		}
+		info.Path = relPath
+		attachedTypes[relPath] = attached
+		result = append(result, info)
+		return nil
+	})
+	return result, err
+}
+
+// queryCgroup reads direct and effective programs of a cgroup,
+// it returns attach types with programs attached to the cgroup or its ancestors
+func queryCgroup(path string, inherited map[ebpf.AttachType]bool, unsupported map[ebpf.AttachType]bool) (*CgroupInfo, map[ebpf.AttachType]bool, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer dir.Close()
+	stat, err := dir.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &CgroupInfo{
+		Attachments: []*Attachment{},
+	}
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+		info.ID = sys.Ino
+	}
+
+	attached := make(map[ebpf.AttachType]bool, len(inherited))
+	for attachType := range inherited {
+		attached[attachType] = true
+	}
+
+	fd := uint32(dir.Fd())
+	for _, attachType := range attachTypes {
+		if unsupported[attachType] {
+			continue
+		}
+		direct, err := util.ProgQuery(fd, uint32(attachType), 0, false)
+		if err != nil {
+			if errors.Is(err, unix.EINVAL) {
+				unsupported[attachType] = true
+			}
+			continue
+		}
+		directIDs := make(map[uint32]bool, len(direct.ProgIDs))
+		for _, id := range direct.ProgIDs {
+			directIDs[id] = true
+		}
+		if len(direct.ProgIDs) > 0 {
+			attached[attachType] = true
+		}
+		if !attached[attachType] {
+			continue
+		}
+
+		effective, err := util.ProgQuery(fd, uint32(attachType), unix.BPF_F_QUERY_EFFECTIVE, false)
+		if err != nil {
+			continue
+		}
+		for _, id := range effective.ProgIDs {
+			attachment := &Attachment{
+				AttachType: attachType,
+				ProgramID:  ebpf.ProgramID(id),
+				Direct:     directIDs[id],
+			}
+			if attachment.Direct {
+				attachment.Flags = direct.AttachFlags
+			}
+			info.Attachments = append(info.Attachments, attachment)
+		}
+	}
+	return info, attached, nil
+}
+
+// FlagNames names BPF_F_* attach flags of cgroup programs
+func FlagNames(flags uint32) []string {
+	result := []string{}
+	for _, flag := range []struct {
+		value uint32
+		name  string
+	}{
+		{unix.BPF_F_ALLOW_OVERRIDE, "ALLOW_OVERRIDE"},
+		{unix.BPF_F_ALLOW_MULTI, "ALLOW_MULTI"},
+		{unix.BPF_F_REPLACE, "REPLACE"},
+	} {
+		if flags&flag.value != 0 {
+			result = append(result, flag.name)
+			flags &^= flag.value
+		}
+	}
+	if flags != 0 {
+		result = append(result, fmt.Sprintf("%#x", flags))
+	}
+	return result
+}
@@ -0,0 +1,199 @@
+package ksyms
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKallsymsPath = "/proc/kallsyms"
+	defaultModulesPath  = "/proc/modules"
+
+	// moduleCheckInterval limits how often the list of modules is compared to the one the table was loaded with
+	moduleCheckInterval = 5 * time.Second
+	// minRefreshInterval limits how often Refresh reloads the table, e.g. when symbols of programs are missing
+	// because of net.core.bpf_jit_kallsyms=0, each program of a query would reload it otherwise
+	minRefreshInterval = time.Second
+)
+
+type Symbol struct {
+	Address uint64
+	Name    string
+	Type    byte
+	// Module is empty for symbols of the kernel image
+	Module string
+}
+
+type Table struct {
+	symbols []Symbol
+	byName  map[string]uint64
+}
+
+var (
+	defaultTable    *Table
+	defaultTableErr error
+	defaultTableMu  sync.Mutex
+	// defaultModules is the content of /proc/modules when the default table was loaded
+	defaultModules   string
+	modulesCheckedAt time.Time
+	// defaultLoadedAt is when the default table was loaded
+	defaultLoadedAt time.Time
+)
+
+// Default returns a table of /proc/kallsyms, which is loaded on the first call
+// and reloaded when kernel modules are loaded or unloaded
+func Default() (*Table, error) {
+	defaultTableMu.Lock()
+	defer defaultTableMu.Unlock()
+	if defaultTable != nil && time.Since(modulesCheckedAt) >= moduleCheckInterval {
+		modulesCheckedAt = time.Now()
+		if modules := readModules(); modules != defaultModules {
+			defaultTable, defaultTableErr = nil, nil
+		}
+	}
+	if defaultTable == nil && defaultTableErr == nil {
+		defaultModules, modulesCheckedAt = readModules(), time.Now()
+		defaultTable, defaultTableErr = Load(defaultKallsymsPath)
+		defaultLoadedAt = time.Now()
+	}
+	return defaultTable, defaultTableErr
+}
+
+// Refresh reloads the default table, e.g. to pick up symbols of recently loaded programs;
+// a table loaded less than minRefreshInterval ago is returned as is
+func Refresh() (*Table, error) {
+	defaultTableMu.Lock()
+	if defaultTable != nil && time.Since(defaultLoadedAt) < minRefreshInterval {
+		defer defaultTableMu.Unlock()
+		return defaultTable, defaultTableErr
+	}
+	defaultTableMu.Unlock()
+	modules := readModules()
+	table, err := Load(defaultKallsymsPath)
+	defaultTableMu.Lock()
+	defer defaultTableMu.Unlock()
+	if err == nil || defaultTable == nil {
+		defaultTable, defaultTableErr = table, err
+		defaultModules, modulesCheckedAt = modules, time.Now()
+		defaultLoadedAt = time.Now()
+	}
+	return defaultTable, defaultTableErr
+}
+
+// readModules reads names of loaded modules, it's empty if the kernel doesn't support modules
+func readModules() string {
+	content, err := os.ReadFile(defaultModulesPath)
+	if err != nil {
+		return ""
+	}
+	var names []string
+	for _, line := range strings.Split(string(content), "\n") {
+		// name size refcount dependencies state address, only names are compared as refcounts change all the time
+		if name, _, found := strings.Cut(line, " "); found {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// Load reads kernel symbols in /proc/kallsyms format
+func Load(path string) (*Table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	table := &Table{
+		byName: make(map[string]uint64),
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		addr, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil || addr == 0 {
+			continue
+		}
+		symbol := Symbol{
+			Address: addr,
+			Name:    fields[2],
+			Type:    fields[1][0],
+		}
+		if len(fields) > 3 {
+			symbol.Module = strings.Trim(fields[3], "[]")
+		}
+		table.symbols = append(table.symbols, symbol)
+		if _, ok := table.byName[symbol.Name]; !ok {
+			table.byName[symbol.Name] = addr
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(table.symbols) == 0 {
+		return nil, errors.New("no kernel symbol addresses available (check kernel.kptr_restrict)")
+	}
+
+	sort.SliceStable(table.symbols, func(i, j int) bool {
+		return table.symbols[i].Address < table.symbols[j].Address
+	})
+
+	return table, nil
+}
+
+// Address returns an address of a symbol by its name
+func (t *Table) Address(name string) (uint64, bool) {
+	addr, ok := t.byName[name]
+	return addr, ok
+}
+
+// Exact returns a symbol starting exactly at the address
+func (t *Table) Exact(addr uint64) (*Symbol, bool) {
+	symbol, ok := t.Nearest(addr)
+	if !ok || symbol.Address != addr {
+		return nil, false
+	}
+	return symbol, true
+}
+
+// Nearest returns the closest symbol at or below the address
+func (t *Table) Nearest(addr uint64) (*Symbol, bool) {
+	i := sort.Search(len(t.symbols), func(i int) bool {
+		return t.symbols[i].Address > addr
+	})
+	if i == 0 {
+		return nil, false
+	}
+	// several symbols may share an address, prefer the first one
+	i--
+	for i > 0 && t.symbols[i-1].Address == t.symbols[i].Address {
+		i--
+	}
+	return &t.symbols[i], true
+}
+
+// Format resolves an address to "symbol+0x10", with the module name appended as "symbol+0x10 [module]"
+func (t *Table) Format(addr uint64) (string, bool) {
+	symbol, ok := t.Nearest(addr)
+	if !ok {
+		return "", false
+	}
+	result := symbol.Name
+	if addr != symbol.Address {
+		result += "+0x" + strconv.FormatUint(addr-symbol.Address, 16)
+	}
+	if symbol.Module != "" {
+		result += " [" + symbol.Module + "]"
+	}
+	return result, true
+}
@@ -0,0 +1,205 @@
+package links
+
+import (
+	"bytes"
+	"github.com/cilium/ebpf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"golang.org/x/sys/unix"
+	"runtime"
+	"unsafe"
+)
+
+type LinkID uint32
+
+// bpfLinkInfo mirrors struct bpf_link_info, type-specific union is decoded manually
+type bpfLinkInfo struct {
+	Type   LinkType
+	ID     LinkID
+	ProgID uint32
+	_      [4]byte
+	Extra  [64]byte
+}
+
+type linkIDAttr struct {
+	ID     uint32
+	NextID uint32
+	Flags  uint32
+}
+
+func linkGetNextID(id LinkID) (LinkID, error) {
+	attr := &linkIDAttr{ID: uint32(id)}
+	_, err := util.CallBPF(unix.BPF_LINK_GET_NEXT_ID, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	return LinkID(attr.NextID), err
+}
+
+// NewLinkFDFromID opens a file descriptor of a link, caller is responsible to close it
+func NewLinkFDFromID(id LinkID) (int, error) {
+	attr := &linkIDAttr{ID: uint32(id)}
+	fd, err := util.CallBPF(unix.BPF_LINK_GET_FD_BY_ID, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return -1, err
+	}
+	return int(fd), nil
+}
+
+type linkDetachAttr struct {
+	LinkFd uint32
+}
+
+func linkDetach(fd int) error {
+	attr := &linkDetachAttr{LinkFd: uint32(fd)}
+	_, err := util.CallBPF(unix.BPF_LINK_DETACH, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	return err
+}
+
+func getLinkInfo(fd int, info *bpfLinkInfo) error {
+	return util.ObjGetInfoByFD(fd, unsafe.Pointer(info), unsafe.Sizeof(*info))
+}
+
+func (li *bpfLinkInfo) u32(offset int) uint32 {
+	return util.GetEndian().Uint32(li.Extra[offset : offset+4])
+}
+
+func (li *bpfLinkInfo) u64(offset int) uint64 {
+	return util.GetEndian().Uint64(li.Extra[offset : offset+8])
+}
+
+func (li *bpfLinkInfo) putU32(offset int, value uint32) {
+	util.GetEndian().PutUint32(li.Extra[offset:offset+4], value)
+}
+
+func (li *bpfLinkInfo) putPtr(offset int, ptr unsafe.Pointer) {
+	util.GetEndian().PutUint64(li.Extra[offset:offset+8], uint64(uintptr(ptr)))
+}
+
+const stringBufSize = 4096
+
+// fetchLinkInfo reads link info in two passes: first one to learn the type and sizes,
+// second one with buffers for names and addresses attached to the union fields
+func fetchLinkInfo(id LinkID) (*LinkInfo, error) {
+	fd, err := NewLinkFDFromID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	var info bpfLinkInfo
+	if err := getLinkInfo(fd, &info); err != nil {
+		return nil, err
+	}
+
+	result := &LinkInfo{
+		ID:        info.ID,
+		Type:      info.Type,
+		ProgramID: ebpf.ProgramID(info.ProgID),
+	}
+
+	// Start with a clean struct for the second call, otherwise we may get EFAULT.
+	var info2 bpfLinkInfo
+	var strBuf []byte
+	var addrsBuf []uint64
+	withString := func(ptrOffset, lenOffset int) {
+		strBuf = make([]byte, stringBufSize)
+		info2.putPtr(ptrOffset, unsafe.Pointer(&strBuf[0]))
+		info2.putU32(lenOffset, stringBufSize)
+	}
+
+	switch info.Type {
+	case RawTracepoint, Iter:
+		withString(0, 8)
+	case PerfEvent:
+		switch PerfEventType(info.u32(0)) {
+		case PerfEventUprobe, PerfEventUretprobe, PerfEventKprobe, PerfEventKretprobe, PerfEventTracepoint:
+			withString(8, 16)
+		}
+	case KprobeMulti:
+		if count := info.u32(8); count > 0 {
+			addrsBuf = make([]uint64, count)
+			info2.putPtr(0, unsafe.Pointer(&addrsBuf[0]))
+			info2.putU32(8, count)
+		}
+	case UprobeMulti:
+		if count := info.u32(36); count > 0 {
+			addrsBuf = make([]uint64, count)
+			info2.putPtr(8, unsafe.Pointer(&addrsBuf[0]))
+			info2.putU32(36, count)
+		}
+		withString(0, 32)
+	}
+
+	if strBuf != nil || addrsBuf != nil {
+		if err := getLinkInfo(fd, &info2); err != nil {
+			return nil, err
+		}
+		runtime.KeepAlive(strBuf)
+		runtime.KeepAlive(addrsBuf)
+		// type-specific fields that are not buffers are filled in the second call as well
+		info = info2
+	}
+
+	str := ""
+	if strBuf != nil {
+		if end := bytes.IndexByte(strBuf, 0); end >= 0 {
+			str = string(strBuf[:end])
+		}
+	}
+
+	switch info.Type {
+	case RawTracepoint:
+		result.TracepointName = str
+	case Tracing:
+		result.AttachType = ebpf.AttachType(info.u32(0))
+		result.TargetObjID = info.u32(4)
+		result.TargetBtfID = info.u32(8)
+	case Cgroup:
+		result.CgroupID = info.u64(0)
+		result.AttachType = ebpf.AttachType(info.u32(8))
+	case Iter:
+		result.IterTarget = str
+		if result.IterTarget == "bpf_map_elem" || result.IterTarget == "bpf_sk_storage_map" {
+			// target_name (u64) and target_name_len (u32) come first
+			result.MapID = ebpf.MapID(info.u32(12))
+		}
+	case NetNs:
+		result.NetnsIno = info.u32(0)
+		result.AttachType = ebpf.AttachType(info.u32(4))
+	case XDP:
+		result.Ifindex = info.u32(0)
+	case PerfEvent:
+		result.PerfEventType = PerfEventType(info.u32(0))
+		switch result.PerfEventType {
+		case PerfEventUprobe, PerfEventUretprobe:
+			result.Path = str
+			result.Offset = uint64(info.u32(20))
+		case PerfEventKprobe, PerfEventKretprobe:
+			result.FuncName = str
+			result.Offset = uint64(info.u32(20))
+			result.Addresses = []uint64{info.u64(24)}
+		case PerfEventTracepoint:
+			result.TracepointName = str
+		}
+	case KprobeMulti:
+		result.Addresses = addrsBuf
+		result.Flags = info.u32(12)
+	case UprobeMulti:
+		result.Path = str
+		result.Offsets = addrsBuf
+		result.Flags = info.u32(40)
+		result.PID = info.u32(44)
+	case StructOps:
+		result.MapID = ebpf.MapID(info.u32(0))
+	case Netfilter:
+		result.NetfilterPf = info.u32(0)
+		result.NetfilterHooknum = info.u32(4)
+		result.NetfilterPriority = int32(info.u32(8))
+		result.Flags = info.u32(12)
+	case TCX, Netkit:
+		result.Ifindex = info.u32(0)
+		result.AttachType = ebpf.AttachType(info.u32(4))
+	case Sockmap:
+		result.MapID = ebpf.MapID(info.u32(0))
+		result.AttachType = ebpf.AttachType(info.u32(4))
+	}
+
+	return result, nil
+}
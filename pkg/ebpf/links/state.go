@@ -0,0 +1,278 @@
+package links
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type LinkInfo struct {
+	ID        LinkID
+	Error     error
+	Type      LinkType
+	ProgramID ebpf.ProgramID
+	// AttachType is set for tracing, cgroup, netns, tcx, netkit and sockmap links
+	AttachType ebpf.AttachType
+
+	// TracepointName is set for raw tracepoint and perf event tracepoint links
+	TracepointName string
+	// TargetObjID and TargetBtfID are set for tracing links (fentry/fexit/...),
+	// TargetObjID is a program ID for links attached to another program (freplace)
+	TargetObjID uint32
+	TargetBtfID uint32
+	CgroupID    uint64
+	IterTarget  string
+	NetnsIno    uint32
+	Ifindex     uint32
+	// MapID is set for iter links over maps, struct_ops and sockmap links
+	MapID ebpf.MapID
+
+	PerfEventType PerfEventType
+	// FuncName is a kernel function name of a kprobe
+	FuncName string
+	// Path is a binary path of an uprobe
+	Path   string
+	Offset uint64
+	// Addresses are kprobe_multi addresses, or a single kprobe address
+	Addresses []uint64
+	// Offsets are uprobe_multi offsets in the binary
+	Offsets []uint64
+	PID     uint32
+	Flags   uint32
+
+	NetfilterPf       uint32
+	NetfilterHooknum  uint32
+	NetfilterPriority int32
+}
+
+// HasAttachType is true for links that report an attach type, note that 0 is a valid one (cgroup_inet_ingress)
+func (li *LinkInfo) HasAttachType() bool {
+	switch li.Type {
+	case Tracing, Cgroup, NetNs, TCX, Netkit, Sockmap:
+		return true
+	}
+	return false
+}
+
+// Ifname returns a name of the link interface in the agent network namespace, if any
+func (li *LinkInfo) Ifname() string {
+	if li.Ifindex == 0 {
+		return ""
+	}
+	iface, err := net.InterfaceByIndex(int(li.Ifindex))
+	if err != nil {
+		return ""
+	}
+	return iface.Name
+}
+
+// Target is a short human-readable description of where the link is attached to
+func (li *LinkInfo) Target() string {
+	switch li.Type {
+	case RawTracepoint:
+		return li.TracepointName
+	case Tracing:
+		if li.TargetObjID != 0 {
+			return fmt.Sprintf("prog %d btf_id %d", li.TargetObjID, li.TargetBtfID)
+		}
+		return fmt.Sprintf("btf_id %d", li.TargetBtfID)
+	case Cgroup:
+		return fmt.Sprintf("cgroup %d", li.CgroupID)
+	case Iter:
+		if li.MapID != 0 {
+			return fmt.Sprintf("%s map %d", li.IterTarget, li.MapID)
+		}
+		return li.IterTarget
+	case NetNs:
+		return fmt.Sprintf("netns %d", li.NetnsIno)
+	case XDP, TCX, Netkit:
+		if li.Ifindex == 0 {
+			return "detached"
+		}
+		if name := li.Ifname(); name != "" {
+			return name
+		}
+		return fmt.Sprintf("ifindex %d", li.Ifindex)
+	case PerfEvent:
+		switch li.PerfEventType {
+		case PerfEventKprobe, PerfEventKretprobe:
+			if li.FuncName == "" && len(li.Addresses) > 0 {
+				return fmt.Sprintf("%#x", li.Addresses[0])
+			}
+			return fmt.Sprintf("%s+%#x", li.FuncName, li.Offset)
+		case PerfEventUprobe, PerfEventUretprobe:
+			return fmt.Sprintf("%s+%#x", li.Path, li.Offset)
+		case PerfEventTracepoint:
+			return li.TracepointName
+		}
+		return li.PerfEventType.String()
+	case KprobeMulti:
+		return fmt.Sprintf("%d functions", len(li.Addresses))
+	case UprobeMulti:
+		return fmt.Sprintf("%s (%d offsets)", li.Path, len(li.Offsets))
+	case StructOps, Sockmap:
+		return fmt.Sprintf("map %d", li.MapID)
+	case Netfilter:
+		return fmt.Sprintf("pf %d hook %d prio %d", li.NetfilterPf, li.NetfilterHooknum, li.NetfilterPriority)
+	}
+	return ""
+}
+
+type LinkWatcher interface {
+	Run(ctx context.Context, refreshInterval time.Duration)
+	GetLinks() ([]*LinkInfo, error)
+	GetLink(id LinkID) (*LinkInfo, error)
+	RegisterMetrics(registry *prometheus.Registry)
+	PinLink(id LinkID, path string) error
+	// DetachLink detaches a link from its attachment point, the link object exists while it's referenced
+	DetachLink(id LinkID) error
+}
+
+type linkWatcher struct {
+	log zerolog.Logger
+	// mu guards results of the last fetch, they are replaced by the watcher and after mutations while queries read them
+	mu         sync.RWMutex
+	links      []*LinkInfo
+	error      error
+	isRunning  bool
+	linksCount *prometheus.GaugeVec
+}
+
+func NewWatcher(logger zerolog.Logger) LinkWatcher {
+	linksCount := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "link_count",
+		Help:      "Number of eBPF links",
+	}, []string{"type"})
+
+	return &linkWatcher{
+		log:        logger,
+		linksCount: linksCount,
+	}
+}
+
+func (lw *linkWatcher) RegisterMetrics(registry *prometheus.Registry) {
+	err := registry.Register(lw.linksCount)
+	if err != nil {
+		lw.log.Err(err).Msg("failed to register link_count metric")
+	}
+}
+
+func (lw *linkWatcher) Run(ctx context.Context, refreshInterval time.Duration) {
+	if lw.isRunning {
+		return
+	}
+	go func() {
+		lw.isRunning = true
+		ticker := time.NewTicker(refreshInterval)
+		for {
+			select {
+			case <-ticker.C:
+				lw.refreshLinks()
+			case <-ctx.Done():
+				lw.isRunning = false
+				return
+			}
+		}
+	}()
+}
+
+func (lw *linkWatcher) GetLinks() ([]*LinkInfo, error) {
+	lw.mu.RLock()
+	links, err := lw.links, lw.error
+	lw.mu.RUnlock()
+	if links == nil {
+		return lw.fetchLinks()
+	}
+	return links, err
+}
+
+func (lw *linkWatcher) refreshLinks() {
+	links, err := lw.fetchLinks()
+	lw.mu.Lock()
+	lw.links, lw.error = links, err
+	lw.mu.Unlock()
+}
+
+func (lw *linkWatcher) GetLink(id LinkID) (*LinkInfo, error) {
+	links, err := lw.GetLinks()
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		if link.ID == id {
+			return link, nil
+		}
+	}
+	return nil, errors.New("link not found")
+}
+
+func (lw *linkWatcher) PinLink(id LinkID, path string) error {
+	fd, err := NewLinkFDFromID(id)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	if err := util.ObjPin(fd, path); err != nil {
+		return err
+	}
+	lw.refreshLinks()
+	return nil
+}
+
+func (lw *linkWatcher) DetachLink(id LinkID) error {
+	fd, err := NewLinkFDFromID(id)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	if err := linkDetach(fd); err != nil {
+		return err
+	}
+	lw.refreshLinks()
+	return nil
+}
+
+func (lw *linkWatcher) fetchLinks() ([]*LinkInfo, error) {
+	var currID LinkID = 0
+	var err error
+	links := []*LinkInfo{}
+	lw.log.Debug().Msg("fetching links")
+
+	linksCount := map[LinkType]uint64{}
+	defer func() {
+		lw.linksCount.Reset()
+		for linkType, count := range linksCount {
+			lw.linksCount.WithLabelValues(linkType.String()).Set(float64(count))
+		}
+	}()
+
+	for {
+		currID, err = linkGetNextID(currID)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			lw.log.Err(err).Msg("failed to get next link ID")
+			return links, err
+		}
+		info, err2 := fetchLinkInfo(currID)
+		if err2 != nil {
+			links = append(links, &LinkInfo{ID: currID, Error: err2})
+			continue
+		}
+		linksCount[info.Type]++
+		links = append(links, info)
+	}
+	return links, nil
+}
@@ -0,0 +1,70 @@
+package links
+
+import "github.com/cilium/ebpf"
+
+//go:generate stringer -output types_string.go -type=LinkType,PerfEventType
+
+// LinkType mirrors enum bpf_link_type
+type LinkType uint32
+
+const (
+	Unspec LinkType = iota
+	RawTracepoint
+	Tracing
+	Cgroup
+	Iter
+	NetNs
+	XDP
+	PerfEvent
+	KprobeMulti
+	StructOps
+	Netfilter
+	TCX
+	UprobeMulti
+	Netkit
+	Sockmap
+)
+
+// PerfEventType mirrors enum bpf_perf_event_type
+type PerfEventType uint32
+
+const (
+	PerfEventUnspec PerfEventType = iota
+	PerfEventUprobe
+	PerfEventUretprobe
+	PerfEventKprobe
+	PerfEventKretprobe
+	PerfEventTracepoint
+	PerfEventEvent
+)
+
+// attach types that are newer than the ones known by cilium/ebpf
+var extraAttachTypeNames = map[ebpf.AttachType]string{
+	43: "LSMCgroup",
+	44: "StructOps",
+	45: "Netfilter",
+	46: "TCXIngress",
+	47: "TCXEgress",
+	48: "TraceUprobeMulti",
+	49: "CGroupUnixConnect",
+	50: "CGroupUnixSendmsg",
+	51: "CGroupUnixRecvmsg",
+	52: "CGroupUnixGetpeername",
+	53: "CGroupUnixGetsockname",
+	54: "NetkitPrimary",
+	55: "NetkitPeer",
+	56: "TraceKprobeSession",
+	57: "TraceUprobeSession",
+}
+
+// AttachTypeName names an attach type like ebpf.AttachType.String does,
+// except that 0 is reported as CGroupInetIngress rather than None
+func AttachTypeName(attachType ebpf.AttachType) string {
+	if attachType == ebpf.AttachCGroupInetIngress {
+		return "CGroupInetIngress"
+	}
+	if name, ok := extraAttachTypeNames[attachType]; ok {
+		return name
+	}
+	return attachType.String()
+}
@@ -0,0 +1,60 @@
+// Code generated by "stringer -output types_string.go -type=LinkType,PerfEventType"; DO NOT EDIT.
+
+package links
+
+import "strconv"
+
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[Unspec-0]
+	_ = x[RawTracepoint-1]
+	_ = x[Tracing-2]
+	_ = x[Cgroup-3]
+	_ = x[Iter-4]
+	_ = x[NetNs-5]
+	_ = x[XDP-6]
+	_ = x[PerfEvent-7]
+	_ = x[KprobeMulti-8]
+	_ = x[StructOps-9]
+	_ = x[Netfilter-10]
+	_ = x[TCX-11]
+	_ = x[UprobeMulti-12]
+	_ = x[Netkit-13]
+	_ = x[Sockmap-14]
+}
+
+const _LinkType_name = "UnspecRawTracepointTracingCgroupIterNetNsXDPPerfEventKprobeMultiStructOpsNetfilterTCXUprobeMultiNetkitSockmap"
+
+var _LinkType_index = [...]uint8{0, 6, 19, 26, 32, 36, 41, 44, 53, 64, 73, 82, 85, 96, 102, 109}
+
+func (i LinkType) String() string {
+	if i >= LinkType(len(_LinkType_index)-1) {
+		return "LinkType(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _LinkType_name[_LinkType_index[i]:_LinkType_index[i+1]]
+}
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[PerfEventUnspec-0]
+	_ = x[PerfEventUprobe-1]
+	_ = x[PerfEventUretprobe-2]
+	_ = x[PerfEventKprobe-3]
+	_ = x[PerfEventKretprobe-4]
+	_ = x[PerfEventTracepoint-5]
+	_ = x[PerfEventEvent-6]
+}
+
+const _PerfEventType_name = "PerfEventUnspecPerfEventUprobePerfEventUretprobePerfEventKprobePerfEventKretprobePerfEventTracepointPerfEventEvent"
+
+var _PerfEventType_index = [...]uint8{0, 15, 30, 48, 63, 81, 100, 114}
+
+func (i PerfEventType) String() string {
+	if i >= PerfEventType(len(_PerfEventType_index)-1) {
+		return "PerfEventType(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _PerfEventType_name[_PerfEventType_index[i]:_PerfEventType_index[i+1]]
+}
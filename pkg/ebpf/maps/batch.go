@@ -0,0 +1,378 @@
+package maps
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"reflect"
+)
+
+type OpKind string
+
+const (
+	// OpCreate adds an entry, it fails with OpExists if the key is already there
+	OpCreate OpKind = "create"
+	// OpUpdate sets a value regardless of whether the key exists, or a single CPU slot of a per-CPU value
+	OpUpdate OpKind = "update"
+	OpDelete OpKind = "delete"
+)
+
+type OpStatus string
+
+const (
+	OpOK       OpStatus = "ok"
+	OpNotFound OpStatus = "not_found"
+	OpExists   OpStatus = "exists"
+	OpFailed   OpStatus = "error"
+	// OpSkipped ops were not attempted, because an earlier op failed and the batch stops on errors
+	OpSkipped OpStatus = "skipped"
+)
+
+// Op is a single write to a map, keys and values are in formats given by BatchOptions
+type Op struct {
+	Kind OpKind
+	Key  string
+	// Values holds a single value, or a value per CPU for OpCreate in per-CPU maps
+	Values []string
+	// CPU selects a slot of a per-CPU value for OpUpdate
+	CPU *int
+}
+
+type OpResult struct {
+	Status OpStatus
+	Err    error
+	// RolledBack is set if the op was applied, but its key was restored to the previous value afterwards
+	RolledBack bool
+}
+
+type BatchOptions struct {
+	KeyFormat   DisplayFormat
+	ValueFormat DisplayFormat
+	// StopOnError skips ops after the first failed one, otherwise the rest are still applied
+	StopOnError bool
+	// Rollback restores previous values of keys changed by the batch if any op fails
+	Rollback bool
+}
+
+type BatchResult struct {
+	// Results are in the order of ops
+	Results []*OpResult
+	Failed  int
+	// Batched is a number of ops applied with batch syscalls (kernel 5.6+, hash maps without per-CPU values)
+	Batched    int
+	RolledBack bool
+	// RollbackErr is set if some keys couldn't be restored, rollback is best-effort:
+	// changes made by programs in between are overwritten, and a failure leaves the rest restored
+	RollbackErr error
+}
+
+type parsedOp struct {
+	*Op
+	key []byte
+	// value is []byte, or [][]byte for creation of per-CPU values
+	value interface{}
+}
+
+type snapshot struct {
+	key []byte
+	// value is nil if the key didn't exist
+	value interface{}
+}
+
+// ApplyMapOps applies writes to a map in order, consecutive updates or deletes are sent with batch syscalls
+// where the kernel supports them. The error is returned only if the batch can't be started at all,
+// failures of single ops are reported in results.
+func (pw *mapsWatcher) ApplyMapOps(id ebpf.MapID, ops []*Op, opts *BatchOptions) (*BatchResult, error) {
+	emap, err := ebpf.NewMapFromID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer emap.Close()
+	if err := checkWritable(emap); err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{Results: make([]*OpResult, len(ops))}
+	parsed := make([]*parsedOp, len(ops))
+	for i, op := range ops {
+		parsed[i], err = parseOp(emap, op, opts)
+		if err != nil {
+			result.Results[i] = &OpResult{Status: OpFailed, Err: err}
+			result.Failed++
+		}
+	}
+	// ops are validated before anything is changed, so an invalid batch is not applied partially
+	if result.Failed > 0 && opts.StopOnError {
+		for i := range result.Results {
+			if result.Results[i] == nil {
+				result.Results[i] = &OpResult{Status: OpSkipped}
+			}
+		}
+		return result, nil
+	}
+
+	var snapshots []*snapshot
+	if opts.Rollback {
+		if snapshots, err = takeSnapshots(emap, parsed); err != nil {
+			return nil, err
+		}
+	}
+
+	recorder := newOpRecorder(emap)
+	batchSupported := true
+	for i := 0; i < len(parsed); {
+		if parsed[i] == nil {
+			i++
+			continue
+		}
+		if result.Failed > 0 && opts.StopOnError {
+			result.Results[i] = &OpResult{Status: OpSkipped}
+			i++
+			continue
+		}
+		end := batchEnd(emap, parsed, i)
+		if batchSupported && end-i > 1 {
+			recorder.before(parsed[i:end])
+			n, err := applyBatch(emap, parsed[i:end])
+			// the kernel doesn't report a count if it rejects the batch as a whole, e.g. for old kernels
+			// or map types without batch ops, single ops are used then
+			if err != nil && (n == 0 && errors.Is(err, ebpf.ErrNotSupported) || n >= end-i) {
+				batchSupported = false
+				continue
+			}
+			for j := i; j < i+n; j++ {
+				result.Results[j] = &OpResult{Status: OpOK}
+				recorder.after(j, parsed[j])
+			}
+			result.Batched += n
+			if err == nil {
+				i = end
+				continue
+			}
+			// the kernel stops at the first failed element
+			i += n
+			result.Results[i] = opResult(err)
+			result.Failed++
+			i++
+			continue
+		}
+		recorder.before(parsed[i : i+1])
+		result.Results[i] = opResult(applyOp(emap, parsed[i]))
+		if result.Results[i].Err != nil {
+			result.Failed++
+		} else {
+			recorder.after(i, parsed[i])
+		}
+		i++
+	}
+
+	if opts.Rollback && result.Failed > 0 {
+		rollback(emap, parsed, snapshots, result)
+	}
+	var mutations []*Mutation
+	for i, opResult := range result.Results {
+		if mutation := recorder.mutations[i]; mutation != nil && !opResult.RolledBack {
+			mutations = append(mutations, mutation)
+		}
+	}
+	pw.recordMutations(emap, id, mutations)
+	return result, nil
+}
+
+// applyOne applies a single op, returning its error as is
+func (pw *mapsWatcher) applyOne(id ebpf.MapID, op *Op, keyFormat DisplayFormat, valueFormat DisplayFormat) error {
+	result, err := pw.ApplyMapOps(id, []*Op{op}, &BatchOptions{KeyFormat: keyFormat, ValueFormat: valueFormat})
+	if err != nil {
+		return err
+	}
+	return result.Results[0].Err
+}
+
+func parseOp(emap *ebpf.Map, op *Op, opts *BatchOptions) (*parsedOp, error) {
+	key, err := RestoreBytes(opts.KeyFormat, op.Key, emap.KeySize())
+	if err != nil {
+		return nil, err
+	}
+	result := &parsedOp{Op: op, key: key}
+	perCPU := IsPerCPU(emap.Type())
+	switch op.Kind {
+	case OpDelete:
+		return result, nil
+	case OpCreate:
+		if !perCPU && len(op.Values) != 1 {
+			return nil, errors.New("map is not percpu, but multiple values were provided")
+		}
+		if len(op.Values) == 0 {
+			return nil, errors.New("no values provided")
+		}
+		values := make([][]byte, len(op.Values))
+		for i, value := range op.Values {
+			if values[i], err = RestoreBytes(opts.ValueFormat, value, emap.ValueSize()); err != nil {
+				return nil, err
+			}
+		}
+		if perCPU {
+			result.value = values
+		} else {
+			result.value = values[0]
+		}
+		return result, nil
+	case OpUpdate:
+		if len(op.Values) != 1 {
+			return nil, errors.New("update takes a single value")
+		}
+		if perCPU && op.CPU == nil {
+			return nil, errors.New("cpu index is required for percpu maps")
+		}
+		if !perCPU && op.CPU != nil {
+			return nil, errors.New("cpu index is only applicable to percpu maps")
+		}
+		if result.value, err = RestoreBytes(opts.ValueFormat, op.Values[0], emap.ValueSize()); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unknown operation %s", op.Kind)
+}
+
+// batchEnd returns the end of a run of ops starting at start, which can be sent with a single batch syscall.
+// Batch updates don't take BPF_NOEXIST, so creates are applied one by one.
+func batchEnd(emap *ebpf.Map, ops []*parsedOp, start int) int {
+	if IsPerCPU(emap.Type()) || ops[start].Kind == OpCreate {
+		return start + 1
+	}
+	end := start + 1
+	for end < len(ops) && ops[end] != nil && ops[end].Kind == ops[start].Kind {
+		end++
+	}
+	return end
+}
+
+func applyBatch(emap *ebpf.Map, ops []*parsedOp) (int, error) {
+	keys := fixedSizeSlice(int(emap.KeySize()), len(ops))
+	values := fixedSizeSlice(int(emap.ValueSize()), len(ops))
+	for i, op := range ops {
+		reflect.Copy(keys.Index(i), reflect.ValueOf(op.key))
+		if op.Kind != OpDelete {
+			reflect.Copy(values.Index(i), reflect.ValueOf(op.value))
+		}
+	}
+	if ops[0].Kind == OpDelete {
+		return emap.BatchDelete(keys.Interface(), nil)
+	}
+	return emap.BatchUpdate(keys.Interface(), values.Interface(), nil)
+}
+
+// fixedSizeSlice makes a slice of [size]byte arrays, batch syscalls take the number of elements from its length
+func fixedSizeSlice(size int, count int) reflect.Value {
+	return reflect.MakeSlice(reflect.SliceOf(reflect.ArrayOf(size, reflect.TypeOf(byte(0)))), count, count)
+}
+
+func applyOp(emap *ebpf.Map, op *parsedOp) error {
+	switch {
+	case op.Kind == OpDelete:
+		return emap.Delete(op.key)
+	case op.Kind == OpCreate:
+		return emap.Update(op.key, op.value, ebpf.UpdateNoExist)
+	case op.CPU == nil:
+		return emap.Update(op.key, op.value, ebpf.UpdateAny)
+	}
+	var current [][]byte
+	if err := emap.Lookup(op.key, &current); err != nil {
+		return err
+	}
+	if *op.CPU < 0 || len(current) <= *op.CPU {
+		return errors.New("cpu index out of range")
+	}
+	current[*op.CPU] = op.value.([]byte)
+	return emap.Update(op.key, current, ebpf.UpdateAny)
+}
+
+func opResult(err error) *OpResult {
+	switch {
+	case err == nil:
+		return &OpResult{Status: OpOK}
+	case errors.Is(err, ebpf.ErrKeyNotExist):
+		return &OpResult{Status: OpNotFound, Err: err}
+	case errors.Is(err, ebpf.ErrKeyExist):
+		return &OpResult{Status: OpExists, Err: err}
+	}
+	return &OpResult{Status: OpFailed, Err: err}
+}
+
+// takeSnapshots reads current values of keys touched by ops, once per key
+func takeSnapshots(emap *ebpf.Map, ops []*parsedOp) ([]*snapshot, error) {
+	var result []*snapshot
+	seen := make(map[string]bool)
+	for _, op := range ops {
+		if op == nil || seen[string(op.key)] {
+			continue
+		}
+		seen[string(op.key)] = true
+		value, err := lookupValue(emap, op.key)
+		if err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return nil, fmt.Errorf("can't read %x for rollback: %w", op.key, err)
+		}
+		result = append(result, &snapshot{key: op.key, value: value})
+	}
+	return result, nil
+}
+
+// lookupValue reads a value as []byte, or [][]byte for per-CPU maps
+func lookupValue(emap *ebpf.Map, key []byte) (interface{}, error) {
+	if IsPerCPU(emap.Type()) {
+		var value [][]byte
+		if err := emap.Lookup(key, &value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	var value []byte
+	if err := emap.Lookup(key, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// rollback restores keys changed by successful ops to their snapshots
+func rollback(emap *ebpf.Map, ops []*parsedOp, snapshots []*snapshot, result *BatchResult) {
+	changed := make(map[string]bool)
+	for i, op := range ops {
+		if result.Results[i].Status == OpOK {
+			changed[string(op.key)] = true
+		}
+	}
+	restored := make(map[string]bool)
+	failures := 0
+	for _, snap := range snapshots {
+		if !changed[string(snap.key)] {
+			continue
+		}
+		var err error
+		if snap.value == nil {
+			err = emap.Delete(snap.key)
+			if errors.Is(err, ebpf.ErrKeyNotExist) {
+				err = nil
+			}
+		} else {
+			err = emap.Update(snap.key, snap.value, ebpf.UpdateAny)
+		}
+		if err != nil {
+			if result.RollbackErr == nil {
+				result.RollbackErr = fmt.Errorf("can't restore %x: %w", snap.key, err)
+			}
+			failures++
+			continue
+		}
+		restored[string(snap.key)] = true
+	}
+	if failures > 1 {
+		result.RollbackErr = fmt.Errorf("%w (and %d more keys)", result.RollbackErr, failures-1)
+	}
+	for i, op := range ops {
+		if result.Results[i].Status == OpOK && restored[string(op.key)] {
+			result.Results[i].RolledBack = true
+			result.RolledBack = true
+		}
+	}
+}
@@ -43,3 +43,20 @@ func IsLookupSupported(mt ebpf.MapType) bool {
 	supported, ok := lookupSupported[mt]
 	return ok && supported
 }
+
+// capacityLimited are map types that fail (or evict, for LRU maps) on inserts once they have MaxEntries entries,
+// unlike arrays which always have all of their entries
+var capacityLimited = map[ebpf.MapType]bool{
+	ebpf.Hash:       true,
+	ebpf.PerCPUHash: true,
+	ebpf.LRUHash:    true,
+	ebpf.LRUCPUHash: true,
+	ebpf.LPMTrie:    true,
+	ebpf.HashOfMaps: true,
+	ebpf.SockHash:   true,
+	ebpf.DevMapHash: true,
+}
+
+func IsCapacityLimited(mt ebpf.MapType) bool {
+	return capacityLimited[mt]
+}
@@ -0,0 +1,192 @@
+package maps
+
+import (
+	"errors"
+	"github.com/cilium/ebpf"
+	"os"
+	"strconv"
+	"time"
+)
+
+// maxCapacitySamples is how many counts of a map are kept to estimate its growth rate
+const maxCapacitySamples = 30
+
+type CapacitySample struct {
+	Time    time.Time
+	Entries uint32
+}
+
+// Capacity tells how full a map is and how fast it fills up
+type Capacity struct {
+	Entries    uint32
+	MaxEntries uint32
+	FillRatio  float64
+	// GrowthRate is entries per second over the kept samples, it's negative if the map shrinks
+	GrowthRate float64
+	// TimeToFull is an estimate of when the map reaches MaxEntries at the current growth rate,
+	// it's nil if the map doesn't grow
+	TimeToFull *time.Duration
+	Samples    []CapacitySample
+}
+
+type capacityState struct {
+	maxEntries uint32
+	samples    []CapacitySample
+	// counting is set while keys are counted in the background, so counts of a map don't overlap
+	counting bool
+}
+
+func (pw *mapsWatcher) AddCapacityConfig(config *MapCapacityConfiguration) {
+	pw.capacityConfigs = append(pw.capacityConfigs, config)
+}
+
+// GetCapacity returns capacity of a tracked map, or nil if the map is not tracked or not counted yet
+func (pw *mapsWatcher) GetCapacity(id ebpf.MapID) *Capacity {
+	pw.capacityMu.Lock()
+	defer pw.capacityMu.Unlock()
+	state, ok := pw.capacity[id]
+	if !ok || len(state.samples) == 0 {
+		return nil
+	}
+	last := state.samples[len(state.samples)-1]
+	result := &Capacity{
+		Entries:    last.Entries,
+		MaxEntries: state.maxEntries,
+		GrowthRate: growthRate(state.samples),
+		Samples:    append([]CapacitySample(nil), state.samples...),
+	}
+	if state.maxEntries > 0 {
+		result.FillRatio = float64(last.Entries) / float64(state.maxEntries)
+	}
+	if result.GrowthRate > 0 && last.Entries < state.maxEntries {
+		remaining := float64(state.maxEntries-last.Entries) / result.GrowthRate
+		timeToFull := time.Duration(remaining * float64(time.Second))
+		result.TimeToFull = &timeToFull
+	}
+	return result
+}
+
+// trackCapacity counts entries of the map if it's configured for tracking and it's time to count it again;
+// keys are counted in the background, as large maps take a syscall per entry and would stall the refresh
+func (pw *mapsWatcher) trackCapacity(emap *ebpf.Map, id ebpf.MapID, name string, seen map[ebpf.MapID]bool) {
+	if !IsCapacityLimited(emap.Type()) {
+		return
+	}
+	var config *MapCapacityConfiguration
+	for _, candidate := range pw.capacityConfigs {
+		if candidate.MatchMap(id, name) {
+			config = candidate
+			break
+		}
+	}
+	if config == nil || config.Interval <= 0 {
+		return
+	}
+	seen[id] = true
+
+	pw.capacityMu.Lock()
+	state, ok := pw.capacity[id]
+	if !ok {
+		state = &capacityState{maxEntries: emap.MaxEntries()}
+		pw.capacity[id] = state
+	}
+	due := !state.counting && (len(state.samples) == 0 || time.Since(state.samples[len(state.samples)-1].Time) >= config.Interval)
+	if !due {
+		pw.capacityMu.Unlock()
+		return
+	}
+	// the map is closed by the refresh, the clone is kept for counting
+	counted, err := emap.Clone()
+	if err != nil {
+		pw.capacityMu.Unlock()
+		pw.log.Debug().Err(err).Msgf("failed to count entries of map %d", id)
+		return
+	}
+	state.counting = true
+	pw.capacityMu.Unlock()
+
+	go func() {
+		defer counted.Close()
+		entries, err := countKeys(counted)
+		pw.capacityMu.Lock()
+		defer pw.capacityMu.Unlock()
+		state.counting = false
+		if err != nil {
+			pw.log.Debug().Err(err).Msgf("failed to count entries of map %d", id)
+			return
+		}
+		if pw.capacity[id] != state {
+			// the map is gone or not tracked anymore, its series are deleted already
+			return
+		}
+		state.samples = append(state.samples, CapacitySample{Time: time.Now(), Entries: entries})
+		if len(state.samples) > maxCapacitySamples {
+			state.samples = state.samples[len(state.samples)-maxCapacitySamples:]
+		}
+
+		labels := []string{strconv.Itoa(int(id)), name, counted.Type().String()}
+		pw.mapEntriesCount.WithLabelValues(labels...).Set(float64(entries))
+		if state.maxEntries > 0 {
+			pw.mapFillRatio.WithLabelValues(labels...).Set(float64(entries) / float64(state.maxEntries))
+		}
+	}()
+}
+
+// forgetCapacity drops samples and metrics of maps that are gone or no longer tracked
+func (pw *mapsWatcher) forgetCapacity(seen map[ebpf.MapID]bool) {
+	pw.capacityMu.Lock()
+	defer pw.capacityMu.Unlock()
+	for id := range pw.capacity {
+		if !seen[id] {
+			delete(pw.capacity, id)
+			// entry counts of maps which are still exported are set again by the export
+			labels := map[string]string{"id": strconv.Itoa(int(id))}
+			pw.mapFillRatio.DeletePartialMatch(labels)
+			pw.mapEntriesCount.DeletePartialMatch(labels)
+		}
+	}
+}
+
+// countKeys counts entries by iterating keys only, it's cheaper than reading entries with their values
+func countKeys(emap *ebpf.Map) (uint32, error) {
+	var count uint32
+	key := make([]byte, emap.KeySize())
+	nextKey := make([]byte, emap.KeySize())
+	var prevKey interface{}
+	// hash maps restart iteration if the previous key is deleted meanwhile, so the count is capped
+	for count < emap.MaxEntries() {
+		if err := emap.NextKey(prevKey, &nextKey); err != nil {
+			if errors.Is(err, ebpf.ErrKeyNotExist) || errors.Is(err, os.ErrNotExist) {
+				return count, nil
+			}
+			return count, err
+		}
+		count++
+		copy(key, nextKey)
+		prevKey = key
+	}
+	return count, nil
+}
+
+// growthRate is a least squares slope of entries over time, in entries per second
+func growthRate(samples []CapacitySample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	start := samples[0].Time
+	var sumT, sumE, sumTT, sumTE float64
+	for _, sample := range samples {
+		t := sample.Time.Sub(start).Seconds()
+		e := float64(sample.Entries)
+		sumT += t
+		sumE += e
+		sumTT += t * t
+		sumTE += t * e
+	}
+	n := float64(len(samples))
+	denominator := n*sumTT - sumT*sumT
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumTE - sumT*sumE) / denominator
+}
@@ -0,0 +1,60 @@
+package maps
+
+import (
+	"fmt"
+	"github.com/cilium/ebpf"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MapCapacityConfiguration selects maps which entries are counted to track how full they are
+type MapCapacityConfiguration struct {
+	StartID    int
+	EndID      int
+	NameRegexp regexp.Regexp
+	// Interval between counts of a map, maps are not counted more often than they are refreshed;
+	// 0 disables tracking of matching maps
+	Interval time.Duration
+}
+
+func (c *MapCapacityConfiguration) MatchMap(id ebpf.MapID, name string) bool {
+	if c.StartID >= 0 && int(id) < c.StartID {
+		return false
+	}
+	if c.EndID >= 0 && int(id) > c.EndID {
+		return false
+	}
+	return c.NameRegexp.MatchString(name)
+}
+
+func ParseMapCapacityConfiguration(config string) (*MapCapacityConfiguration, error) {
+	parts := strings.Split(config, ":")
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("invalid format: %s, should be <id_start?>-<id_end?>:<name_regexp>:<interval>", config)
+	}
+
+	rangeStr := parts[0]
+	interval := parts[len(parts)-1]
+	nameRegexp := strings.Join(parts[1:len(parts)-1], ":")
+
+	idStart, idEnd, err := parseRange(rangeStr)
+	if err != nil {
+		return nil, err
+	}
+	nameRegexpCompiled, err := regexp.Compile(nameRegexp)
+	if err != nil {
+		return nil, err
+	}
+	intervalParsed, err := time.ParseDuration(interval)
+	if err != nil {
+		return nil, fmt.Errorf("interval is invalid: %w", err)
+	}
+
+	return &MapCapacityConfiguration{
+		StartID:    idStart,
+		EndID:      idEnd,
+		NameRegexp: *nameRegexpCompiled,
+		Interval:   intervalParsed,
+	}, nil
+}
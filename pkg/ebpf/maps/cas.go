@@ -0,0 +1,280 @@
+package maps
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/btfs"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"time"
+)
+
+// ErrConflict is returned when a value keeps changing between reads, so it can't be changed consistently
+var ErrConflict = errors.New("value was changed concurrently")
+
+// ValueTarget selects the part of a value which is compared or incremented
+type ValueTarget struct {
+	// CPU selects a slot of a per-CPU value, all slots are targeted if it's nil
+	CPU *int
+	// Field is a path of a field in the BTF type of values, e.g. stats.packets or slots[2].tokens,
+	// the whole value is targeted if it's empty
+	Field string
+	// Retries is how many times the value is read again if it changes while being modified
+	Retries int
+}
+
+// ValueChange is a result of compare-and-set or increment. Userspace has no atomic operations on map values:
+// a value is read, checked by reading it again, and written back, so changes made by programs
+// between the last read and the write are lost.
+type ValueChange struct {
+	// Swapped is false if compare-and-set found a value different from the expected one
+	Swapped  bool
+	Attempts int
+	// Values are the targeted parts of the value, one per targeted CPU, after the change or as found if not swapped
+	Values [][]byte
+	// Window is the time from the last read to the end of the write
+	Window time.Duration
+	// Type is BTF type of the targeted part, it's nil if the map has no BTF
+	Type btf.Type
+}
+
+type targetField struct {
+	offset uint32
+	size   uint32
+	// typ is nil if the map has no BTF
+	typ btf.Type
+}
+
+// CompareAndSetMapValue writes value (of the target) only if it's equal to expected
+func (pw *mapsWatcher) CompareAndSetMapValue(id ebpf.MapID, key string, expected string, value string, target *ValueTarget, keyFormat DisplayFormat, valueFormat DisplayFormat) (*ValueChange, error) {
+	var expectedBytes, valueBytes []byte
+	return pw.modifyValue(id, key, target, keyFormat, MutationCompareAndSet, func(field *targetField) error {
+		var err error
+		if expectedBytes, err = RestoreBytes(valueFormat, expected, field.size); err != nil {
+			return fmt.Errorf("expected value: %w", err)
+		}
+		if valueBytes, err = RestoreBytes(valueFormat, value, field.size); err != nil {
+			return fmt.Errorf("new value: %w", err)
+		}
+		return nil
+	}, func(current []byte) ([]byte, bool) {
+		if !bytes.Equal(current, expectedBytes) {
+			return nil, false
+		}
+		return valueBytes, true
+	})
+}
+
+// IncrementMapValue adds delta to an integer value (of the target), negative delta decrements it;
+// the result wraps around like in C
+func (pw *mapsWatcher) IncrementMapValue(id ebpf.MapID, key string, delta int64, target *ValueTarget, keyFormat DisplayFormat) (*ValueChange, error) {
+	return pw.modifyValue(id, key, target, keyFormat, MutationIncrement, checkInteger, func(current []byte) ([]byte, bool) {
+		return addInt(current, delta), true
+	})
+}
+
+// addInt adds delta to an integer of the host byte order, its width is checked by checkInteger;
+// the sign doesn't matter, as both wrap around the same way
+func addInt(data []byte, delta int64) []byte {
+	endian := util.GetEndian()
+	result := make([]byte, len(data))
+	switch len(data) {
+	case 1:
+		result[0] = data[0] + uint8(delta)
+	case 2:
+		endian.PutUint16(result, endian.Uint16(data)+uint16(delta))
+	case 4:
+		endian.PutUint32(result, endian.Uint32(data)+uint32(delta))
+	default:
+		endian.PutUint64(result, endian.Uint64(data)+uint64(delta))
+	}
+	return result
+}
+
+// modifyValue does a read-modify-write of the target part of a value, prepare validates the target
+// before anything is read, and modify returns the new part or false to leave the value as is
+func (pw *mapsWatcher) modifyValue(
+	id ebpf.MapID,
+	key string,
+	target *ValueTarget,
+	keyFormat DisplayFormat,
+	kind string,
+	prepare func(field *targetField) error,
+	modify func(current []byte) ([]byte, bool),
+) (*ValueChange, error) {
+	emap, err := ebpf.NewMapFromID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer emap.Close()
+	if err := checkWritable(emap); err != nil {
+		return nil, err
+	}
+	if target.CPU != nil && !IsPerCPU(emap.Type()) {
+		return nil, errors.New("cpu index is only applicable to percpu maps")
+	}
+	keyBytes, err := RestoreBytes(keyFormat, key, emap.KeySize())
+	if err != nil {
+		return nil, err
+	}
+	field, err := resolveTarget(emap, target.Field)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepare(field); err != nil {
+		return nil, err
+	}
+
+	result := &ValueChange{Type: field.typ}
+	for {
+		result.Attempts++
+		slots, err := lookupSlots(emap, keyBytes)
+		if err != nil {
+			return nil, err
+		}
+		targeted, err := targetedSlots(slots, target.CPU)
+		if err != nil {
+			return nil, err
+		}
+		original := copySlots(slots)
+
+		result.Values = make([][]byte, 0, len(targeted))
+		for _, slot := range targeted {
+			current := slots[slot][field.offset : field.offset+field.size]
+			changed, ok := modify(current)
+			if !ok {
+				result.Values = nil
+				for _, slot := range targeted {
+					result.Values = append(result.Values, original[slot][field.offset:field.offset+field.size])
+				}
+				return result, nil
+			}
+			copy(current, changed)
+			result.Values = append(result.Values, changed)
+		}
+
+		// the value is read again right before the write to narrow the window in which changes of programs are lost
+		start := time.Now()
+		check, err := lookupSlots(emap, keyBytes)
+		if err != nil {
+			return nil, err
+		}
+		if !equalSlots(check, original) {
+			if result.Attempts > target.Retries {
+				return result, fmt.Errorf("%w, gave up after %d attempts", ErrConflict, result.Attempts)
+			}
+			continue
+		}
+		if IsPerCPU(emap.Type()) {
+			err = emap.Update(keyBytes, slots, ebpf.UpdateExist)
+		} else {
+			err = emap.Update(keyBytes, slots[0], ebpf.UpdateExist)
+		}
+		result.Window = time.Since(start)
+		if err != nil {
+			return nil, err
+		}
+		result.Swapped = true
+		pw.recordMutations(emap, id, []*Mutation{{
+			Time:     time.Now(),
+			Kind:     kind,
+			Key:      keyBytes,
+			Previous: original,
+			Written:  slots,
+		}})
+		return result, nil
+	}
+}
+
+// checkInteger tells if the target is a counter, which can be incremented or reset
+func checkInteger(field *targetField) error {
+	if field.typ != nil {
+		switch t := btf.UnderlyingType(field.typ).(type) {
+		case *btf.Int:
+			if t.Encoding == btf.Bool {
+				return errors.New("booleans are not counters")
+			}
+		case *btf.Enum:
+		default:
+			return fmt.Errorf("only integers are counters, it's %s", btfs.Kind(t))
+		}
+	}
+	if field.size != 1 && field.size != 2 && field.size != 4 && field.size != 8 {
+		return fmt.Errorf("only 1, 2, 4 and 8-byte integers are counters, it's %d bytes", field.size)
+	}
+	return nil
+}
+
+// resolveTarget finds offset and size of a field path, or the whole value if path is empty
+func resolveTarget(emap *ebpf.Map, path string) (*targetField, error) {
+	typ, err := valueType(emap)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return &targetField{size: emap.ValueSize(), typ: typ}, nil
+	}
+	if typ == nil {
+		return nil, errors.New("map has no BTF, fields can't be resolved")
+	}
+	fieldType, offset, err := btfs.FieldAt(typ, path)
+	if err != nil {
+		return nil, err
+	}
+	size, err := btf.Sizeof(fieldType)
+	if err != nil {
+		return nil, err
+	}
+	if offset+uint32(size) > emap.ValueSize() {
+		return nil, fmt.Errorf("field %s is out of the value", path)
+	}
+	return &targetField{offset: offset, size: uint32(size), typ: fieldType}, nil
+}
+
+// lookupSlots reads a value as slots, one per CPU for per-CPU maps
+func lookupSlots(emap *ebpf.Map, key []byte) ([][]byte, error) {
+	value, err := lookupValue(emap, key)
+	if err != nil {
+		return nil, err
+	}
+	if slots, ok := value.([][]byte); ok {
+		return slots, nil
+	}
+	return [][]byte{value.([]byte)}, nil
+}
+
+func targetedSlots(slots [][]byte, cpu *int) ([]int, error) {
+	if cpu != nil {
+		if *cpu < 0 || *cpu >= len(slots) {
+			return nil, errors.New("cpu index out of range")
+		}
+		return []int{*cpu}, nil
+	}
+	result := make([]int, len(slots))
+	for i := range slots {
+		result[i] = i
+	}
+	return result, nil
+}
+
+func copySlots(slots [][]byte) [][]byte {
+	result := make([][]byte, len(slots))
+	for i, slot := range slots {
+		result[i] = append([]byte(nil), slot...)
+	}
+	return result
+}
+
+func equalSlots(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,374 @@
+package maps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/btfs"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"os"
+	"sync"
+	"time"
+)
+
+// MinChangesInterval is the shortest interval maps are read at for WatchChanges
+const MinChangesInterval = 100 * time.Millisecond
+
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeModified ChangeKind = "modified"
+)
+
+// ChangesFilter limits the changes sent to a subscriber, empty fields match everything
+type ChangesFilter struct {
+	Kinds []ChangeKind
+	Keys  [][]byte
+}
+
+// EntryChange is a difference of an entry between two reads of a map
+type EntryChange struct {
+	Kind ChangeKind
+	Key  []byte
+	// Previous and Value are slots (one per CPU for per-CPU maps) before and after the change,
+	// Previous is nil for added entries and Value is nil for removed ones
+	Previous [][]byte
+	Value    [][]byte
+	// Deltas are differences of integer fields of modified entries, summed over CPUs, only non-zero ones are listed
+	Deltas []*FieldDelta
+}
+
+type FieldDelta struct {
+	// Field is a path of the field in the BTF type of values, it's empty if the value is an integer itself
+	Field string
+	Delta int64
+}
+
+// ChangeSet is a batch of changes found by a read, Err is set instead if the map couldn't be read
+type ChangeSet struct {
+	Time    time.Time
+	Changes []*EntryChange
+	Err     error
+}
+
+// entriesSnapshot is a read of all entries of a map, it's shared by subscribers and never modified
+type entriesSnapshot struct {
+	entries map[string][][]byte
+}
+
+type changesSubscriber struct {
+	interval time.Duration
+	filter   *ChangesFilter
+	ch       chan *ChangeSet
+	// last is the snapshot the subscriber has received changes up to, nil until the first send
+	last     *entriesSnapshot
+	lastSent time.Time
+}
+
+// changesPoller reads a map for all of its subscribers, at the shortest interval among them
+type changesPoller struct {
+	id     ebpf.MapID
+	fields []btfs.IntField
+	// wake makes the poller read the map right away, e.g. for a new subscriber
+	wake chan struct{}
+	stop chan struct{}
+
+	mu          sync.Mutex
+	subscribers map[*changesSubscriber]bool
+}
+
+// WatchChanges reads a map every interval and sends changes of its entries to the returned channel,
+// the first set has all entries as added. Sets without changes are not sent, and if the channel is not drained
+// in time, changes are accumulated until the next send. Subscribers of the same map share the reads.
+// The channel is closed once ctx is done or the map is gone.
+func (pw *mapsWatcher) WatchChanges(ctx context.Context, id ebpf.MapID, interval time.Duration, filter *ChangesFilter) (<-chan *ChangeSet, error) {
+	if interval < MinChangesInterval {
+		return nil, fmt.Errorf("interval must be at least %s", MinChangesInterval)
+	}
+	subscriber := &changesSubscriber{interval: interval, filter: filter, ch: make(chan *ChangeSet, 1)}
+
+	pw.changesMu.Lock()
+	poller := pw.changes[id]
+	created := poller == nil
+	if created {
+		var err error
+		if poller, err = newChangesPoller(id); err != nil {
+			pw.changesMu.Unlock()
+			return nil, err
+		}
+		pw.changes[id] = poller
+	}
+	poller.mu.Lock()
+	poller.subscribers[subscriber] = true
+	poller.mu.Unlock()
+	pw.changesMu.Unlock()
+
+	if created {
+		go pw.pollChanges(poller)
+	}
+
+	select {
+	case poller.wake <- struct{}{}:
+	default:
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-poller.stop:
+		}
+		pw.unsubscribeChanges(poller, subscriber)
+	}()
+	return subscriber.ch, nil
+}
+
+func newChangesPoller(id ebpf.MapID) (*changesPoller, error) {
+	emap, err := ebpf.NewMapFromID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer emap.Close()
+	if !IsLookupSupported(emap.Type()) {
+		return nil, fmt.Errorf("entries of %s maps can't be read", emap.Type())
+	}
+	typ, err := valueType(emap)
+	if err != nil {
+		return nil, err
+	}
+	var fields []btfs.IntField
+	switch size := emap.ValueSize(); {
+	case typ != nil:
+		fields = btfs.IntFields(typ)
+	case size == 1 || size == 2 || size == 4 || size == 8:
+		fields = []btfs.IntField{{Size: size}}
+	}
+	return &changesPoller{
+		id:          id,
+		fields:      fields,
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		subscribers: make(map[*changesSubscriber]bool),
+	}, nil
+}
+
+// unsubscribeChanges closes the subscriber channel, and stops the poller after its last subscriber
+func (pw *mapsWatcher) unsubscribeChanges(poller *changesPoller, subscriber *changesSubscriber) {
+	pw.changesMu.Lock()
+	defer pw.changesMu.Unlock()
+	poller.mu.Lock()
+	defer poller.mu.Unlock()
+	if !poller.subscribers[subscriber] {
+		return
+	}
+	delete(poller.subscribers, subscriber)
+	close(subscriber.ch)
+	if len(poller.subscribers) == 0 && pw.changes[poller.id] == poller {
+		delete(pw.changes, poller.id)
+		close(poller.stop)
+	}
+}
+
+func (pw *mapsWatcher) pollChanges(poller *changesPoller) {
+	// the first read is woken by the subscriber
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		select {
+		case <-poller.stop:
+			return
+		case <-poller.wake:
+		case <-timer.C:
+		}
+		snap, err := readSnapshot(poller.id)
+		if errors.Is(err, os.ErrNotExist) {
+			pw.log.Debug().Uint32("id", uint32(poller.id)).Msg("map is gone, stopping changes subscriptions")
+			poller.publish(nil, fmt.Errorf("map %d is gone", poller.id))
+			pw.stopChanges(poller)
+			return
+		}
+		next := poller.publish(snap, err)
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(next)
+	}
+}
+
+// stopChanges detaches the poller, subscribers are closed by their goroutines
+func (pw *mapsWatcher) stopChanges(poller *changesPoller) {
+	pw.changesMu.Lock()
+	defer pw.changesMu.Unlock()
+	if pw.changes[poller.id] == poller {
+		delete(pw.changes, poller.id)
+		close(poller.stop)
+	}
+}
+
+// publish sends changes to subscribers whose interval has passed, and returns the time until the next read
+func (p *changesPoller) publish(snap *entriesSnapshot, err error) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	// it's a fallback for the moment the last subscriber is gone, but the poller isn't stopped yet
+	next := MinChangesInterval
+	first := true
+	for subscriber := range p.subscribers {
+		if first || subscriber.interval < next {
+			next = subscriber.interval
+			first = false
+		}
+		// reads are done at the shortest interval, a small slack keeps others from skipping a read due to jitter
+		if subscriber.last != nil && now.Sub(subscriber.lastSent) < subscriber.interval-subscriber.interval/10 {
+			continue
+		}
+		set := &ChangeSet{Time: now, Err: err}
+		if err == nil {
+			set.Changes = diffSnapshots(subscriber.last, snap, p.fields, subscriber.filter)
+			if len(set.Changes) == 0 && subscriber.last != nil {
+				subscriber.last = snap
+				continue
+			}
+		}
+		select {
+		case subscriber.ch <- set:
+			subscriber.lastSent = now
+			if err == nil {
+				subscriber.last = snap
+			}
+		default:
+			// the subscriber is busy, the changes are sent with the next read
+		}
+	}
+	return next
+}
+
+func readSnapshot(id ebpf.MapID) (*entriesSnapshot, error) {
+	emap, err := ebpf.NewMapFromID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer emap.Close()
+	snap := &entriesSnapshot{entries: make(map[string][][]byte)}
+	keys, err := collectKeys(emap)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		slots, err := lookupSlots(emap, key)
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		snap.entries[string(key)] = slots
+	}
+	return snap, nil
+}
+
+// diffSnapshots lists changes from prev to next, all entries of next are added if prev is nil
+func diffSnapshots(prev *entriesSnapshot, next *entriesSnapshot, fields []btfs.IntField, filter *ChangesFilter) []*EntryChange {
+	var prevEntries map[string][][]byte
+	if prev != nil {
+		prevEntries = prev.entries
+	}
+	var result []*EntryChange
+	for key, value := range next.entries {
+		previous, ok := prevEntries[key]
+		switch {
+		case !ok:
+			result = append(result, &EntryChange{Kind: ChangeAdded, Key: []byte(key), Value: value})
+		case !equalSlots(previous, value):
+			result = append(result, &EntryChange{
+				Kind:     ChangeModified,
+				Key:      []byte(key),
+				Previous: previous,
+				Value:    value,
+				Deltas:   fieldDeltas(previous, value, fields),
+			})
+		}
+	}
+	for key, previous := range prevEntries {
+		if _, ok := next.entries[key]; !ok {
+			result = append(result, &EntryChange{Kind: ChangeRemoved, Key: []byte(key), Previous: previous})
+		}
+	}
+	if filter == nil {
+		return result
+	}
+	filtered := result[:0]
+	for _, change := range result {
+		if filter.matches(change) {
+			filtered = append(filtered, change)
+		}
+	}
+	return filtered
+}
+
+func (f *ChangesFilter) matches(change *EntryChange) bool {
+	if len(f.Kinds) > 0 {
+		found := false
+		for _, kind := range f.Kinds {
+			found = found || kind == change.Kind
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Keys) > 0 {
+		found := false
+		for _, key := range f.Keys {
+			found = found || string(key) == string(change.Key)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldDeltas subtracts integer fields, a difference of u64 fields wraps around if it doesn't fit int64
+func fieldDeltas(previous [][]byte, value [][]byte, fields []btfs.IntField) []*FieldDelta {
+	if len(previous) != len(value) {
+		return nil
+	}
+	var result []*FieldDelta
+	for _, field := range fields {
+		var delta int64
+		for cpu := range value {
+			delta += readInt(value[cpu], field) - readInt(previous[cpu], field)
+		}
+		if delta != 0 {
+			result = append(result, &FieldDelta{Field: field.Path, Delta: delta})
+		}
+	}
+	return result
+}
+
+func readInt(slot []byte, field btfs.IntField) int64 {
+	if int(field.Offset+field.Size) > len(slot) {
+		return 0
+	}
+	data := slot[field.Offset : field.Offset+field.Size]
+	endian := util.GetEndian()
+	switch {
+	case field.Size == 1 && field.Signed:
+		return int64(int8(data[0]))
+	case field.Size == 1:
+		return int64(data[0])
+	case field.Size == 2 && field.Signed:
+		return int64(int16(endian.Uint16(data)))
+	case field.Size == 2:
+		return int64(endian.Uint16(data))
+	case field.Size == 4 && field.Signed:
+		return int64(int32(endian.Uint32(data)))
+	case field.Size == 4:
+		return int64(endian.Uint32(data))
+	}
+	return int64(endian.Uint64(data))
+}
@@ -0,0 +1,178 @@
+package maps
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"os"
+	"reflect"
+)
+
+// clearBatchSize is how many keys are deleted with a single batch syscall
+const clearBatchSize = 256
+
+// ClearMap deletes all entries of a hash-like map, or zeroes all slots of an array, returning how many entries
+// were deleted or had non-zero values. With dryRun it only counts them.
+// Entries added by programs while the map is cleared may be kept.
+func (pw *mapsWatcher) ClearMap(id ebpf.MapID, dryRun bool) (int, error) {
+	emap, err := ebpf.NewMapFromID(id)
+	if err != nil {
+		return 0, err
+	}
+	defer emap.Close()
+	if err := checkWritable(emap); err != nil {
+		return 0, err
+	}
+	switch {
+	case emap.Type() == ebpf.Array || emap.Type() == ebpf.PerCPUArray:
+		return resetEntries(emap, []*targetField{{size: emap.ValueSize()}}, dryRun)
+	case IsCapacityLimited(emap.Type()):
+		return deleteAll(emap, dryRun)
+	}
+	return 0, fmt.Errorf("maps of type %s can't be cleared", emap.Type())
+}
+
+// ResetCounters zeroes integer fields (paths in the BTF value type, see ValueTarget) of all entries,
+// or whole values if fields are empty and values are integers; it returns how many entries had non-zero fields.
+// An entry is read and written back, so increments made by programs in between are lost.
+func (pw *mapsWatcher) ResetCounters(id ebpf.MapID, fields []string, dryRun bool) (int, error) {
+	emap, err := ebpf.NewMapFromID(id)
+	if err != nil {
+		return 0, err
+	}
+	defer emap.Close()
+	if err := checkWritable(emap); err != nil {
+		return 0, err
+	}
+	if !IsLookupSupported(emap.Type()) {
+		return 0, fmt.Errorf("entries of %s maps can't be read", emap.Type())
+	}
+	if len(fields) == 0 {
+		fields = []string{""}
+	}
+	targets := make([]*targetField, len(fields))
+	for i, path := range fields {
+		if targets[i], err = resolveTarget(emap, path); err != nil {
+			return 0, err
+		}
+		if err := checkInteger(targets[i]); err != nil {
+			if path == "" {
+				return 0, fmt.Errorf("fields to reset are required: %w", err)
+			}
+			return 0, fmt.Errorf("field %s: %w", path, err)
+		}
+	}
+	return resetEntries(emap, targets, dryRun)
+}
+
+// resetEntries zeroes the targets in each entry which has them non-zero
+func resetEntries(emap *ebpf.Map, targets []*targetField, dryRun bool) (int, error) {
+	keys, err := collectKeys(emap)
+	if err != nil {
+		return 0, err
+	}
+	affected := 0
+	for _, key := range keys {
+		slots, err := lookupSlots(emap, key)
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			continue
+		}
+		if err != nil {
+			return affected, err
+		}
+		changed := false
+		for _, slot := range slots {
+			for _, target := range targets {
+				for i := target.offset; i < target.offset+target.size; i++ {
+					if slot[i] != 0 {
+						slot[i] = 0
+						changed = true
+					}
+				}
+			}
+		}
+		if !changed {
+			continue
+		}
+		if !dryRun {
+			if IsPerCPU(emap.Type()) {
+				err = emap.Update(key, slots, ebpf.UpdateExist)
+			} else {
+				err = emap.Update(key, slots[0], ebpf.UpdateExist)
+			}
+			// deleted by a program meanwhile
+			if errors.Is(err, ebpf.ErrKeyNotExist) {
+				continue
+			}
+			if err != nil {
+				return affected, err
+			}
+		}
+		affected++
+	}
+	return affected, nil
+}
+
+// deleteAll deletes collected keys with batch syscalls where supported, keys deleted by programs meanwhile are skipped
+func deleteAll(emap *ebpf.Map, dryRun bool) (int, error) {
+	keys, err := collectKeys(emap)
+	if err != nil || dryRun {
+		return len(keys), err
+	}
+	deleted := 0
+	batchSupported := !IsPerCPU(emap.Type())
+	for len(keys) > 0 {
+		if !batchSupported {
+			err := emap.Delete(keys[0])
+			if err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+				return deleted, err
+			}
+			if err == nil {
+				deleted++
+			}
+			keys = keys[1:]
+			continue
+		}
+		chunk := keys
+		if len(chunk) > clearBatchSize {
+			chunk = chunk[:clearBatchSize]
+		}
+		batch := fixedSizeSlice(int(emap.KeySize()), len(chunk))
+		for i, key := range chunk {
+			reflect.Copy(batch.Index(i), reflect.ValueOf(key))
+		}
+		n, err := emap.BatchDelete(batch.Interface(), nil)
+		if err != nil && (n == 0 && errors.Is(err, ebpf.ErrNotSupported) || n >= len(chunk)) {
+			batchSupported = false
+			continue
+		}
+		deleted += n
+		keys = keys[n:]
+		if err != nil {
+			if !errors.Is(err, ebpf.ErrKeyNotExist) {
+				return deleted, err
+			}
+			// the kernel stops at a missing key, it's skipped
+			keys = keys[1:]
+		}
+	}
+	return deleted, nil
+}
+
+// collectKeys reads all keys before the map is changed, as deletes make hash maps restart iteration
+func collectKeys(emap *ebpf.Map) ([][]byte, error) {
+	var keys [][]byte
+	var prevKey interface{}
+	for uint32(len(keys)) < emap.MaxEntries() {
+		nextKey := make([]byte, emap.KeySize())
+		if err := emap.NextKey(prevKey, &nextKey); err != nil {
+			if errors.Is(err, ebpf.ErrKeyNotExist) || errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			return nil, err
+		}
+		keys = append(keys, nextKey)
+		prevKey = nextKey
+	}
+	return keys, nil
+}
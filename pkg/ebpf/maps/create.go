@@ -0,0 +1,277 @@
+package maps
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/features"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/pins"
+	"golang.org/x/sys/unix"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CreateSpec describes a map to be created by the agent
+type CreateSpec struct {
+	Type       ebpf.MapType
+	KeySize    uint32
+	ValueSize  uint32
+	MaxEntries uint32
+	// Flags are names of BPF_F_* flags, as returned by FlagNames
+	Flags []string
+	Name  string
+	// InnerMap is required for ArrayOfMaps and HashOfMaps, it's a template of maps the outer map holds
+	InnerMap *CreateSpec
+	// KeyLayout and ValueLayout are optional BTF descriptions of keys and values,
+	// sizes are derived from them if KeySize or ValueSize are 0
+	KeyLayout   []*LayoutField
+	ValueLayout []*LayoutField
+}
+
+// LayoutField is a field of a key or a value, Type is an integer (u8..u64, s8..s64), bool, char
+// or an array of them, e.g. char[16]; a single field without a name describes a plain integer rather than a struct
+type LayoutField struct {
+	Name string
+	Type string
+}
+
+var layoutTypePattern = regexp.MustCompile(`^(u8|u16|u32|u64|s8|s16|s32|s64|bool|char)(?:\[(\d+)])?$`)
+
+// ParseMapType accepts map type names as they are reported by the agent (e.g. Hash, LRUHash), in any case
+func ParseMapType(name string) (ebpf.MapType, error) {
+	for mt := ebpf.MapType(1); !strings.HasPrefix(mt.String(), "MapType("); mt++ {
+		if strings.EqualFold(mt.String(), name) {
+			return mt, nil
+		}
+	}
+	return ebpf.UnspecifiedMap, fmt.Errorf("unknown map type %s", name)
+}
+
+// ParseFlagNames is the reverse of FlagNames
+func ParseFlagNames(names []string) (uint32, error) {
+	var result uint32
+	for _, name := range names {
+		name = strings.TrimPrefix(strings.ToUpper(name), "BPF_F_")
+		found := false
+		for _, flag := range mapFlags {
+			if flag.name == name {
+				result |= flag.value
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown map flag %s", name)
+		}
+	}
+	return result, nil
+}
+
+// ParseLayout parses fields in the format name:type,name:type, e.g. saddr:u32,dport:u16,comm:char[16]
+func ParseLayout(layout string) ([]*LayoutField, error) {
+	var result []*LayoutField
+	for _, field := range strings.Split(layout, ",") {
+		if strings.TrimSpace(field) == "" {
+			return nil, fmt.Errorf("empty field in layout %s", layout)
+		}
+		name, typ, found := strings.Cut(strings.TrimSpace(field), ":")
+		if !found {
+			// a single unnamed field, e.g. u64
+			name, typ = "", name
+		}
+		result = append(result, &LayoutField{Name: name, Type: typ})
+	}
+	return result, nil
+}
+
+// layoutType builds BTF of a layout, fields are aligned naturally like a C compiler would do
+func layoutType(name string, fields []*LayoutField) (btf.Type, error) {
+	if len(fields) == 1 && fields[0].Name == "" {
+		typ, _, err := layoutFieldType(fields[0].Type)
+		return typ, err
+	}
+	result := &btf.Struct{Name: name}
+	var offset, maxAlign uint32 = 0, 1
+	for _, field := range fields {
+		if field.Name == "" {
+			return nil, errors.New("fields of a struct layout must have names")
+		}
+		typ, align, err := layoutFieldType(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		size, err := btf.Sizeof(typ)
+		if err != nil {
+			return nil, err
+		}
+		offset = (offset + align - 1) / align * align
+		result.Members = append(result.Members, btf.Member{Name: field.Name, Type: typ, Offset: btf.Bits(offset * 8)})
+		offset += uint32(size)
+		if align > maxAlign {
+			maxAlign = align
+		}
+	}
+	result.Size = (offset + maxAlign - 1) / maxAlign * maxAlign
+	return result, nil
+}
+
+func layoutFieldType(typ string) (btf.Type, uint32, error) {
+	match := layoutTypePattern.FindStringSubmatch(typ)
+	if match == nil {
+		return nil, 0, fmt.Errorf("unsupported type %s, should be u8..u64, s8..s64, bool, char or an array of them", typ)
+	}
+	var elem *btf.Int
+	switch match[1] {
+	case "bool":
+		elem = &btf.Int{Name: "_Bool", Size: 1, Encoding: btf.Bool}
+	case "char":
+		elem = &btf.Int{Name: "char", Size: 1, Encoding: btf.Char}
+	default:
+		bits, _ := strconv.Atoi(match[1][1:])
+		elem = &btf.Int{Name: "__" + match[1], Size: uint32(bits / 8)}
+		if match[1][0] == 's' {
+			elem.Encoding = btf.Signed
+		}
+	}
+	if match[2] == "" {
+		return elem, elem.Size, nil
+	}
+	count, err := strconv.Atoi(match[2])
+	if err != nil || count == 0 {
+		return nil, 0, fmt.Errorf("invalid array length in %s", typ)
+	}
+	return &btf.Array{Index: &btf.Int{Name: "__u32", Size: 4}, Type: elem, Nelems: uint32(count)}, elem.Size, nil
+}
+
+// mapSpec converts the spec to a cilium/ebpf spec, checking sizes against layouts and probing the kernel
+func (cs *CreateSpec) mapSpec() (*ebpf.MapSpec, error) {
+	flags, err := ParseFlagNames(cs.Flags)
+	if err != nil {
+		return nil, err
+	}
+	spec := &ebpf.MapSpec{
+		Name:       cs.Name,
+		Type:       cs.Type,
+		KeySize:    cs.KeySize,
+		ValueSize:  cs.ValueSize,
+		MaxEntries: cs.MaxEntries,
+		Flags:      flags,
+	}
+	if len(cs.Name) >= unix.BPF_OBJ_NAME_LEN {
+		return nil, fmt.Errorf("name is too long, it's limited to %d characters", unix.BPF_OBJ_NAME_LEN-1)
+	}
+	if cs.KeyLayout != nil {
+		if spec.Key, spec.KeySize, err = layoutWithSize("key", cs.KeyLayout, cs.KeySize); err != nil {
+			return nil, err
+		}
+	}
+	if cs.ValueLayout != nil {
+		if spec.Value, spec.ValueSize, err = layoutWithSize("value", cs.ValueLayout, cs.ValueSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := features.HaveMapType(cs.Type); err != nil {
+		return nil, fmt.Errorf("map type %s: %w", cs.Type, err)
+	}
+	for _, flag := range []features.MapFlags{
+		features.BPF_F_NO_PREALLOC,
+		features.BPF_F_RDONLY_PROG,
+		features.BPF_F_WRONLY_PROG,
+		features.BPF_F_MMAPABLE,
+		features.BPF_F_INNER_MAP,
+	} {
+		if flags&uint32(flag) == 0 {
+			continue
+		}
+		if err := features.HaveMapFlag(flag); err != nil {
+			return nil, fmt.Errorf("flag %s: %w", FlagNames(uint32(flag))[0], err)
+		}
+	}
+
+	if cs.Type == ebpf.ArrayOfMaps || cs.Type == ebpf.HashOfMaps {
+		if cs.InnerMap == nil {
+			return nil, fmt.Errorf("%s requires an inner map spec", cs.Type)
+		}
+		spec.InnerMap, err = cs.InnerMap.mapSpec()
+		if err != nil {
+			return nil, fmt.Errorf("inner map: %w", err)
+		}
+	} else if cs.InnerMap != nil {
+		return nil, fmt.Errorf("%s can't have an inner map", cs.Type)
+	}
+	return spec, nil
+}
+
+func layoutWithSize(name string, layout []*LayoutField, size uint32) (btf.Type, uint32, error) {
+	typ, err := layoutType(name, layout)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s layout: %w", name, err)
+	}
+	layoutSize, err := btf.Sizeof(typ)
+	if err != nil {
+		return nil, 0, err
+	}
+	if size != 0 && uint32(layoutSize) != size {
+		return nil, 0, fmt.Errorf("%s layout takes %d bytes, but %s size is %d", name, layoutSize, name, size)
+	}
+	return typ, uint32(layoutSize), nil
+}
+
+// pinPath resolves a path relative to bpf_dir, absolute paths must be inside bpf_dir too
+func (pw *mapsWatcher) pinPath(path string) (string, error) {
+	bpfDir := filepath.Clean(pw.bpfDir)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(bpfDir, path)
+	}
+	path = filepath.Clean(path)
+	if !strings.HasPrefix(path, bpfDir+"/") {
+		return "", fmt.Errorf("pin path must be inside %s", bpfDir)
+	}
+	return path, pins.CheckPinPath(path)
+}
+
+// ValidateCreateSpec checks the spec and the pin path without creating a map, it returns the resolved pin path
+func (pw *mapsWatcher) ValidateCreateSpec(spec *CreateSpec, path string) (string, error) {
+	pinPath, err := pw.pinPath(path)
+	if err != nil {
+		return pinPath, err
+	}
+	_, err = spec.mapSpec()
+	return pinPath, err
+}
+
+// CreateMap creates a map and pins it, so the map outlives the agent
+func (pw *mapsWatcher) CreateMap(spec *CreateSpec, path string) (ebpf.MapID, error) {
+	pinPath, err := pw.pinPath(path)
+	if err != nil {
+		return 0, err
+	}
+	mapSpec, err := spec.mapSpec()
+	if err != nil {
+		return 0, err
+	}
+	emap, err := ebpf.NewMap(mapSpec)
+	if err != nil {
+		return 0, err
+	}
+	// the map lives as long as the pin, the agent's descriptor is not needed
+	defer emap.Close()
+	if err := emap.Pin(pinPath); err != nil {
+		return 0, err
+	}
+	info, err := emap.Info()
+	if err != nil {
+		return 0, err
+	}
+	id, ok := info.ID()
+	if !ok {
+		return 0, fmt.Errorf("map is created and pinned at %s, but its ID is not available", pinPath)
+	}
+	// the result of the mutation shows the new map right away
+	pw.refreshMaps()
+	return id, nil
+}
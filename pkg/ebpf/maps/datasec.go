@@ -0,0 +1,143 @@
+package maps
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/btfs"
+)
+
+// Datasec is a global data section (.data, .bss, .rodata or a custom .data.* section) of a BPF object,
+// libbpf and cilium/ebpf keep it in a single-entry array map, described by a BTF Datasec
+type Datasec struct {
+	// Name is a name of the section, e.g. .rodata
+	Name string
+	// Frozen sections (.rodata, once the object is loaded) can't be changed from userspace
+	Frozen    bool
+	Variables []*Variable
+}
+
+// Variable is a global variable in a data section
+type Variable struct {
+	Name   string
+	Type   btf.Type
+	Offset uint32
+	Size   uint32
+	// Value is raw data of the variable
+	Value []byte
+}
+
+// GetDatasec reads variables of a global data section map, it returns nil if the map is not one
+func GetDatasec(id ebpf.MapID) (*Datasec, error) {
+	emap, err := ebpf.NewMapFromID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer emap.Close()
+	datasec, err := datasecType(emap)
+	if datasec == nil {
+		return nil, err
+	}
+
+	result := &Datasec{
+		Name:      datasec.Name,
+		Variables: []*Variable{},
+	}
+	result.Frozen, err = isFrozen(emap)
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	if err := emap.Lookup(uint32(0), &value); err != nil {
+		return nil, err
+	}
+	for _, secinfo := range datasec.Vars {
+		variable, ok := secinfo.Type.(*btf.Var)
+		if !ok || secinfo.Offset+secinfo.Size > uint32(len(value)) {
+			continue
+		}
+		result.Variables = append(result.Variables, &Variable{
+			Name:   variable.Name,
+			Type:   variable.Type,
+			Offset: secinfo.Offset,
+			Size:   secinfo.Size,
+			Value:  value[secinfo.Offset : secinfo.Offset+secinfo.Size],
+		})
+	}
+	return result, nil
+}
+
+// SetVariable sets a variable of a global data section map, value is parsed according to the type of the variable.
+// The section is read and written back as a whole, so concurrent changes of other variables
+// made by programs in between are lost.
+func (pw *mapsWatcher) SetVariable(id ebpf.MapID, name string, value string) error {
+	emap, err := ebpf.NewMapFromID(id)
+	if err != nil {
+		return err
+	}
+	defer emap.Close()
+	datasec, err := datasecType(emap)
+	if err != nil {
+		return err
+	}
+	if datasec == nil {
+		return errors.New("map is not a global data section")
+	}
+	if err := checkWritable(emap); err != nil {
+		return fmt.Errorf("section %s can't be changed: %w", datasec.Name, err)
+	}
+
+	for _, secinfo := range datasec.Vars {
+		variable, ok := secinfo.Type.(*btf.Var)
+		if !ok || variable.Name != name {
+			continue
+		}
+		raw, err := btfs.ParseValue(variable.Type, value)
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+		if uint32(len(raw)) != secinfo.Size {
+			return fmt.Errorf("size of %s is %d bytes, but its type takes %d", name, secinfo.Size, len(raw))
+		}
+		var current []byte
+		if err := emap.Lookup(uint32(0), &current); err != nil {
+			return err
+		}
+		if uint64(secinfo.Offset)+uint64(secinfo.Size) > uint64(len(current)) {
+			return fmt.Errorf("%s is out of the %d-byte value of section %s", name, len(current), datasec.Name)
+		}
+		copy(current[secinfo.Offset:], raw)
+		return emap.Update(uint32(0), current, ebpf.UpdateExist)
+	}
+	return fmt.Errorf("variable %s not found in section %s", name, datasec.Name)
+}
+
+// datasecType returns BTF Datasec of the map value, or nil if the map is not a global data section
+func datasecType(emap *ebpf.Map) (*btf.Datasec, error) {
+	if emap.Type() != ebpf.Array || emap.MaxEntries() != 1 || emap.KeySize() != 4 {
+		return nil, nil
+	}
+	typ, err := valueType(emap)
+	if typ == nil {
+		return nil, err
+	}
+	datasec, _ := typ.(*btf.Datasec)
+	return datasec, nil
+}
+
+// valueType returns BTF type of the map value, or nil if the map is created without BTF
+func valueType(emap *ebpf.Map) (btf.Type, error) {
+	var info bpfMapInfo
+	if err := getMapInfo(emap.FD(), &info); err != nil {
+		return nil, err
+	}
+	if info.BtfID == 0 || info.BtfValueTypeID == 0 {
+		return nil, nil
+	}
+	spec, _, err := btfs.LoadSpec(info.BtfID)
+	if err != nil {
+		return nil, err
+	}
+	return spec.TypeByID(btf.TypeID(info.BtfValueTypeID))
+}
@@ -0,0 +1,81 @@
+package maps
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	// ErrFrozen is returned by writes to maps frozen with BPF_MAP_FREEZE, e.g. .rodata of loaded programs
+	ErrFrozen = errors.New("map is frozen")
+	// ErrReadOnly is returned by writes to maps created with BPF_F_RDONLY, which userspace can only read
+	ErrReadOnly = errors.New("map is read-only from userspace")
+)
+
+// mapFlags are BPF_F_* flags of map creation, some of them are not known by x/sys/unix yet
+var mapFlags = []struct {
+	value uint32
+	name  string
+}{
+	{unix.BPF_F_NO_PREALLOC, "NO_PREALLOC"},
+	{unix.BPF_F_NO_COMMON_LRU, "NO_COMMON_LRU"},
+	{unix.BPF_F_NUMA_NODE, "NUMA_NODE"},
+	{unix.BPF_F_RDONLY, "RDONLY"},
+	{unix.BPF_F_WRONLY, "WRONLY"},
+	{unix.BPF_F_STACK_BUILD_ID, "STACK_BUILD_ID"},
+	{unix.BPF_F_ZERO_SEED, "ZERO_SEED"},
+	{unix.BPF_F_RDONLY_PROG, "RDONLY_PROG"},
+	{unix.BPF_F_WRONLY_PROG, "WRONLY_PROG"},
+	{unix.BPF_F_CLONE, "CLONE"},
+	{unix.BPF_F_MMAPABLE, "MMAPABLE"},
+	{1 << 11, "PRESERVE_ELEMS"},
+	{1 << 12, "INNER_MAP"},
+	{1 << 13, "LINK"},
+	{1 << 14, "PATH_FD"},
+	{1 << 15, "VTYPE_BTF_OBJ_FD"},
+	{1 << 16, "TOKEN_FD"},
+	{1 << 17, "SEGV_ON_FAULT"},
+	{1 << 18, "NO_USER_CONV"},
+}
+
+// FlagNames names BPF_F_* flags a map was created with, unknown flags are reported in hex
+func FlagNames(flags uint32) []string {
+	result := []string{}
+	for _, flag := range mapFlags {
+		if flags&flag.value != 0 {
+			result = append(result, flag.name)
+			flags &^= flag.value
+		}
+	}
+	if flags != 0 {
+		result = append(result, fmt.Sprintf("%#x", flags))
+	}
+	return result
+}
+
+// checkWritable tells why userspace can't update or delete elements of the map, if it can't
+func checkWritable(emap *ebpf.Map) error {
+	if emap.Flags()&unix.BPF_F_RDONLY != 0 {
+		return ErrReadOnly
+	}
+	frozen, err := isFrozen(emap)
+	if err != nil {
+		return err
+	}
+	if frozen {
+		return ErrFrozen
+	}
+	return nil
+}
+
+func isFrozen(emap *ebpf.Map) (bool, error) {
+	fdinfo, err := util.ReadFdinfo(emap.FD())
+	if err != nil {
+		return false, err
+	}
+	// kernels before 5.2 don't report it, maps can't be frozen there
+	return fdinfo["frozen"] == "1", nil
+}
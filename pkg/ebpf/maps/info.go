@@ -0,0 +1,30 @@
+package maps
+
+import (
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"unsafe"
+)
+
+// bpfMapInfo mirrors struct bpf_map_info, it provides fields that are not exposed by ebpf.MapInfo
+type bpfMapInfo struct {
+	Type                  uint32
+	ID                    uint32
+	KeySize               uint32
+	ValueSize             uint32
+	MaxEntries            uint32
+	MapFlags              uint32
+	Name                  [16]byte
+	Ifindex               uint32
+	BtfVmlinuxValueTypeID uint32
+	NetnsDev              uint64
+	NetnsIno              uint64
+	BtfID                 uint32
+	BtfKeyTypeID          uint32
+	BtfValueTypeID        uint32
+	_                     [4]byte
+	MapExtra              uint64
+}
+
+func getMapInfo(fd int, info *bpfMapInfo) error {
+	return util.ObjGetInfoByFD(fd, unsafe.Pointer(info), unsafe.Sizeof(*info))
+}
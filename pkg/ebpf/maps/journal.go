@@ -0,0 +1,333 @@
+package maps
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxJournalEntries is how many recent mutations are kept for undo, over all maps
+const maxJournalEntries = 1000
+
+const (
+	MutationCreate        = "create"
+	MutationUpdate        = "update"
+	MutationDelete        = "delete"
+	MutationCompareAndSet = "compare_and_set"
+	MutationIncrement     = "increment"
+	MutationUndo          = "undo"
+)
+
+// Mutation is a journal record of a write to a map entry made by the agent
+type Mutation struct {
+	ID      uint64     `json:"id"`
+	MapID   ebpf.MapID `json:"mapId"`
+	MapName string     `json:"mapName"`
+	Time    time.Time  `json:"time"`
+	Kind    string     `json:"kind"`
+	Key     []byte     `json:"key"`
+	// Previous is the value before the mutation (a slot per CPU for per-CPU maps), nil if the key didn't exist
+	Previous [][]byte `json:"previous"`
+	// Written is the value after the mutation, nil if the key was deleted
+	Written [][]byte `json:"written"`
+	// UndoOf is the ID of the undone mutation for MutationUndo records
+	UndoOf uint64 `json:"undoOf,omitempty"`
+	// Undone is set once the mutation is undone, it's not persisted, but restored from MutationUndo records
+	Undone bool `json:"-"`
+}
+
+type journal struct {
+	mu        sync.Mutex
+	nextID    uint64
+	mutations []*Mutation
+	// path is a file mutations are appended to as JSON lines, empty if the journal is in memory only
+	path string
+	// fileEntries is a number of lines in the file, it's rewritten with the kept mutations once it doubles the limit
+	fileEntries int
+}
+
+func newJournal() *journal {
+	return &journal{nextID: 1}
+}
+
+// load reads mutations persisted earlier and rewrites the file with the recent ones only
+func (j *journal) load(path string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	file, err := os.Open(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 16*1024*1024)
+		for scanner.Scan() {
+			var mutation Mutation
+			if err := json.Unmarshal(scanner.Bytes(), &mutation); err != nil {
+				file.Close()
+				return fmt.Errorf("corrupted journal %s: %w", path, err)
+			}
+			j.append(&mutation)
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	j.path = path
+	return j.rewrite()
+}
+
+func (j *journal) rewrite() error {
+	tmpPath := j.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, mutation := range j.mutations {
+		if err := encoder.Encode(mutation); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	j.fileEntries = len(j.mutations)
+	return os.Rename(tmpPath, j.path)
+}
+
+// append adds a mutation, dropping the oldest ones beyond the limit; it's called with mu held
+func (j *journal) append(mutation *Mutation) {
+	if mutation.ID == 0 {
+		mutation.ID = j.nextID
+	}
+	if mutation.ID >= j.nextID {
+		j.nextID = mutation.ID + 1
+	}
+	if mutation.Kind == MutationUndo {
+		if undone := j.find(mutation.UndoOf); undone != nil {
+			undone.Undone = true
+			// undoing an undo writes the value of the mutation it reverted again, so that one can be undone again
+			if undone.Kind == MutationUndo {
+				if redone := j.find(undone.UndoOf); redone != nil {
+					redone.Undone = false
+				}
+			}
+		}
+	}
+	j.mutations = append(j.mutations, mutation)
+	if len(j.mutations) > maxJournalEntries {
+		j.mutations = j.mutations[len(j.mutations)-maxJournalEntries:]
+	}
+}
+
+func (j *journal) find(id uint64) *Mutation {
+	for _, mutation := range j.mutations {
+		if mutation.ID == id {
+			return mutation
+		}
+	}
+	return nil
+}
+
+func (j *journal) record(mutations ...*Mutation) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, mutation := range mutations {
+		mutation.ID = 0
+		j.append(mutation)
+	}
+	if j.path == "" {
+		return nil
+	}
+	if j.fileEntries+len(mutations) > 2*maxJournalEntries {
+		return j.rewrite()
+	}
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, mutation := range mutations {
+		if err := encoder.Encode(mutation); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	j.fileEntries += len(mutations)
+	return file.Close()
+}
+
+// PersistJournal loads mutations recorded by a previous run of the agent from path, and appends new ones to it
+func (pw *mapsWatcher) PersistJournal(path string) error {
+	return pw.journal.load(path)
+}
+
+// GetMutationHistory returns recorded mutations of a map, the most recent first
+func (pw *mapsWatcher) GetMutationHistory(id ebpf.MapID, limit int) []*Mutation {
+	pw.journal.mu.Lock()
+	defer pw.journal.mu.Unlock()
+	var result []*Mutation
+	for i := len(pw.journal.mutations) - 1; i >= 0 && len(result) < limit; i-- {
+		if mutation := pw.journal.mutations[i]; mutation.MapID == id {
+			copied := *mutation
+			result = append(result, &copied)
+		}
+	}
+	return result
+}
+
+// UndoMutation restores the value a mutation replaced. It fails with ErrConflict if the entry is changed since
+// the mutation (by a program, or by a later mutation which has to be undone first), unless force is set.
+// The undo is recorded as a mutation too, so it can be undone in turn.
+func (pw *mapsWatcher) UndoMutation(id uint64, force bool) (*Mutation, error) {
+	pw.journal.mu.Lock()
+	found := pw.journal.find(id)
+	var mutation Mutation
+	if found != nil {
+		mutation = *found
+	}
+	pw.journal.mu.Unlock()
+	if found == nil {
+		return nil, fmt.Errorf("mutation %d not found, only %d recent mutations are kept", id, maxJournalEntries)
+	}
+	if mutation.Undone {
+		return nil, fmt.Errorf("mutation %d is already undone", id)
+	}
+
+	emap, err := ebpf.NewMapFromID(mutation.MapID)
+	if err != nil {
+		return nil, err
+	}
+	defer emap.Close()
+	// a persisted journal may refer to maps of a previous boot, which IDs are given to other maps now
+	info, err := emap.Info()
+	if err != nil {
+		return nil, err
+	}
+	if info.Name != mutation.MapName {
+		return nil, fmt.Errorf("map %d is %s now, not %s", mutation.MapID, info.Name, mutation.MapName)
+	}
+	if err := checkWritable(emap); err != nil {
+		return nil, err
+	}
+
+	current, err := lookupSlots(emap, mutation.Key)
+	if err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return nil, err
+	}
+	if !force && !equalSlots(current, mutation.Written) {
+		return nil, fmt.Errorf("%w: key %x is changed since mutation %d", ErrConflict, mutation.Key, id)
+	}
+	if err := writeSlots(emap, mutation.Key, mutation.Previous); err != nil {
+		return nil, err
+	}
+	undo := &Mutation{
+		MapID:    mutation.MapID,
+		MapName:  mutation.MapName,
+		Time:     time.Now(),
+		Kind:     MutationUndo,
+		Key:      mutation.Key,
+		Previous: current,
+		Written:  mutation.Previous,
+		UndoOf:   id,
+	}
+	if err := pw.journal.record(undo); err != nil {
+		pw.log.Warn().Err(err).Msg("failed to persist map mutations journal")
+	}
+	return undo, nil
+}
+
+// recordMutations adds mutations to the journal, failures to persist them don't fail the writes, which are done already
+func (pw *mapsWatcher) recordMutations(emap *ebpf.Map, id ebpf.MapID, mutations []*Mutation) {
+	if len(mutations) == 0 {
+		return
+	}
+	var name string
+	if info, err := emap.Info(); err == nil {
+		name = info.Name
+	}
+	for _, mutation := range mutations {
+		mutation.MapID = id
+		mutation.MapName = name
+	}
+	if err := pw.journal.record(mutations...); err != nil {
+		pw.log.Warn().Err(err).Msg("failed to persist map mutations journal")
+	}
+}
+
+// writeSlots sets a value read by lookupSlots, or deletes the key if slots are nil
+func writeSlots(emap *ebpf.Map, key []byte, slots [][]byte) error {
+	if slots == nil {
+		err := emap.Delete(key)
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			return nil
+		}
+		return err
+	}
+	if IsPerCPU(emap.Type()) {
+		return emap.Update(key, slots, ebpf.UpdateAny)
+	}
+	return emap.Update(key, slots[0], ebpf.UpdateAny)
+}
+
+// opRecorder tracks values of keys while ops are applied, so each op is journaled with the value it replaced
+type opRecorder struct {
+	emap      *ebpf.Map
+	values    map[string][][]byte
+	known     map[string]bool
+	mutations map[int]*Mutation
+}
+
+func newOpRecorder(emap *ebpf.Map) *opRecorder {
+	return &opRecorder{
+		emap:      emap,
+		values:    make(map[string][][]byte),
+		known:     make(map[string]bool),
+		mutations: make(map[int]*Mutation),
+	}
+}
+
+// before reads values of keys the ops are about to change, unless they are known already
+func (r *opRecorder) before(ops []*parsedOp) {
+	for _, op := range ops {
+		if r.known[string(op.key)] {
+			continue
+		}
+		value, err := lookupSlots(r.emap, op.key)
+		if err != nil {
+			value = nil
+		}
+		r.values[string(op.key)] = value
+		r.known[string(op.key)] = true
+	}
+}
+
+// after records a successfully applied op with the given index in the batch
+func (r *opRecorder) after(index int, op *parsedOp) {
+	var written [][]byte
+	switch {
+	case op.Kind == OpDelete:
+	case IsPerCPU(r.emap.Type()):
+		// the kernel fills slots of CPUs missing in a created value, and updates of a single CPU
+		// keep the others, so the value is read back
+		written, _ = lookupSlots(r.emap, op.key)
+	default:
+		written = [][]byte{append([]byte(nil), op.value.([]byte)...)}
+	}
+	r.mutations[index] = &Mutation{
+		Time:     time.Now(),
+		Kind:     string(op.Kind),
+		Key:      op.key,
+		Previous: r.values[string(op.key)],
+		Written:  written,
+	}
+	r.values[string(op.key)] = written
+}
@@ -4,25 +4,47 @@ import (
 	"context"
 	"errors"
 	"github.com/cilium/ebpf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 )
 
 type mapsWatcher struct {
 	log             zerolog.Logger
 	refreshInterval time.Duration
-	maps            []*MapInfo
-	error           error
-	isRunning       bool
+	// maps and error are guarded by mapsMu, they are refreshed by the watcher and after mutations of maps;
+	// fetchMu serializes refreshes, which update metrics as well
+	mapsMu    sync.RWMutex
+	fetchMu   sync.Mutex
+	maps      []*MapInfo
+	error     error
+	isRunning bool
+	// memlockIDs and memlockTypes have memlock series set by the previous fetch, they are guarded by fetchMu
+	memlockIDs   map[string]bool
+	memlockTypes map[string]bool
 
 	mapsCount       *prometheus.GaugeVec
 	mapEntriesCount *prometheus.GaugeVec
 	mapEntryValues  *prometheus.GaugeVec
+	mapMemlock      *prometheus.GaugeVec
+	mapTypeMemlock  *prometheus.GaugeVec
+	mapFillRatio    *prometheus.GaugeVec
 	exportConfigs   []*MapExportConfiguration
 	bpfDir          string
+
+	capacityConfigs []*MapCapacityConfiguration
+	capacityMu      sync.Mutex
+	capacity        map[ebpf.MapID]*capacityState
+
+	journal *journal
+
+	changesMu sync.Mutex
+	changes   map[ebpf.MapID]*changesPoller
 }
 
 type MapsWatcher interface {
@@ -31,10 +53,33 @@ type MapsWatcher interface {
 	GetMap(id ebpf.MapID) (*MapInfo, error)
 	RegisterMetrics(registry *prometheus.Registry)
 	AddExportConfig(config *MapExportConfiguration)
+	// AddCapacityConfig enables tracking of how full matching maps are
+	AddCapacityConfig(config *MapCapacityConfiguration)
+	GetCapacity(id ebpf.MapID) *Capacity
 	PinMap(id ebpf.MapID, path string) error
 	UpdateMapValue(id ebpf.MapID, key string, cpu *int, value string, keyFormat DisplayFormat, mapsFormat DisplayFormat) error
 	CreateMapValue(id ebpf.MapID, key string, values []string, keyFormat DisplayFormat, mapsFormat DisplayFormat) error
 	DeleteMapValue(id ebpf.MapID, key string, keyFormat DisplayFormat) error
+	// ApplyMapOps applies a list of writes, reporting a result of each of them
+	ApplyMapOps(id ebpf.MapID, ops []*Op, opts *BatchOptions) (*BatchResult, error)
+	CompareAndSetMapValue(id ebpf.MapID, key string, expected string, value string, target *ValueTarget, keyFormat DisplayFormat, valueFormat DisplayFormat) (*ValueChange, error)
+	IncrementMapValue(id ebpf.MapID, key string, delta int64, target *ValueTarget, keyFormat DisplayFormat) (*ValueChange, error)
+	// ClearMap and ResetCounters are not journaled, they return the number of affected entries
+	ClearMap(id ebpf.MapID, dryRun bool) (int, error)
+	ResetCounters(id ebpf.MapID, fields []string, dryRun bool) (int, error)
+	// PersistJournal keeps the journal of writes above in a file, so they can be undone after a restart
+	PersistJournal(path string) error
+	GetMutationHistory(id ebpf.MapID, limit int) []*Mutation
+	UndoMutation(id uint64, force bool) (*Mutation, error)
+	// WatchChanges streams changes of map entries, maps watched by several subscribers are read once for all of them
+	WatchChanges(ctx context.Context, id ebpf.MapID, interval time.Duration, filter *ChangesFilter) (<-chan *ChangeSet, error)
+	// CreateMap creates a map pinned at path, which is either relative to bpf_dir or an absolute path inside it
+	CreateMap(spec *CreateSpec, path string) (ebpf.MapID, error)
+	ValidateCreateSpec(spec *CreateSpec, path string) (string, error)
+	// FreezeMap makes the map read-only for userspace, it can't be undone
+	FreezeMap(id ebpf.MapID) error
+	// SetVariable sets a global variable of a .data, .bss or custom data section by name
+	SetVariable(id ebpf.MapID, name string, value string) error
 }
 
 type WatcherOpts struct {
@@ -60,13 +105,37 @@ func NewWatcher(logger zerolog.Logger, bpfDir string) MapsWatcher {
 		Name:      "map_entry_value",
 		Help:      "Value of an eBPF map entry",
 	}, []string{"id", "name", "type", "key", "cpu"})
+	mapMemlock := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "map_memlock_bytes",
+		Help:      "Kernel memory charged to an eBPF map",
+	}, []string{"id", "name", "type"})
+	mapTypeMemlock := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "map_type_memlock_bytes",
+		Help:      "Kernel memory charged to eBPF maps of a type",
+	}, []string{"type"})
+	mapFillRatio := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "map_fill_ratio",
+		Help:      "Number of entries of an eBPF map relative to its max entries",
+	}, []string{"id", "name", "type"})
 
 	return &mapsWatcher{
 		log:             logger,
 		mapsCount:       mapsCount,
 		mapEntriesCount: mapEntriesCount,
 		mapEntryValues:  mapEntryValues,
+		mapMemlock:      mapMemlock,
+		mapTypeMemlock:  mapTypeMemlock,
+		mapFillRatio:    mapFillRatio,
 		bpfDir:          bpfDir,
+		capacity:        make(map[ebpf.MapID]*capacityState),
+		journal:         newJournal(),
+		changes:         make(map[ebpf.MapID]*changesPoller),
 	}
 }
 
@@ -87,6 +156,18 @@ func (pw *mapsWatcher) RegisterMetrics(registry *prometheus.Registry) {
 	if err != nil {
 		pw.log.Err(err).Msg("Failed to register map_entry_value metric")
 	}
+	err = registry.Register(pw.mapMemlock)
+	if err != nil {
+		pw.log.Err(err).Msg("Failed to register map_memlock_bytes metric")
+	}
+	err = registry.Register(pw.mapTypeMemlock)
+	if err != nil {
+		pw.log.Err(err).Msg("Failed to register map_type_memlock_bytes metric")
+	}
+	err = registry.Register(pw.mapFillRatio)
+	if err != nil {
+		pw.log.Err(err).Msg("Failed to register map_fill_ratio metric")
+	}
 }
 
 func (pw *mapsWatcher) Run(ctx context.Context, refreshInterval time.Duration) {
@@ -100,7 +181,7 @@ func (pw *mapsWatcher) Run(ctx context.Context, refreshInterval time.Duration) {
 		for {
 			select {
 			case <-ticker.C:
-				pw.maps, pw.error = pw.fetchMaps()
+				pw.refreshMaps()
 			case <-ctx.Done():
 				pw.isRunning = false
 				return
@@ -119,13 +200,41 @@ type MapInfo struct {
 	KeySize    uint32
 	ValueSize  uint32
 	MaxEntries uint32
+	// BtfID is 0 if the map is created without BTF, key and value type IDs refer to types of that BTF
+	BtfID          uint32
+	BtfKeyTypeID   uint32
+	BtfValueTypeID uint32
+	// BtfVmlinuxValueTypeID is a kernel type of the value of struct_ops maps
+	BtfVmlinuxValueTypeID uint32
+	// Frozen maps can't be changed from userspace, programs still can change them unless created with BPF_F_RDONLY_PROG
+	Frozen bool
+	// MemlockBytes is kernel memory charged to the map, as reported by fdinfo
+	MemlockBytes uint64
+	// MapExtra is a type-specific setting, e.g. number of hash functions of bloom filters
+	MapExtra uint64
+	// OwnerProgType is a type of programs allowed to use a prog_array map, it's set once a program uses the map
+	OwnerProgType ebpf.ProgramType
 }
 
 func (pw *mapsWatcher) GetMaps() ([]*MapInfo, error) {
-	if pw.maps == nil {
-		return pw.fetchMaps()
+	pw.mapsMu.RLock()
+	maps, err := pw.maps, pw.error
+	pw.mapsMu.RUnlock()
+	if maps == nil {
+		return pw.refreshMaps()
 	}
-	return pw.maps, pw.error
+	return maps, err
+}
+
+// refreshMaps fetches maps and replaces the cached list
+func (pw *mapsWatcher) refreshMaps() ([]*MapInfo, error) {
+	pw.fetchMu.Lock()
+	defer pw.fetchMu.Unlock()
+	maps, err := pw.fetchMaps()
+	pw.mapsMu.Lock()
+	pw.maps, pw.error = maps, err
+	pw.mapsMu.Unlock()
+	return maps, err
 }
 
 func (pw *mapsWatcher) GetMap(id ebpf.MapID) (*MapInfo, error) {
@@ -150,75 +259,36 @@ func (pw *mapsWatcher) PinMap(id ebpf.MapID, path string) error {
 }
 
 func (pw *mapsWatcher) CreateMapValue(id ebpf.MapID, key string, values []string, keyFormat DisplayFormat, mapsFormat DisplayFormat) error {
-	emap, err := ebpf.NewMapFromID(id)
-	if err != nil {
-		return err
-	}
-	if !IsPerCPU(emap.Type()) && len(values) != 1 {
-		return errors.New("map is not percpu, but multiple values were provided")
-	}
-
-	keyBytes, err := RestoreBytes(keyFormat, key, emap.KeySize())
-	if err != nil {
-		return err
-	}
-	valueBytesSlice := make([][]byte, len(values))
-	for i, value := range values {
-		valueBytes, err := RestoreBytes(mapsFormat, value, emap.ValueSize())
-		if err != nil {
-			return err
-		}
-		valueBytesSlice[i] = valueBytes
-	}
-	if IsPerCPU(emap.Type()) {
-		return emap.Update(keyBytes, valueBytesSlice, ebpf.UpdateNoExist)
-	} else {
-		return emap.Update(keyBytes, valueBytesSlice[0], ebpf.UpdateNoExist)
-	}
+	return pw.applyOne(id, &Op{Kind: OpCreate, Key: key, Values: values}, keyFormat, mapsFormat)
 }
 
 func (pw *mapsWatcher) UpdateMapValue(id ebpf.MapID, key string, cpu *int, value string, keyFormat DisplayFormat, mapsFormat DisplayFormat) error {
-	emap, err := ebpf.NewMapFromID(id)
-	if err != nil {
-		return err
-	}
-	keyBytes, err := RestoreBytes(keyFormat, key, emap.KeySize())
-	if err != nil {
-		return err
-	}
-	valueBytes, err := RestoreBytes(mapsFormat, value, emap.ValueSize())
-	if err != nil {
-		return err
-	}
-	if IsPerCPU(emap.Type()) && cpu == nil {
-		return errors.New("cpu index is required for percpu maps")
-	}
-	if cpu == nil {
-		return emap.Update(keyBytes, valueBytes, ebpf.UpdateAny)
-	} else {
-		var currentValue [][]byte
-		err = emap.Lookup(keyBytes, &currentValue)
-		if err != nil {
-			return err
-		}
-		if len(currentValue) <= *cpu {
-			return errors.New("cpu index out of range")
-		}
-		currentValue[*cpu] = valueBytes
-		return emap.Update(keyBytes, currentValue, ebpf.UpdateAny)
-	}
+	return pw.applyOne(id, &Op{Kind: OpUpdate, Key: key, Values: []string{value}, CPU: cpu}, keyFormat, mapsFormat)
 }
 
 func (pw *mapsWatcher) DeleteMapValue(id ebpf.MapID, key string, keyFormat DisplayFormat) error {
+	return pw.applyOne(id, &Op{Kind: OpDelete, Key: key}, keyFormat, DisplayFormatHex)
+}
+
+func (pw *mapsWatcher) FreezeMap(id ebpf.MapID) error {
 	emap, err := ebpf.NewMapFromID(id)
 	if err != nil {
 		return err
 	}
-	keyBytes, err := RestoreBytes(keyFormat, key, emap.KeySize())
+	defer emap.Close()
+	frozen, err := isFrozen(emap)
 	if err != nil {
 		return err
 	}
-	return emap.Delete(keyBytes)
+	if frozen {
+		return ErrFrozen
+	}
+	if err := emap.Freeze(); err != nil {
+		return err
+	}
+	// the result of the mutation shows the map as frozen right away
+	pw.refreshMaps()
+	return nil
 }
 
 func getPins(bpfDir string) map[ebpf.MapID][]string {
@@ -259,6 +329,10 @@ func (pw *mapsWatcher) fetchMaps() ([]*MapInfo, error) {
 
 	// maps count by type
 	mapsCount := make(map[ebpf.MapType]int)
+	typeMemlock := make(map[ebpf.MapType]uint64)
+	// maps with tracked capacity
+	tracked := make(map[ebpf.MapID]bool)
+	seenIDs := make(map[string]bool)
 	defer func() {
 		for k, v := range mapsCount {
 			pw.mapsCount.WithLabelValues(k.String()).Set(float64(v))
@@ -269,6 +343,8 @@ func (pw *mapsWatcher) fetchMaps() ([]*MapInfo, error) {
 		currID, err = ebpf.MapGetNextID(currID)
 		if err != nil {
 			if errors.Is(err, os.ErrNotExist) {
+				pw.forgetCapacity(tracked)
+				pw.updateMemlockMetrics(seenIDs, typeMemlock)
 				break
 			}
 			pw.log.Err(err).Msg("failed to get next map ID")
@@ -288,16 +364,37 @@ func (pw *mapsWatcher) fetchMaps() ([]*MapInfo, error) {
 		if info != nil {
 			name = info.Name
 		}
+		var rawInfo bpfMapInfo
+		if err := getMapInfo(emap.FD(), &rawInfo); err != nil {
+			pw.log.Debug().Err(err).Msgf("failed to get extended info of map %d", currID)
+		}
+		fdinfo, err := util.ReadFdinfo(emap.FD())
+		if err != nil {
+			pw.log.Debug().Err(err).Msgf("failed to read fdinfo of map %d", currID)
+		}
+		memlock, _ := fdinfo.Uint("memlock")
+		ownerProgType, _ := fdinfo.Uint("owner_prog_type")
+		typeMemlock[emap.Type()] += memlock
+		seenIDs[strconv.Itoa(int(currID))] = true
+		pw.mapMemlock.WithLabelValues(strconv.Itoa(int(currID)), name, emap.Type().String()).Set(float64(memlock))
 		maps = append(maps, &MapInfo{
-			ID:         currID,
-			Error:      err2,
-			Name:       name,
-			Type:       emap.Type(),
-			Flags:      emap.Flags(),
-			Pins:       pinnedMaps[currID],
-			KeySize:    emap.KeySize(),
-			ValueSize:  emap.ValueSize(),
-			MaxEntries: emap.MaxEntries(),
+			ID:                    currID,
+			Error:                 err2,
+			Name:                  name,
+			Type:                  emap.Type(),
+			Flags:                 emap.Flags(),
+			Pins:                  pinnedMaps[currID],
+			KeySize:               emap.KeySize(),
+			ValueSize:             emap.ValueSize(),
+			MaxEntries:            emap.MaxEntries(),
+			BtfID:                 rawInfo.BtfID,
+			BtfKeyTypeID:          rawInfo.BtfKeyTypeID,
+			BtfValueTypeID:        rawInfo.BtfValueTypeID,
+			BtfVmlinuxValueTypeID: rawInfo.BtfVmlinuxValueTypeID,
+			Frozen:                fdinfo["frozen"] == "1",
+			MemlockBytes:          memlock,
+			MapExtra:              rawInfo.MapExtra,
+			OwnerProgType:         ebpf.ProgramType(ownerProgType),
 		})
 
 		for _, config := range pw.exportConfigs {
@@ -306,10 +403,33 @@ func (pw *mapsWatcher) fetchMaps() ([]*MapInfo, error) {
 				break
 			}
 		}
+		pw.trackCapacity(emap, currID, name, tracked)
 	}
 	return maps, nil
 }
 
+// updateMemlockMetrics sets totals by type and deletes series of maps and types which are gone since
+// the previous fetch; series are not reset, so scrapes during a fetch don't miss them
+func (pw *mapsWatcher) updateMemlockMetrics(seenIDs map[string]bool, typeMemlock map[ebpf.MapType]uint64) {
+	for id := range pw.memlockIDs {
+		if !seenIDs[id] {
+			pw.mapMemlock.DeletePartialMatch(prometheus.Labels{"id": id})
+		}
+	}
+	pw.memlockIDs = seenIDs
+	types := make(map[string]bool)
+	for mapType, memlock := range typeMemlock {
+		types[mapType.String()] = true
+		pw.mapTypeMemlock.WithLabelValues(mapType.String()).Set(float64(memlock))
+	}
+	for mapType := range pw.memlockTypes {
+		if !types[mapType] {
+			pw.mapTypeMemlock.DeleteLabelValues(mapType)
+		}
+	}
+	pw.memlockTypes = types
+}
+
 func mapInfoErr(id ebpf.MapID, err error) *MapInfo {
 	return &MapInfo{
 		ID:    id,
@@ -0,0 +1,148 @@
+package netdevs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"golang.org/x/sys/unix"
+	"syscall"
+	"unsafe"
+)
+
+// a minimal rtnetlink client, just enough to dump links and tc filters
+
+const (
+	tcaKind    = 1
+	tcaOptions = 2
+	tcaChain   = 11
+
+	tcaBpfName  = 7
+	tcaBpfFlags = 8
+	tcaBpfID    = 11
+
+	tcaBpfFlagActDirect = 1
+
+	// TC_H_MAKE(TC_H_CLSACT, TC_H_MIN_INGRESS) and TC_H_MAKE(TC_H_CLSACT, TC_H_MIN_EGRESS)
+	tcParentIngress = 0xfffffff2
+	tcParentEgress  = 0xfffffff3
+)
+
+// tcMsg mirrors struct tcmsg
+type tcMsg struct {
+	Family  uint8
+	_       [3]byte
+	Ifindex int32
+	Handle  uint32
+	Parent  uint32
+	Info    uint32
+}
+
+type nlSocket struct {
+	fd  int
+	seq uint32
+}
+
+func newNlSocket() (*nlSocket, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netlink socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+	return &nlSocket{fd: fd}, nil
+}
+
+func (s *nlSocket) Close() error {
+	return unix.Close(s.fd)
+}
+
+// dump sends a dump request with the given header payload and collects payloads of all replies
+func (s *nlSocket) dump(msgType uint16, payload []byte) ([][]byte, error) {
+	s.seq++
+	header := unix.NlMsghdr{
+		Len:   uint32(unix.SizeofNlMsghdr + len(payload)),
+		Type:  msgType,
+		Flags: unix.NLM_F_REQUEST | unix.NLM_F_DUMP,
+		Seq:   s.seq,
+	}
+	request := make([]byte, header.Len)
+	*(*unix.NlMsghdr)(unsafe.Pointer(&request[0])) = header
+	copy(request[unix.SizeofNlMsghdr:], payload)
+	if err := unix.Sendto(s.fd, request, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	var result [][]byte
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := unix.Recvfrom(s.fd, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			if msg.Header.Seq != s.seq {
+				continue
+			}
+			switch msg.Header.Type {
+			case unix.NLMSG_DONE:
+				return result, nil
+			case unix.NLMSG_ERROR:
+				if len(msg.Data) < 4 {
+					return nil, errors.New("truncated netlink error")
+				}
+				errno := -int32(util.GetEndian().Uint32(msg.Data[:4]))
+				if errno == 0 {
+					return result, nil
+				}
+				return nil, syscall.Errno(errno)
+			}
+			if msg.Header.Type == msgType-2 {
+				// replies are RTM_NEW* for RTM_GET* requests, data is copied as the buffer is reused
+				result = append(result, append([]byte(nil), msg.Data...))
+			}
+		}
+	}
+}
+
+// parseAttrs parses netlink attributes, nested flag is dropped from types
+func parseAttrs(b []byte) map[uint16][]byte {
+	result := make(map[uint16][]byte)
+	for len(b) >= unix.SizeofRtAttr {
+		length := int(util.GetEndian().Uint16(b[0:2]))
+		attrType := util.GetEndian().Uint16(b[2:4]) &^ unix.NLA_F_NESTED
+		if length < unix.SizeofRtAttr || length > len(b) {
+			break
+		}
+		result[attrType] = b[unix.SizeofRtAttr:length]
+		aligned := (length + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+		if aligned > len(b) {
+			break
+		}
+		b = b[aligned:]
+	}
+	return result
+}
+
+func attrU32(attrs map[uint16][]byte, attrType uint16) (uint32, bool) {
+	value, ok := attrs[attrType]
+	if !ok || len(value) < 4 {
+		return 0, false
+	}
+	return util.GetEndian().Uint32(value[:4]), true
+}
+
+func attrString(attrs map[uint16][]byte, attrType uint16) string {
+	value := attrs[attrType]
+	for i, c := range value {
+		if c == 0 {
+			return string(value[:i])
+		}
+	}
+	return string(value)
+}
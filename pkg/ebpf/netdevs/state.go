@@ -0,0 +1,403 @@
+package netdevs
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// attach types of tcx, not known by cilium/ebpf yet
+const (
+	attachTCXIngress = 46
+	attachTCXEgress  = 47
+)
+
+type XDPAttachment struct {
+	Mode      XDPMode
+	ProgramID ebpf.ProgramID
+}
+
+// TCFilter is a cls_bpf filter of a clsact qdisc
+type TCFilter struct {
+	Direction Direction
+	ProgramID ebpf.ProgramID
+	// Name is usually a section name or a file name of the program
+	Name         string
+	Handle       uint32
+	Priority     uint16
+	Protocol     uint16
+	Chain        uint32
+	DirectAction bool
+}
+
+type TCXAttachment struct {
+	Direction Direction
+	ProgramID ebpf.ProgramID
+	// LinkID is 0 if the program is attached without a link
+	LinkID uint32
+}
+
+type InterfaceInfo struct {
+	Ifindex int
+	Name    string
+	// NetnsIno is an inode number of the network namespace of the interface
+	NetnsIno uint64
+	// IsAgentNetns is true for interfaces in the network namespace of the agent
+	IsAgentNetns bool
+	XDP          []*XDPAttachment
+	TC           []*TCFilter
+	TCX          []*TCXAttachment
+}
+
+// ProgramIDs lists programs attached to the interface in any way
+func (ii *InterfaceInfo) ProgramIDs() []ebpf.ProgramID {
+	var result []ebpf.ProgramID
+	for _, xdp := range ii.XDP {
+		result = append(result, xdp.ProgramID)
+	}
+	for _, filter := range ii.TC {
+		result = append(result, filter.ProgramID)
+	}
+	for _, tcx := range ii.TCX {
+		result = append(result, tcx.ProgramID)
+	}
+	return result
+}
+
+type InterfaceWatcher interface {
+	Run(ctx context.Context, refreshInterval time.Duration)
+	GetInterfaces() ([]*InterfaceInfo, error)
+}
+
+type interfaceWatcher struct {
+	log zerolog.Logger
+	// mu guards results of the last fetch, they are replaced by the watcher while queries read them
+	mu          sync.RWMutex
+	interfaces  []*InterfaceInfo
+	error       error
+	isRunning   bool
+	procDirName string
+}
+
+func NewWatcher(logger zerolog.Logger) InterfaceWatcher {
+	return &interfaceWatcher{
+		log:         logger,
+		procDirName: "/proc",
+	}
+}
+
+func (iw *interfaceWatcher) Run(ctx context.Context, refreshInterval time.Duration) {
+	if iw.isRunning {
+		return
+	}
+	go func() {
+		iw.isRunning = true
+		ticker := time.NewTicker(refreshInterval)
+		for {
+			select {
+			case <-ticker.C:
+				interfaces, err := iw.fetchInterfaces()
+				iw.mu.Lock()
+				iw.interfaces, iw.error = interfaces, err
+				iw.mu.Unlock()
+			case <-ctx.Done():
+				iw.isRunning = false
+				return
+			}
+		}
+	}()
+}
+
+func (iw *interfaceWatcher) GetInterfaces() ([]*InterfaceInfo, error) {
+	iw.mu.RLock()
+	interfaces, err := iw.interfaces, iw.error
+	iw.mu.RUnlock()
+	if interfaces == nil && err == nil {
+		return iw.fetchInterfaces()
+	}
+	return interfaces, err
+}
+
+func (iw *interfaceWatcher) fetchInterfaces() ([]*InterfaceInfo, error) {
+	iw.log.Debug().Msg("fetching interfaces")
+
+	ownNetns, err := netnsIno(iw.procDirName + "/self/ns/net")
+	if err != nil {
+		return nil, err
+	}
+	interfaces, err := scanNetns(ownNetns)
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range interfaces {
+		iface.IsAgentNetns = true
+	}
+
+	for ino, path := range iw.otherNetns(ownNetns) {
+		var nsInterfaces []*InterfaceInfo
+		err := inNetns(path, func() error {
+			var err error
+			nsInterfaces, err = scanNetns(ino)
+			return err
+		})
+		if err != nil {
+			// the namespace could have gone already
+			iw.log.Debug().Err(err).Msgf("failed to scan network namespace %s", path)
+			continue
+		}
+		interfaces = append(interfaces, nsInterfaces...)
+	}
+
+	sort.SliceStable(interfaces, func(i, j int) bool {
+		if interfaces[i].NetnsIno != interfaces[j].NetnsIno {
+			return interfaces[i].NetnsIno == ownNetns
+		}
+		return interfaces[i].Ifindex < interfaces[j].Ifindex
+	})
+	return interfaces, nil
+}
+
+// otherNetns finds network namespaces of running processes, mapping inode to a path of the namespace
+func (iw *interfaceWatcher) otherNetns(ownNetns uint64) map[uint64]string {
+	result := make(map[uint64]string)
+	procDir, err := os.ReadDir(iw.procDirName)
+	if err != nil {
+		return result
+	}
+	for _, entry := range procDir {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		path := iw.procDirName + "/" + entry.Name() + "/ns/net"
+		ino, err := netnsIno(path)
+		if err != nil || ino == ownNetns {
+			continue
+		}
+		if _, ok := result[ino]; !ok {
+			result[ino] = path
+		}
+	}
+	return result
+}
+
+func netnsIno(path string) (uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, errors.New("unexpected stat of " + path)
+	}
+	return stat.Ino, nil
+}
+
+// inNetns runs fn on a thread switched to the network namespace at path
+func inNetns(path string, fn func() error) error {
+	result := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		origNetns, err := os.Open("/proc/thread-self/ns/net")
+		if err != nil {
+			runtime.UnlockOSThread()
+			result <- err
+			return
+		}
+		defer origNetns.Close()
+		netns, err := os.Open(path)
+		if err != nil {
+			runtime.UnlockOSThread()
+			result <- err
+			return
+		}
+		defer netns.Close()
+
+		if err := unix.Setns(int(netns.Fd()), unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			result <- fmt.Errorf("setns failed: %w", err)
+			return
+		}
+		fnErr := fn()
+		if err := unix.Setns(int(origNetns.Fd()), unix.CLONE_NEWNET); err != nil {
+			// the thread is left locked, so it's terminated along with the goroutine
+			result <- fmt.Errorf("failed to restore network namespace: %w", err)
+			return
+		}
+		runtime.UnlockOSThread()
+		result <- fnErr
+	}()
+	return <-result
+}
+
+// scanNetns lists interfaces and their attachments in the network namespace of the current thread
+func scanNetns(ino uint64) ([]*InterfaceInfo, error) {
+	sock, err := newNlSocket()
+	if err != nil {
+		return nil, err
+	}
+	defer sock.Close()
+
+	ifinfo := make([]byte, unix.SizeofIfInfomsg)
+	ifinfo[0] = unix.AF_UNSPEC
+	msgs, err := sock.dump(unix.RTM_GETLINK, ifinfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+
+	var result []*InterfaceInfo
+	for _, msg := range msgs {
+		if len(msg) < unix.SizeofIfInfomsg {
+			continue
+		}
+		header := (*unix.IfInfomsg)(unsafe.Pointer(&msg[0]))
+		attrs := parseAttrs(msg[unix.SizeofIfInfomsg:])
+		iface := &InterfaceInfo{
+			Ifindex:  int(header.Index),
+			Name:     attrString(attrs, unix.IFLA_IFNAME),
+			NetnsIno: ino,
+			XDP:      parseXDP(attrs[unix.IFLA_XDP]),
+			TC:       []*TCFilter{},
+			TCX:      []*TCXAttachment{},
+		}
+		for _, direction := range []Direction{Ingress, Egress} {
+			filters, err := dumpTCFilters(sock, iface.Ifindex, direction)
+			if err == nil {
+				iface.TC = append(iface.TC, filters...)
+			}
+			tcx, err := queryTCX(iface.Ifindex, direction)
+			if err == nil {
+				iface.TCX = append(iface.TCX, tcx...)
+			}
+		}
+		result = append(result, iface)
+	}
+	return result, nil
+}
+
+func parseXDP(raw []byte) []*XDPAttachment {
+	result := []*XDPAttachment{}
+	if raw == nil {
+		return result
+	}
+	attrs := parseAttrs(raw)
+	mode := XDPModeNone
+	if value, ok := attrs[unix.IFLA_XDP_ATTACHED]; ok && len(value) > 0 {
+		mode = XDPMode(value[0])
+	}
+	switch mode {
+	case XDPModeNone:
+	case XDPModeMulti:
+		for attrType, attachMode := range map[uint16]XDPMode{
+			unix.IFLA_XDP_DRV_PROG_ID: XDPModeDriver,
+			unix.IFLA_XDP_SKB_PROG_ID: XDPModeGeneric,
+			unix.IFLA_XDP_HW_PROG_ID:  XDPModeOffload,
+		} {
+			if id, ok := attrU32(attrs, attrType); ok {
+				result = append(result, &XDPAttachment{Mode: attachMode, ProgramID: ebpf.ProgramID(id)})
+			}
+		}
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].Mode < result[j].Mode
+		})
+	default:
+		if id, ok := attrU32(attrs, unix.IFLA_XDP_PROG_ID); ok {
+			result = append(result, &XDPAttachment{Mode: mode, ProgramID: ebpf.ProgramID(id)})
+		}
+	}
+	return result
+}
+
+func dumpTCFilters(sock *nlSocket, ifindex int, direction Direction) ([]*TCFilter, error) {
+	request := tcMsg{
+		Family:  unix.AF_UNSPEC,
+		Ifindex: int32(ifindex),
+		Parent:  tcParentIngress,
+	}
+	if direction == Egress {
+		request.Parent = tcParentEgress
+	}
+	payload := (*[unsafe.Sizeof(tcMsg{})]byte)(unsafe.Pointer(&request))[:]
+	// fails if there is no clsact qdisc on the interface
+	msgs, err := sock.dump(unix.RTM_GETTFILTER, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*TCFilter
+	for _, msg := range msgs {
+		if len(msg) < int(unsafe.Sizeof(tcMsg{})) {
+			continue
+		}
+		header := (*tcMsg)(unsafe.Pointer(&msg[0]))
+		attrs := parseAttrs(msg[unsafe.Sizeof(tcMsg{}):])
+		if attrString(attrs, tcaKind) != "bpf" {
+			continue
+		}
+		options := parseAttrs(attrs[tcaOptions])
+		id, ok := attrU32(options, tcaBpfID)
+		if !ok {
+			// a record of the filter chain itself rather than of a filter
+			continue
+		}
+		filter := &TCFilter{
+			Direction: direction,
+			ProgramID: ebpf.ProgramID(id),
+			Name:      attrString(options, tcaBpfName),
+			Handle:    header.Handle,
+			Priority:  uint16(header.Info >> 16),
+			Protocol:  networkToHost(uint16(header.Info)),
+		}
+		if chain, ok := attrU32(attrs, tcaChain); ok {
+			filter.Chain = chain
+		}
+		if flags, ok := attrU32(options, tcaBpfFlags); ok {
+			filter.DirectAction = flags&tcaBpfFlagActDirect != 0
+		}
+		result = append(result, filter)
+	}
+	return result, nil
+}
+
+func networkToHost(value uint16) uint16 {
+	var raw [2]byte
+	util.GetEndian().PutUint16(raw[:], value)
+	return binary.BigEndian.Uint16(raw[:])
+}
+
+func queryTCX(ifindex int, direction Direction) ([]*TCXAttachment, error) {
+	attachType := uint32(attachTCXIngress)
+	if direction == Egress {
+		attachType = attachTCXEgress
+	}
+	// fails on kernels without tcx (before 6.6)
+	query, err := util.ProgQuery(uint32(ifindex), attachType, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	var result []*TCXAttachment
+	for i, id := range query.ProgIDs {
+		attachment := &TCXAttachment{
+			Direction: direction,
+			ProgramID: ebpf.ProgramID(id),
+		}
+		if i < len(query.LinkIDs) {
+			attachment.LinkID = query.LinkIDs[i]
+		}
+		result = append(result, attachment)
+	}
+	return result, nil
+}
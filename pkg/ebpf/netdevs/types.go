@@ -0,0 +1,22 @@
+package netdevs
+
+//go:generate stringer -output types_string.go -type=XDPMode -trimprefix=XDPMode
+
+// XDPMode mirrors XDP_ATTACHED_* values of IFLA_XDP_ATTACHED
+type XDPMode uint8
+
+const (
+	XDPModeNone XDPMode = iota
+	XDPModeDriver
+	XDPModeGeneric
+	XDPModeOffload
+	// XDPModeMulti means programs are attached in several modes at once
+	XDPModeMulti
+)
+
+type Direction string
+
+const (
+	Ingress Direction = "ingress"
+	Egress  Direction = "egress"
+)
@@ -0,0 +1,27 @@
+// Code generated by "stringer -output types_string.go -type=XDPMode -trimprefix=XDPMode"; DO NOT EDIT.
+
+package netdevs
+
+import "strconv"
+
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[XDPModeNone-0]
+	_ = x[XDPModeDriver-1]
+	_ = x[XDPModeGeneric-2]
+	_ = x[XDPModeOffload-3]
+	_ = x[XDPModeMulti-4]
+}
+
+const _XDPMode_name = "NoneDriverGenericOffloadMulti"
+
+var _XDPMode_index = [...]uint8{0, 4, 10, 17, 24, 29}
+
+func (i XDPMode) String() string {
+	if i >= XDPMode(len(_XDPMode_index)-1) {
+		return "XDPMode(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _XDPMode_name[_XDPMode_index[i]:_XDPMode_index[i+1]]
+}
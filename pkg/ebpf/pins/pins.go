@@ -0,0 +1,102 @@
+package pins
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"golang.org/x/sys/unix"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+type ObjectType string
+
+const (
+	ObjectTypeProgram ObjectType = "prog"
+	ObjectTypeMap     ObjectType = "map"
+	ObjectTypeLink    ObjectType = "link"
+)
+
+// PinnedObject is a BPF object pinned to bpffs
+type PinnedObject struct {
+	Path string
+	Type ObjectType
+	ID   uint32
+}
+
+// bpfObjInfoHeader is a common prefix of bpf_prog_info, bpf_map_info and bpf_link_info
+type bpfObjInfoHeader struct {
+	Type uint32
+	ID   uint32
+}
+
+// Inspect resolves type and ID of an object pinned to the path
+func Inspect(path string) (*PinnedObject, error) {
+	if err := checkBpffs(path); err != nil {
+		return nil, err
+	}
+	fd, err := util.ObjGet(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pinned object %s: %w", path, err)
+	}
+	defer unix.Close(fd)
+
+	// anon inode name of the fd tells the object kind, e.g. anon_inode:bpf-map
+	target, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(fd))
+	if err != nil {
+		return nil, err
+	}
+	result := &PinnedObject{Path: path}
+	switch {
+	case strings.HasSuffix(target, "bpf-prog"):
+		result.Type = ObjectTypeProgram
+	case strings.HasSuffix(target, "bpf-map"):
+		result.Type = ObjectTypeMap
+	case strings.HasSuffix(target, "bpf_link"), strings.HasSuffix(target, "bpf-link"):
+		result.Type = ObjectTypeLink
+	default:
+		return nil, fmt.Errorf("unsupported pinned object %s", target)
+	}
+
+	var header bpfObjInfoHeader
+	if err := util.ObjGetInfoByFD(fd, unsafe.Pointer(&header), unsafe.Sizeof(header)); err != nil {
+		return nil, err
+	}
+	result.ID = header.ID
+	return result, nil
+}
+
+// Unpin removes a pin, the object is destroyed by the kernel if it has no other references
+func Unpin(path string) error {
+	if err := checkBpffs(path); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// CheckPinPath verifies that an object can be pinned to the path: it's on bpffs and doesn't exist yet
+func CheckPinPath(path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	dir := path[:strings.LastIndex(path, "/")+1]
+	if dir == "" {
+		return errors.New("path must be absolute")
+	}
+	return checkBpffs(dir)
+}
+
+func checkBpffs(path string) error {
+	var statfs unix.Statfs_t
+	if err := unix.Statfs(path, &statfs); err != nil {
+		return err
+	}
+	if uint32(statfs.Type) != unix.BPF_FS_MAGIC {
+		return fmt.Errorf("%s is not on bpf filesystem", path)
+	}
+	return nil
+}
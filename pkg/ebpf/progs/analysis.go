@@ -0,0 +1,103 @@
+package progs
+
+import (
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"sort"
+	"strings"
+)
+
+// DefaultDangerousHelpers are helpers that allow a program to modify behaviour of the system beyond observing it
+var DefaultDangerousHelpers = []string{
+	"bpf_probe_write_user",
+	"bpf_override_return",
+	"bpf_send_signal",
+	"bpf_send_signal_thread",
+	"bpf_sys_bpf",
+	"bpf_sys_close",
+}
+
+type FunctionUsage struct {
+	Name  string
+	Count int
+}
+
+type CallsAnalysis struct {
+	Helpers []*FunctionUsage
+	Kfuncs  []*FunctionUsage
+	// Unresolved is a number of calls which targets couldn't be resolved, e.g. if /proc/kallsyms can't be read
+	// or kernel.kptr_restrict hides call addresses in xlated instructions; they are listed as unknown#imm,
+	// so any helper may be among them
+	Unresolved int
+}
+
+// AnalyzeCalls counts calls of helpers and kernel functions (kfuncs) made by a program
+func AnalyzeCalls(info *ebpf.ProgramInfo) (*CallsAnalysis, error) {
+	insns, err := decodeInstructions(info, false)
+	if err != nil {
+		return nil, err
+	}
+
+	helpers := make(map[string]int)
+	kfuncs := make(map[string]int)
+	unresolved := 0
+	for _, ins := range insns {
+		if !ins.OpCode.Class().IsJump() || ins.OpCode.JumpOp() != asm.Call || ins.Src == asm.PseudoCall {
+			continue
+		}
+		name := ins.Function
+		if name == "" {
+			name = fmt.Sprintf("unknown#%d", ins.Imm)
+			unresolved++
+		}
+		if ins.Src == pseudoKfuncCall {
+			kfuncs[name]++
+		} else {
+			helpers[name]++
+		}
+	}
+
+	return &CallsAnalysis{
+		Helpers:    usageList(helpers),
+		Kfuncs:     usageList(kfuncs),
+		Unresolved: unresolved,
+	}, nil
+}
+
+// Uses returns usage of a helper or a kfunc by name, `bpf_` prefix of helpers may be omitted
+func (ca *CallsAnalysis) Uses(name string) (*FunctionUsage, bool) {
+	for _, usages := range [][]*FunctionUsage{ca.Helpers, ca.Kfuncs} {
+		for _, usage := range usages {
+			if usage.Name == name || usage.Name == "bpf_"+name {
+				return usage, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Dangerous returns used helpers from the given list
+func (ca *CallsAnalysis) Dangerous(dangerousHelpers []string) []*FunctionUsage {
+	var result []*FunctionUsage
+	for _, name := range dangerousHelpers {
+		if usage, ok := ca.Uses(strings.TrimSpace(name)); ok {
+			result = append(result, usage)
+		}
+	}
+	return result
+}
+
+func usageList(counts map[string]int) []*FunctionUsage {
+	result := make([]*FunctionUsage, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, &FunctionUsage{Name: name, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
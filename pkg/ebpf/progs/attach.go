@@ -0,0 +1,102 @@
+package progs
+
+import (
+	"errors"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/btfs"
+	"os"
+	"strings"
+)
+
+// AttachTarget is what a tracing (fentry, fexit, fmod_ret, tp_btf, lsm, iter) or an extension (freplace) program
+// was loaded for, it's described by a BTF ID of a kernel function or of a function of another program
+type AttachTarget struct {
+	BtfObjID uint32
+	BtfID    uint32
+	// Function is a kernel function, a tracepoint of tp_btf programs or a function of the target program
+	Function string
+	// Module is a kernel module of the function, it's empty for functions of the kernel image
+	Module string
+	// IsKernel is false if the target is a function of a BPF program
+	IsKernel bool
+	// TargetProgramIDs are programs the function belongs to, set if the target is not a kernel function
+	TargetProgramIDs []ebpf.ProgramID
+}
+
+// GetAttachTarget resolves the attach BTF ID of a program, it returns nil if the program doesn't have one
+func GetAttachTarget(id ebpf.ProgramID) (*AttachTarget, error) {
+	prog, err := ebpf.NewProgramFromID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer prog.Close()
+
+	var info bpfProgInfo
+	if err := getProgInfo(prog.FD(), &info); err != nil {
+		return nil, err
+	}
+	if info.AttachBtfID == 0 {
+		return nil, nil
+	}
+	result := &AttachTarget{
+		BtfObjID: info.AttachBtfObjID,
+		BtfID:    info.AttachBtfID,
+	}
+
+	btfObjID := info.AttachBtfObjID
+	if btfObjID == 0 {
+		// kernels before 5.11 don't report the object, the ID refers to vmlinux then
+		btfObjID, err = btfs.VmlinuxID()
+		if err != nil {
+			return result, err
+		}
+	}
+	spec, btfInfo, err := btfs.LoadSpec(btfObjID)
+	if err != nil {
+		return result, err
+	}
+	result.IsKernel = btfInfo.IsKernel
+	if btfInfo.IsModule() {
+		result.Module = btfInfo.Name
+	}
+	if !result.IsKernel {
+		result.TargetProgramIDs, err = programsWithBtf(btfObjID)
+		if err != nil {
+			return result, err
+		}
+	}
+	typ, err := spec.TypeByID(btf.TypeID(info.AttachBtfID))
+	if err != nil {
+		return result, err
+	}
+	// tp_btf programs refer to typedefs of tracepoints, e.g. btf_trace_sched_switch
+	result.Function = strings.TrimPrefix(typ.TypeName(), "btf_trace_")
+	return result, nil
+}
+
+// programsWithBtf finds programs loaded with the BTF object
+func programsWithBtf(btfObjID uint32) ([]ebpf.ProgramID, error) {
+	var result []ebpf.ProgramID
+	var id ebpf.ProgramID
+	for {
+		var err error
+		id, err = ebpf.ProgramGetNextID(id)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return result, nil
+			}
+			return result, err
+		}
+		prog, err := ebpf.NewProgramFromID(id)
+		if err != nil {
+			continue
+		}
+		var info bpfProgInfo
+		err = getProgInfo(prog.FD(), &info)
+		prog.Close()
+		if err == nil && info.BtfID == btfObjID {
+			result = append(result, id)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package progs
+
+import (
+	"fmt"
+	"github.com/cilium/ebpf/asm"
+	"strings"
+	"unicode"
+)
+
+// Instruction disassembler, mimics kernel/bpf/disasm.c (which is also used by bpftool)
+
+const (
+	classLd    = 0x00
+	classLdx   = 0x01
+	classSt    = 0x02
+	classStx   = 0x03
+	classAlu   = 0x04
+	classJmp   = 0x05
+	classJmp32 = 0x06
+	classAlu64 = 0x07
+
+	modeImm    = 0x00
+	modeAbs    = 0x20
+	modeInd    = 0x40
+	modeMem    = 0x60
+	modeMemSX  = 0x80
+	modeAtomic = 0xc0
+
+	sizeW  = 0x00
+	sizeH  = 0x08
+	sizeB  = 0x10
+	sizeDW = 0x18
+
+	srcX = 0x08
+
+	aluDiv = 0x30
+	aluNeg = 0x80
+	aluMod = 0x90
+	aluMov = 0xb0
+	aluEnd = 0xd0
+
+	jmpJa   = 0x00
+	jmpCall = 0x80
+	jmpExit = 0x90
+
+	atomicFetch   = 0x01
+	atomicXchg    = 0xe0 | atomicFetch
+	atomicCmpXchg = 0xf0 | atomicFetch
+
+	pseudoMapFD       = 1
+	pseudoMapValue    = 2
+	pseudoBTFID       = 3
+	pseudoFunc        = 4
+	pseudoMapIdx      = 5
+	pseudoMapIdxValue = 6
+	pseudoCall        = 1
+	pseudoKfuncCall   = 2
+
+	// BPF_NOSPEC
+	modeNoSpec = 0xc0
+)
+
+var aluStrings = [16]string{"+=", "-=", "*=", "/=", "|=", "&=", "<<=", ">>=", "neg", "%=", "^=", "=", "s>>=", "endian", "???", "???"}
+
+var atomicAluStrings = [16]string{"add", "", "", "", "or", "and", "", "", "", "", "xor", "", "", "", "", ""}
+
+var jmpStrings = [16]string{"jmp", "==", ">", ">=", "&", "!=", "s>", "s>=", "call", "exit", "<", "<=", "s<", "s<=", "???", "???"}
+
+var ldstStrings = map[uint8]string{sizeW: "u32", sizeH: "u16", sizeB: "u8", sizeDW: "u64"}
+
+// disasmCallbacks resolves program-specific parts of instructions
+type disasmCallbacks struct {
+	// call returns a name of called helper, kfunc or bpf-to-bpf function (may be empty)
+	call func(ins *asm.Instruction) string
+	// imm returns a representation of 64-bit immediate load (may be empty)
+	imm func(ins *asm.Instruction) string
+}
+
+// HelperName returns kernel's name of a helper function by its ID, e.g. bpf_map_lookup_elem
+func HelperName(id asm.BuiltinFunc) (string, bool) {
+	if id <= 0 || id > id.Max() {
+		return "", false
+	}
+	name := id.String()
+	if !strings.HasPrefix(name, "Fn") {
+		return "", false
+	}
+	var sb strings.Builder
+	sb.WriteString("bpf")
+	for _, r := range name[2:] {
+		if unicode.IsUpper(r) {
+			sb.WriteRune('_')
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String(), true
+}
+
+// callName resolves a called function. In xlated programs imm of a helper call is an offset from __bpf_call_base,
+// not a helper ID, so it's resolved with kallsyms first; the table of helper IDs is only used for tail calls,
+// which the verifier leaves as ID 12, and when kallsyms can't resolve the call
+func callName(ins *asm.Instruction, cb *disasmCallbacks) string {
+	imm := int32(ins.Constant)
+	if ins.Src == 0 && imm == int32(asm.FnTailCall) {
+		name, _ := HelperName(asm.FnTailCall)
+		return name
+	}
+	name := ""
+	if cb != nil && cb.call != nil {
+		name = cb.call(ins)
+	}
+	if name == "" && ins.Src == 0 && imm >= 0 {
+		name, _ = HelperName(asm.BuiltinFunc(imm))
+	}
+	return name
+}
+
+func regPrefix(is32 bool) byte {
+	if is32 {
+		return 'w'
+	}
+	return 'r'
+}
+
+func formatInstruction(ins *asm.Instruction, cb *disasmCallbacks) string {
+	code := uint8(ins.OpCode)
+	class := code & 0x07
+	mode := code & 0xe0
+	size := code & 0x18
+	op := code & 0xf0
+	dst := uint8(ins.Dst)
+	src := uint8(ins.Src)
+	off := ins.Offset
+	imm := int32(ins.Constant)
+
+	switch class {
+	case classAlu, classAlu64:
+		r := regPrefix(class == classAlu)
+		switch {
+		case op == aluEnd:
+			endianness := "le"
+			if code&srcX != 0 {
+				endianness = "be"
+			}
+			if class == classAlu64 {
+				endianness = "bswap"
+			}
+			return fmt.Sprintf("(%02x) %c%d = %s%d %c%d", code, r, dst, endianness, imm, r, dst)
+		case op == aluNeg:
+			return fmt.Sprintf("(%02x) %c%d = -%c%d", code, r, dst, r, dst)
+		case code&srcX != 0:
+			if op == aluMov && off != 0 {
+				return fmt.Sprintf("(%02x) %c%d = (s%d)%c%d", code, r, dst, off, r, src)
+			}
+			opString := aluStrings[op>>4]
+			if (op == aluDiv || op == aluMod) && off == 1 {
+				opString = "s" + opString
+			}
+			return fmt.Sprintf("(%02x) %c%d %s %c%d", code, r, dst, opString, r, src)
+		default:
+			opString := aluStrings[op>>4]
+			if (op == aluDiv || op == aluMod) && off == 1 {
+				opString = "s" + opString
+			}
+			return fmt.Sprintf("(%02x) %c%d %s %d", code, r, dst, opString, imm)
+		}
+	case classStx:
+		width, typ := "", "u32"
+		if size == sizeDW {
+			width, typ = "64", "u64"
+		}
+		switch {
+		case mode == modeMem:
+			return fmt.Sprintf("(%02x) *(%s *)(r%d %+d) = r%d", code, ldstStrings[size], dst, off, src)
+		case mode == modeAtomic && (imm&0xf0 == 0x00 || imm&0xf0 == 0x40 || imm&0xf0 == 0x50 || imm&0xf0 == 0xa0) && imm&atomicFetch == 0:
+			return fmt.Sprintf("(%02x) lock *(%s *)(r%d %+d) %s r%d", code, typ, dst, off, aluStrings[(imm&0xf0)>>4], src)
+		case mode == modeAtomic && imm == atomicCmpXchg:
+			return fmt.Sprintf("(%02x) r0 = atomic%s_cmpxchg((%s *)(r%d %+d), r0, r%d)", code, width, typ, dst, off, src)
+		case mode == modeAtomic && imm == atomicXchg:
+			return fmt.Sprintf("(%02x) r%d = atomic%s_xchg((%s *)(r%d %+d), r%d)", code, src, width, typ, dst, off, src)
+		case mode == modeAtomic && imm&atomicFetch != 0 && atomicAluStrings[(imm&0xf0)>>4] != "":
+			return fmt.Sprintf("(%02x) r%d = atomic%s_fetch_%s((%s *)(r%d %+d), r%d)", code, src, width, atomicAluStrings[(imm&0xf0)>>4], typ, dst, off, src)
+		}
+		return fmt.Sprintf("BUG_%02x", code)
+	case classSt:
+		switch mode {
+		case modeMem:
+			return fmt.Sprintf("(%02x) *(%s *)(r%d %+d) = %d", code, ldstStrings[size], dst, off, imm)
+		case modeNoSpec:
+			return fmt.Sprintf("(%02x) nospec", code)
+		}
+		return fmt.Sprintf("BUG_st_%02x", code)
+	case classLdx:
+		switch mode {
+		case modeMem:
+			return fmt.Sprintf("(%02x) r%d = *(%s *)(r%d %+d)", code, dst, ldstStrings[size], src, off)
+		case modeMemSX:
+			return fmt.Sprintf("(%02x) r%d = *(s%s *)(r%d %+d)", code, dst, ldstStrings[size][1:], src, off)
+		}
+		return fmt.Sprintf("BUG_ldx_%02x", code)
+	case classLd:
+		switch mode {
+		case modeAbs:
+			return fmt.Sprintf("(%02x) r0 = *(%s *)skb[%d]", code, ldstStrings[size], imm)
+		case modeInd:
+			return fmt.Sprintf("(%02x) r0 = *(%s *)skb[r%d + %d]", code, ldstStrings[size], src, imm)
+		case modeImm:
+			if size != sizeDW {
+				break
+			}
+			value := ""
+			if cb != nil && cb.imm != nil {
+				value = cb.imm(ins)
+			}
+			if value == "" {
+				value = fmt.Sprintf("0x%x", uint64(ins.Constant))
+			}
+			return fmt.Sprintf("(%02x) r%d = %s", code, dst, value)
+		}
+		return fmt.Sprintf("BUG_ld_%02x", code)
+	case classJmp, classJmp32:
+		r := regPrefix(class == classJmp32)
+		switch {
+		case op == jmpCall:
+			name := callName(ins, cb)
+			if src == pseudoCall {
+				if name != "" {
+					return fmt.Sprintf("(%02x) call pc%+d#%s", code, imm, name)
+				}
+				return fmt.Sprintf("(%02x) call pc%+d", code, imm)
+			}
+			if name == "" {
+				name = "unknown"
+				if src == pseudoKfuncCall {
+					name = "kernel-function"
+				}
+			}
+			return fmt.Sprintf("(%02x) call %s#%d", code, name, imm)
+		case code == classJmp|jmpJa:
+			return fmt.Sprintf("(%02x) goto pc%+d", code, off)
+		case code == classJmp32|jmpJa:
+			return fmt.Sprintf("(%02x) gotol pc%+d", code, imm)
+		case op == jmpExit:
+			return fmt.Sprintf("(%02x) exit", code)
+		case code&srcX != 0:
+			return fmt.Sprintf("(%02x) if %c%d %s %c%d goto pc%+d", code, r, dst, jmpStrings[op>>4], r, src, off)
+		default:
+			return fmt.Sprintf("(%02x) if %c%d %s 0x%x goto pc%+d", code, r, dst, jmpStrings[op>>4], uint32(imm), off)
+		}
+	}
+	return fmt.Sprintf("(%02x) unknown opcode %02x", code, code)
+}
@@ -0,0 +1,67 @@
+package progs
+
+import (
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"unsafe"
+)
+
+// bpfProgInfo mirrors struct bpf_prog_info, it provides fields that are not exposed by ebpf.ProgramInfo
+type bpfProgInfo struct {
+	Type                 uint32
+	ID                   uint32
+	Tag                  [8]uint8
+	JitedProgLen         uint32
+	XlatedProgLen        uint32
+	JitedProgInsns       uint64
+	XlatedProgInsns      uint64
+	LoadTime             uint64
+	CreatedByUID         uint32
+	NrMapIDs             uint32
+	MapIDs               uint64
+	Name                 [16]byte
+	Ifindex              uint32
+	GplCompatible        uint32
+	NetnsDev             uint64
+	NetnsIno             uint64
+	NrJitedKsyms         uint32
+	NrJitedFuncLens      uint32
+	JitedKsyms           uint64
+	JitedFuncLens        uint64
+	BtfID                uint32
+	FuncInfoRecSize      uint32
+	FuncInfo             uint64
+	NrFuncInfo           uint32
+	NrLineInfo           uint32
+	LineInfo             uint64
+	JitedLineInfo        uint64
+	NrJitedLineInfo      uint32
+	LineInfoRecSize      uint32
+	JitedLineInfoRecSize uint32
+	NrProgTags           uint32
+	ProgTags             uint64
+	RunTimeNs            uint64
+	RunCnt               uint64
+	RecursionMisses      uint64
+	VerifiedInsns        uint32
+	AttachBtfObjID       uint32
+	AttachBtfID          uint32
+	_                    [4]byte
+}
+
+func getProgInfo(fd int, info *bpfProgInfo) error {
+	return util.ObjGetInfoByFD(fd, unsafe.Pointer(info), unsafe.Sizeof(*info))
+}
+
+// bpfBtfInfo mirrors struct bpf_btf_info
+type bpfBtfInfo struct {
+	Btf       uint64
+	BtfSize   uint32
+	ID        uint32
+	Name      uint64
+	NameLen   uint32
+	KernelBtf uint32
+}
+
+func getBtfInfo(fd int, info *bpfBtfInfo) error {
+	return util.ObjGetInfoByFD(fd, unsafe.Pointer(info), unsafe.Sizeof(*info))
+}
@@ -0,0 +1,145 @@
+package progs
+
+import (
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/ksyms"
+	"strings"
+)
+
+type Instruction struct {
+	// Offset in raw instructions (8 bytes), as shown by bpftool
+	Offset   int
+	OpCode   asm.OpCode
+	Dst      asm.Register
+	Src      asm.Register
+	Off      int16
+	Imm      int64
+	MapID    ebpf.MapID
+	MapName  string
+	Function string
+	Text     string
+}
+
+// GetInstructions decodes xlated instructions of a program,
+// resolving map references and called functions
+func GetInstructions(info *ebpf.ProgramInfo) ([]*Instruction, error) {
+	return decodeInstructions(info, true)
+}
+
+func decodeInstructions(info *ebpf.ProgramInfo, resolveMaps bool) ([]*Instruction, error) {
+	insns, err := info.Instructions()
+	if err != nil {
+		return nil, err
+	}
+
+	mapNames := make(map[ebpf.MapID]string)
+	mapName := func(id ebpf.MapID) string {
+		if !resolveMaps {
+			return ""
+		}
+		if name, ok := mapNames[id]; ok {
+			return name
+		}
+		name := ""
+		if emap, err := ebpf.NewMapFromID(id); err == nil {
+			if mapInfo, err := emap.Info(); err == nil {
+				name = mapInfo.Name
+			}
+			emap.Close()
+		}
+		mapNames[id] = name
+		return name
+	}
+
+	symbols, _ := ksyms.Default()
+	callBase, hasCallBase := uint64(0), false
+	if symbols != nil {
+		callBase, hasCallBase = symbols.Address("__bpf_call_base")
+	}
+
+	callbacks := &disasmCallbacks{
+		call: func(ins *asm.Instruction) string {
+			// imm is zeroed for processes which may not see kernel addresses (kernel.kptr_restrict)
+			if ins.Src == asm.PseudoCall || !hasCallBase || ins.Constant == 0 {
+				return ""
+			}
+			if symbol, ok := symbols.Exact(callBase + uint64(int64(int32(ins.Constant)))); ok {
+				return symbol.Name
+			}
+			return ""
+		},
+		imm: func(ins *asm.Instruction) string {
+			low := uint32(ins.Constant)
+			high := uint32(uint64(ins.Constant) >> 32)
+			switch ins.Src {
+			case pseudoMapFD:
+				return fmt.Sprintf("map[id:%d]", low)
+			case pseudoMapValue:
+				return fmt.Sprintf("map[id:%d][0]+%d", low, high)
+			case pseudoMapIdxValue:
+				return fmt.Sprintf("map[idx:%d]+%d", low, high)
+			case pseudoFunc:
+				return fmt.Sprintf("subprog[%+d]", int32(low))
+			}
+			return ""
+		},
+	}
+
+	result := make([]*Instruction, 0, len(insns))
+	iter := insns.Iterate()
+	for iter.Next() {
+		ins := iter.Ins
+		record := &Instruction{
+			Offset: int(iter.Offset),
+			OpCode: ins.OpCode,
+			Dst:    ins.Dst,
+			Src:    ins.Src,
+			Off:    ins.Offset,
+			Imm:    ins.Constant,
+			Text:   formatInstruction(ins, callbacks),
+		}
+		if ins.IsLoadFromMap() {
+			record.MapID = ebpf.MapID(uint32(ins.Constant))
+			record.MapName = mapName(record.MapID)
+		}
+		if ins.OpCode.JumpOp() == asm.Call && ins.OpCode.Class().IsJump() {
+			record.Function = callName(ins, callbacks)
+		}
+		result = append(result, record)
+	}
+	return result, nil
+}
+
+// Disassemble formats instructions like `bpftool prog dump xlated`,
+// function prototypes and source lines are interleaved if source is provided
+func Disassemble(insns []*Instruction, source *SourceInfo) string {
+	functions := make(map[int]*FuncInfo)
+	lines := make(map[int][]*LineInfo)
+	if source != nil {
+		for _, fn := range source.Functions {
+			functions[fn.Offset] = fn
+		}
+		for _, line := range source.Lines {
+			lines[line.Offset] = append(lines[line.Offset], line)
+		}
+	}
+
+	var sb strings.Builder
+	for _, ins := range insns {
+		if fn, ok := functions[ins.Offset]; ok {
+			if ins.Offset > 0 {
+				sb.WriteString("\n")
+			}
+			sb.WriteString(fmt.Sprintf("%s:\n", fn.Prototype))
+		}
+		for _, line := range lines[ins.Offset] {
+			if line.Text != "" {
+				sb.WriteString(fmt.Sprintf("; %s\n", line.Text))
+			}
+		}
+		sb.WriteString(fmt.Sprintf("%4d: %s\n", ins.Offset, ins.Text))
+	}
+	return sb.String()
+}
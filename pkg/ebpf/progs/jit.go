@@ -0,0 +1,167 @@
+package progs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/ksyms"
+	"golang.org/x/arch/x86/x86asm"
+	"runtime"
+	"strings"
+	"unsafe"
+)
+
+const maxSymbolOffset = 1 << 20
+
+type JitedFunction struct {
+	Address uint64
+	// Symbol is a kernel symbol name of the function, e.g. bpf_prog_6deef7357e7b4530_handler
+	Symbol string
+	Size   uint32
+}
+
+type JitedImage struct {
+	Functions []*JitedFunction
+	Image     []byte
+}
+
+// GetJitedImage reads JIT'ed functions of a program, and optionally the native code itself
+func GetJitedImage(id ebpf.ProgramID, withImage bool) (*JitedImage, error) {
+	prog, err := ebpf.NewProgramFromID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer prog.Close()
+
+	var info bpfProgInfo
+	if err := getProgInfo(prog.FD(), &info); err != nil {
+		return nil, err
+	}
+
+	result := &JitedImage{
+		Functions: []*JitedFunction{},
+	}
+	if info.JitedProgLen == 0 {
+		return result, nil
+	}
+
+	ksymsBuf := make([]uint64, info.NrJitedKsyms)
+	funcLensBuf := make([]uint32, info.NrJitedFuncLens)
+	// Start with a clean struct for the second call, otherwise we may get EFAULT.
+	info2 := bpfProgInfo{
+		NrJitedKsyms:    info.NrJitedKsyms,
+		NrJitedFuncLens: info.NrJitedFuncLens,
+	}
+	if len(ksymsBuf) > 0 {
+		info2.JitedKsyms = uint64(uintptr(unsafe.Pointer(&ksymsBuf[0])))
+	}
+	if len(funcLensBuf) > 0 {
+		info2.JitedFuncLens = uint64(uintptr(unsafe.Pointer(&funcLensBuf[0])))
+	}
+	if withImage {
+		result.Image = make([]byte, info.JitedProgLen)
+		info2.JitedProgLen = info.JitedProgLen
+		info2.JitedProgInsns = uint64(uintptr(unsafe.Pointer(&result.Image[0])))
+	}
+	if err := getProgInfo(prog.FD(), &info2); err != nil {
+		return nil, err
+	}
+	runtime.KeepAlive(ksymsBuf)
+	runtime.KeepAlive(funcLensBuf)
+	if withImage {
+		// kernel doesn't expose the image to processes without raw dump permissions
+		if info2.JitedProgLen == 0 {
+			return nil, errors.New("JIT'ed image is not available (missing CAP_SYS_ADMIN or kernel.kptr_restrict is set)")
+		}
+		result.Image = result.Image[:info2.JitedProgLen]
+	}
+
+	symbols, _ := ksyms.Default()
+	refreshed := false
+	for i, addr := range ksymsBuf {
+		fn := &JitedFunction{
+			Address: addr,
+		}
+		if i < len(funcLensBuf) {
+			fn.Size = funcLensBuf[i]
+		}
+		if addr != 0 {
+			symbol, ok := lookupExact(symbols, addr)
+			if !ok && !refreshed {
+				// symbols of programs loaded after the table was read are not there yet
+				symbols, _ = ksyms.Refresh()
+				refreshed = true
+				symbol, ok = lookupExact(symbols, addr)
+			}
+			if ok {
+				fn.Symbol = symbol.Name
+			}
+		}
+		result.Functions = append(result.Functions, fn)
+	}
+
+	return result, nil
+}
+
+func lookupExact(symbols *ksyms.Table, addr uint64) (*ksyms.Symbol, bool) {
+	if symbols == nil {
+		return nil, false
+	}
+	return symbols.Exact(addr)
+}
+
+// DisassembleJited formats native code of a program in GNU (AT&T) syntax, only x86-64 is supported
+func DisassembleJited(jited *JitedImage) (string, error) {
+	if runtime.GOARCH != "amd64" {
+		return "", fmt.Errorf("disassembling JIT'ed code is not supported on %s", runtime.GOARCH)
+	}
+	if len(jited.Image) == 0 {
+		return "", errors.New("JIT'ed image is empty")
+	}
+
+	functions := jited.Functions
+	if len(functions) == 0 {
+		functions = []*JitedFunction{{Size: uint32(len(jited.Image))}}
+	}
+	symbols, _ := ksyms.Default()
+	symname := func(addr uint64) (string, uint64) {
+		if symbols == nil {
+			return "", 0
+		}
+		// immediate values are resolved too, so far away symbols are ignored (e.g. for negative offsets)
+		if symbol, ok := symbols.Nearest(addr); ok && addr-symbol.Address < maxSymbolOffset {
+			return symbol.Name, symbol.Address
+		}
+		return "", 0
+	}
+
+	var sb strings.Builder
+	offset := 0
+	for i, fn := range functions {
+		end := offset + int(fn.Size)
+		if end > len(jited.Image) || i == len(functions)-1 {
+			end = len(jited.Image)
+		}
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		if fn.Symbol != "" {
+			sb.WriteString(fn.Symbol + ":\n")
+		}
+		code := jited.Image[offset:end]
+		for pc := 0; pc < len(code); {
+			inst, err := x86asm.Decode(code[pc:], 64)
+			text := ""
+			if err != nil || inst.Len == 0 {
+				inst.Len = 1
+				text = fmt.Sprintf("(bad) %02x", code[pc])
+			} else {
+				text = x86asm.GNUSyntax(inst, fn.Address+uint64(pc), symname)
+			}
+			sb.WriteString(fmt.Sprintf("%4x:\t%-24s\t%s\n", pc, fmt.Sprintf("% x", code[pc:pc+inst.Len]), text))
+			pc += inst.Len
+		}
+		offset = end
+	}
+	return sb.String(), nil
+}
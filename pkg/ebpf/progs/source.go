@@ -0,0 +1,229 @@
+package progs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/btfs"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// FuncInfo describes a function (main program or a subprogram) based on BTF func info
+type FuncInfo struct {
+	// Offset of the first instruction of the function
+	Offset    int
+	Name      string
+	Prototype string
+	// InstructionCount is a number of raw instructions until the next function
+	InstructionCount int
+}
+
+// LineInfo is a source line annotation based on BTF line info
+type LineInfo struct {
+	// Offset of the first instruction generated from the line
+	Offset int
+	File   string
+	Line   int
+	Column int
+	Text   string
+	// InstructionCount is a number of raw instructions until the next annotation
+	InstructionCount int
+}
+
+type SourceInfo struct {
+	Functions []*FuncInfo
+	Lines     []*LineInfo
+}
+
+type bpfFuncInfo struct {
+	InsnOff uint32
+	TypeID  uint32
+}
+
+type bpfLineInfo struct {
+	InsnOff     uint32
+	FileNameOff uint32
+	LineOff     uint32
+	LineCol     uint32
+}
+
+// GetSourceInfo reads BTF func info and line info of a program.
+// Returns an empty SourceInfo if the program was loaded without BTF.
+func GetSourceInfo(id ebpf.ProgramID) (*SourceInfo, error) {
+	prog, err := ebpf.NewProgramFromID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer prog.Close()
+
+	var info bpfProgInfo
+	if err := getProgInfo(prog.FD(), &info); err != nil {
+		return nil, err
+	}
+
+	result := &SourceInfo{
+		Functions: []*FuncInfo{},
+		Lines:     []*LineInfo{},
+	}
+	if info.BtfID == 0 || (info.NrFuncInfo == 0 && info.NrLineInfo == 0) {
+		return result, nil
+	}
+	if info.FuncInfoRecSize < uint32(unsafe.Sizeof(bpfFuncInfo{})) || info.LineInfoRecSize < uint32(unsafe.Sizeof(bpfLineInfo{})) {
+		return nil, errors.New("unsupported func info or line info record size")
+	}
+	totalInsns := int(info.XlatedProgLen / 8)
+
+	funcInfoBuf := make([]byte, info.NrFuncInfo*info.FuncInfoRecSize)
+	lineInfoBuf := make([]byte, info.NrLineInfo*info.LineInfoRecSize)
+	// Start with a clean struct for the second call, otherwise we may get EFAULT.
+	info2 := bpfProgInfo{
+		NrFuncInfo:      info.NrFuncInfo,
+		FuncInfoRecSize: info.FuncInfoRecSize,
+		NrLineInfo:      info.NrLineInfo,
+		LineInfoRecSize: info.LineInfoRecSize,
+	}
+	if len(funcInfoBuf) > 0 {
+		info2.FuncInfo = uint64(uintptr(unsafe.Pointer(&funcInfoBuf[0])))
+	}
+	if len(lineInfoBuf) > 0 {
+		info2.LineInfo = uint64(uintptr(unsafe.Pointer(&lineInfoBuf[0])))
+	}
+	if err := getProgInfo(prog.FD(), &info2); err != nil {
+		return nil, err
+	}
+
+	handle, err := btf.NewHandleFromID(btf.ID(info.BtfID))
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+
+	strtab, err := readBtfStrings(handle.FD())
+	if err != nil {
+		return nil, err
+	}
+	spec, err := handle.Spec()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := uint32(0); i < info.NrFuncInfo; i++ {
+		var record bpfFuncInfo
+		err := binary.Read(bytes.NewReader(funcInfoBuf[i*info.FuncInfoRecSize:]), util.GetEndian(), &record)
+		if err != nil {
+			return nil, err
+		}
+		funcInfo := &FuncInfo{
+			Offset: int(record.InsnOff),
+		}
+		if typ, err := spec.TypeByID(btf.TypeID(record.TypeID)); err == nil {
+			if fn, ok := typ.(*btf.Func); ok {
+				funcInfo.Name = fn.Name
+				funcInfo.Prototype = btfs.FuncPrototype(fn)
+			}
+		}
+		result.Functions = append(result.Functions, funcInfo)
+	}
+
+	for i := uint32(0); i < info.NrLineInfo; i++ {
+		var record bpfLineInfo
+		err := binary.Read(bytes.NewReader(lineInfoBuf[i*info.LineInfoRecSize:]), util.GetEndian(), &record)
+		if err != nil {
+			return nil, err
+		}
+		result.Lines = append(result.Lines, &LineInfo{
+			Offset: int(record.InsnOff),
+			File:   strtab.lookup(record.FileNameOff),
+			Line:   int(record.LineCol >> 10),
+			Column: int(record.LineCol & 0x3ff),
+			Text:   strings.TrimSpace(strtab.lookup(record.LineOff)),
+		})
+	}
+
+	sort.SliceStable(result.Functions, func(i, j int) bool {
+		return result.Functions[i].Offset < result.Functions[j].Offset
+	})
+	sort.SliceStable(result.Lines, func(i, j int) bool {
+		return result.Lines[i].Offset < result.Lines[j].Offset
+	})
+	for i, fn := range result.Functions {
+		next := totalInsns
+		if i+1 < len(result.Functions) {
+			next = result.Functions[i+1].Offset
+		}
+		fn.InstructionCount = next - fn.Offset
+	}
+	for i, line := range result.Lines {
+		next := totalInsns
+		if i+1 < len(result.Lines) {
+			next = result.Lines[i+1].Offset
+		}
+		line.InstructionCount = next - line.Offset
+	}
+
+	return result, nil
+}
+
+type btfStrings []byte
+
+func (s btfStrings) lookup(offset uint32) string {
+	if int(offset) >= len(s) {
+		return ""
+	}
+	str := s[offset:]
+	if end := bytes.IndexByte(str, 0); end >= 0 {
+		str = str[:end]
+	}
+	return string(str)
+}
+
+type btfHeader struct {
+	Magic   uint16
+	Version uint8
+	Flags   uint8
+	HdrLen  uint32
+	TypeOff uint32
+	TypeLen uint32
+	StrOff  uint32
+	StrLen  uint32
+}
+
+// readBtfStrings loads the string section of a BTF object,
+// line info refers to it directly and it's not exposed by btf.Spec
+func readBtfStrings(fd int) (btfStrings, error) {
+	var info bpfBtfInfo
+	if err := getBtfInfo(fd, &info); err != nil {
+		return nil, err
+	}
+	if info.BtfSize == 0 {
+		return nil, errors.New("empty BTF")
+	}
+	raw := make([]byte, info.BtfSize)
+	info2 := bpfBtfInfo{
+		Btf:     uint64(uintptr(unsafe.Pointer(&raw[0]))),
+		BtfSize: info.BtfSize,
+	}
+	if err := getBtfInfo(fd, &info2); err != nil {
+		return nil, err
+	}
+
+	var header btfHeader
+	if err := binary.Read(bytes.NewReader(raw), util.GetEndian(), &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != 0xeb9f {
+		return nil, fmt.Errorf("unexpected BTF magic %x", header.Magic)
+	}
+	start := uint64(header.HdrLen) + uint64(header.StrOff)
+	end := start + uint64(header.StrLen)
+	if end > uint64(len(raw)) {
+		return nil, errors.New("BTF string section is out of bounds")
+	}
+	return raw[start:end], nil
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"github.com/cilium/ebpf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -20,6 +22,14 @@ type progWatcher struct {
 	progRunCount *prometheus.GaugeVec
 	progRunTime  *prometheus.GaugeVec
 	progsCount   *prometheus.GaugeVec
+	jitedSize    *prometheus.GaugeVec
+	xlatedSize   *prometheus.GaugeVec
+	memlock      *prometheus.GaugeVec
+	typeMemlock  *prometheus.GaugeVec
+	// seriesIDs and seriesTypes have series set by the previous fetch, series of programs unloaded since are deleted
+	seriesMu    sync.Mutex
+	seriesIDs   map[string]bool
+	seriesTypes map[string]bool
 }
 
 type ProgWatcher interface {
@@ -27,6 +37,7 @@ type ProgWatcher interface {
 	GetProgs() ([]ProgInfo, error)
 	GetProg(id ebpf.ProgramID) (*ProgInfo, error)
 	RegisterMetrics(registry *prometheus.Registry)
+	PinProg(id ebpf.ProgramID, path string) error
 }
 
 func NewWatcher(logger zerolog.Logger) ProgWatcher {
@@ -48,12 +59,40 @@ func NewWatcher(logger zerolog.Logger) ProgWatcher {
 		Name:      "prog_count",
 		Help:      "Number of eBPF programs",
 	}, []string{"type"})
+	jitedSize := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "prog_jited_size_bytes",
+		Help:      "Size of JIT'ed native code of an eBPF program",
+	}, []string{"id", "type", "tag", "name"})
+	xlatedSize := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "prog_xlated_size_bytes",
+		Help:      "Size of xlated (verified and rewritten) instructions of an eBPF program",
+	}, []string{"id", "type", "tag", "name"})
+	memlock := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "prog_memlock_bytes",
+		Help:      "Kernel memory charged to an eBPF program",
+	}, []string{"id", "type", "tag", "name"})
+	typeMemlock := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "prog_type_memlock_bytes",
+		Help:      "Kernel memory charged to eBPF programs of a type",
+	}, []string{"type"})
 
 	return &progWatcher{
 		log:          logger,
 		progRunCount: progRunCount,
 		progRunTime:  progRunTime,
 		progsCount:   progsCount,
+		jitedSize:    jitedSize,
+		xlatedSize:   xlatedSize,
+		memlock:      memlock,
+		typeMemlock:  typeMemlock,
 	}
 }
 
@@ -70,6 +109,22 @@ func (pw *progWatcher) RegisterMetrics(registry *prometheus.Registry) {
 	if err != nil {
 		log.Err(err).Msg("failed to register prog_count metric")
 	}
+	err = registry.Register(pw.jitedSize)
+	if err != nil {
+		log.Err(err).Msg("failed to register prog_jited_size_bytes metric")
+	}
+	err = registry.Register(pw.xlatedSize)
+	if err != nil {
+		log.Err(err).Msg("failed to register prog_xlated_size_bytes metric")
+	}
+	err = registry.Register(pw.memlock)
+	if err != nil {
+		log.Err(err).Msg("failed to register prog_memlock_bytes metric")
+	}
+	err = registry.Register(pw.typeMemlock)
+	if err != nil {
+		log.Err(err).Msg("failed to register prog_type_memlock_bytes metric")
+	}
 }
 
 func (pw *progWatcher) Run(ctx context.Context, refreshInterval time.Duration) {
@@ -99,6 +154,12 @@ type ProgInfo struct {
 	VerifierLog string
 	Type        ebpf.ProgramType
 	IsPinned    bool
+	// JitedSize is 0 if the program is not JIT'ed
+	JitedSize      uint32
+	XlatedSize     uint32
+	JitedFunctions uint32
+	// MemlockBytes is kernel memory charged to the program, as reported by fdinfo
+	MemlockBytes uint64
 }
 
 func (pw *progWatcher) GetProgs() ([]ProgInfo, error) {
@@ -121,6 +182,19 @@ func (pw *progWatcher) GetProg(id ebpf.ProgramID) (*ProgInfo, error) {
 	return nil, errors.New("program not found")
 }
 
+func (pw *progWatcher) PinProg(id ebpf.ProgramID, path string) error {
+	prog, err := ebpf.NewProgramFromID(id)
+	if err != nil {
+		return err
+	}
+	defer prog.Close()
+	if err := prog.Pin(path); err != nil {
+		return err
+	}
+	pw.progs, pw.error = pw.fetchProgs()
+	return nil
+}
+
 func (pw *progWatcher) fetchProgs() ([]ProgInfo, error) {
 	var currID ebpf.ProgramID = 0
 	var err error
@@ -129,6 +203,8 @@ func (pw *progWatcher) fetchProgs() ([]ProgInfo, error) {
 
 	// progs count by type
 	var progsCount = map[ebpf.ProgramType]uint64{}
+	var typeMemlock = map[ebpf.ProgramType]uint64{}
+	seenIDs := make(map[string]bool)
 	defer func() {
 		for progType, count := range progsCount {
 			pw.progsCount.WithLabelValues(progType.String()).Set(float64(count))
@@ -172,22 +248,70 @@ func (pw *progWatcher) fetchProgs() ([]ProgInfo, error) {
 			}
 		}
 
+		seenIDs[labelValues[0]] = true
 		pw.progRunCount.WithLabelValues(labelValues...).Set(float64(runCount))
 		pw.progRunTime.WithLabelValues(labelValues...).Set(runTime.Seconds())
 		progsCount[prog.Type()]++
 
+		var rawInfo bpfProgInfo
+		if err := getProgInfo(prog.FD(), &rawInfo); err != nil {
+			pw.log.Debug().Err(err).Msgf("failed to get extended info of program %d", currID)
+		}
+		pw.jitedSize.WithLabelValues(labelValues...).Set(float64(rawInfo.JitedProgLen))
+		pw.xlatedSize.WithLabelValues(labelValues...).Set(float64(rawInfo.XlatedProgLen))
+
+		fdinfo, err := util.ReadFdinfo(prog.FD())
+		if err != nil {
+			pw.log.Debug().Err(err).Msgf("failed to read fdinfo of program %d", currID)
+		}
+		memlock, _ := fdinfo.Uint("memlock")
+		typeMemlock[prog.Type()] += memlock
+		pw.memlock.WithLabelValues(labelValues...).Set(float64(memlock))
+
 		progs = append(progs, ProgInfo{
-			ID:          currID,
-			Type:        prog.Type(),
-			IsPinned:    prog.IsPinned(),
-			Info:        info,
-			VerifierLog: prog.VerifierLog,
-			Error:       err2,
+			ID:             currID,
+			Type:           prog.Type(),
+			IsPinned:       prog.IsPinned(),
+			Info:           info,
+			VerifierLog:    prog.VerifierLog,
+			Error:          err2,
+			JitedSize:      rawInfo.JitedProgLen,
+			XlatedSize:     rawInfo.XlatedProgLen,
+			JitedFunctions: rawInfo.NrJitedKsyms,
+			MemlockBytes:   memlock,
 		})
 	}
+	pw.updateSeries(seenIDs, typeMemlock)
 	return progs, nil
 }
 
+// updateSeries sets memlock totals by type, and deletes series of programs and types which were seen
+// by the previous fetch, but not by this one; series are not reset, so scrapes during a fetch don't miss them
+func (pw *progWatcher) updateSeries(seenIDs map[string]bool, typeMemlock map[ebpf.ProgramType]uint64) {
+	pw.seriesMu.Lock()
+	defer pw.seriesMu.Unlock()
+	for id := range pw.seriesIDs {
+		if seenIDs[id] {
+			continue
+		}
+		for _, gauge := range []*prometheus.GaugeVec{pw.jitedSize, pw.xlatedSize, pw.memlock} {
+			gauge.DeletePartialMatch(prometheus.Labels{"id": id})
+		}
+	}
+	pw.seriesIDs = seenIDs
+	types := make(map[string]bool)
+	for progType, memlock := range typeMemlock {
+		types[progType.String()] = true
+		pw.typeMemlock.WithLabelValues(progType.String()).Set(float64(memlock))
+	}
+	for progType := range pw.seriesTypes {
+		if !types[progType] {
+			pw.typeMemlock.DeleteLabelValues(progType)
+		}
+	}
+	pw.seriesTypes = types
+}
+
 func progInfoErr(id ebpf.ProgramID, err error) ProgInfo {
 	return ProgInfo{
 		ID:    id,
@@ -0,0 +1,173 @@
+package stats
+
+import (
+	"errors"
+	"github.com/cilium/ebpf"
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sysctlStatsEnabled = "/proc/sys/kernel/bpf_stats_enabled"
+
+// enabledCacheTTL is how long IsEnabled reuses the sysctl value, it's called for each program in a list
+const enabledCacheTTL = time.Second
+
+type StatsState struct {
+	// Enabled is true when stats are enabled with sysctl or by the agent; stats enabled with BPF_ENABLE_STATS
+	// by another process are not detected, as the kernel doesn't report them
+	Enabled bool
+	// EnabledByAgent is true while the agent holds a BPF_ENABLE_STATS file descriptor
+	EnabledByAgent bool
+	// ExpiresAt is set when stats were enabled by the agent for a bounded time window
+	ExpiresAt *time.Time
+}
+
+type StatsController interface {
+	Enable(duration time.Duration) error
+	Disable() error
+	GetState() (*StatsState, error)
+	IsEnabled() bool
+}
+
+type statsController struct {
+	log       zerolog.Logger
+	mu        sync.Mutex
+	closer    io.Closer
+	timer     *time.Timer
+	expiresAt *time.Time
+	// generation is bumped by each Enable and Disable, so a timer of an earlier Enable which fires anyway
+	// (Stop can't cancel a callback that has already started) doesn't disable stats enabled again since
+	generation uint64
+	// sysctlEnabled is the sysctl value read by GetState at sysctlReadAt, it's reused by IsEnabled
+	sysctlEnabled bool
+	sysctlReadAt  time.Time
+}
+
+func NewController(logger zerolog.Logger) StatsController {
+	return &statsController{
+		log: logger,
+	}
+}
+
+// Enable turns on run time statistics via BPF_ENABLE_STATS.
+// The statistics stay enabled until Disable is called, the duration passes (if positive) or the agent exits.
+func (sc *statsController) Enable(duration time.Duration) error {
+	if duration < 0 {
+		return errors.New("duration must not be negative")
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.closer == nil {
+		closer, err := ebpf.EnableStats(unix.BPF_STATS_RUN_TIME)
+		if err != nil {
+			return err
+		}
+		sc.closer = closer
+	}
+
+	sc.stopTimer()
+
+	if duration > 0 {
+		expiresAt := time.Now().Add(duration)
+		sc.expiresAt = &expiresAt
+		generation := sc.generation
+		sc.timer = time.AfterFunc(duration, func() {
+			if err := sc.expire(generation); err != nil {
+				sc.log.Err(err).Msg("failed to disable eBPF stats")
+			}
+		})
+	}
+
+	sc.log.Info().Dur("duration", duration).Msg("eBPF stats enabled")
+	return nil
+}
+
+// Disable releases the agent's hold on run time statistics.
+// Stats may still be enabled if they were turned on by someone else (e.g. with sysctl).
+func (sc *statsController) Disable() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.disable()
+}
+
+// expire disables stats when the window of the Enable call of the given generation passes
+func (sc *statsController) expire(generation uint64) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if generation != sc.generation {
+		return nil
+	}
+	return sc.disable()
+}
+
+// stopTimer cancels the expiration of an earlier Enable, it's called with mu held
+func (sc *statsController) stopTimer() {
+	if sc.timer != nil {
+		sc.timer.Stop()
+		sc.timer = nil
+	}
+	sc.expiresAt = nil
+	sc.generation++
+}
+
+func (sc *statsController) disable() error {
+	sc.stopTimer()
+
+	if sc.closer == nil {
+		return nil
+	}
+	err := sc.closer.Close()
+	sc.closer = nil
+	sc.log.Info().Msg("eBPF stats disabled by agent")
+	return err
+}
+
+func (sc *statsController) GetState() (*StatsState, error) {
+	enabled, err := readSysctlEnabled()
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.sysctlEnabled = enabled
+	sc.sysctlReadAt = time.Now()
+	state := &StatsState{
+		Enabled:        enabled || sc.closer != nil,
+		EnabledByAgent: sc.closer != nil,
+		ExpiresAt:      sc.expiresAt,
+	}
+	if err != nil && sc.closer == nil {
+		return state, err
+	}
+	return state, nil
+}
+
+// IsEnabled is GetState().Enabled, the sysctl is read at most once per enabledCacheTTL
+func (sc *statsController) IsEnabled() bool {
+	sc.mu.Lock()
+	if time.Since(sc.sysctlReadAt) < enabledCacheTTL {
+		defer sc.mu.Unlock()
+		return sc.sysctlEnabled || sc.closer != nil
+	}
+	sc.mu.Unlock()
+	state, _ := sc.GetState()
+	return state.Enabled
+}
+
+// readSysctlEnabled reads kernel.bpf_stats_enabled. It's the value last written with sysctl only,
+// references taken with BPF_ENABLE_STATS (by the agent or other processes) are not reflected in it
+func readSysctlEnabled() (bool, error) {
+	content, err := os.ReadFile(sysctlStatsEnabled)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, errors.New("kernel does not support eBPF run time statistics")
+		}
+		return false, err
+	}
+	return strings.TrimSpace(string(content)) != "0", nil
+}
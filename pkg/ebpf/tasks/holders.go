@@ -0,0 +1,75 @@
+package tasks
+
+import (
+	"bufio"
+	"github.com/cilium/ebpf"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Holder is a process holding file descriptors of a BPF object
+type Holder struct {
+	Process *ProcessInfo
+	FDs     []uint32
+}
+
+// HoldersIndex maps BPF objects to processes holding their file descriptors
+type HoldersIndex struct {
+	Maps     map[ebpf.MapID][]*Holder
+	Programs map[ebpf.ProgramID][]*Holder
+	Links    map[uint32][]*Holder
+}
+
+func newHoldersIndex() *HoldersIndex {
+	return &HoldersIndex{
+		Maps:     make(map[ebpf.MapID][]*Holder),
+		Programs: make(map[ebpf.ProgramID][]*Holder),
+		Links:    make(map[uint32][]*Holder),
+	}
+}
+
+func addHolder(holders []*Holder, process *ProcessInfo, fd uint32) []*Holder {
+	for _, holder := range holders {
+		if holder.Process == process {
+			holder.FDs = append(holder.FDs, fd)
+			return holders
+		}
+	}
+	return append(holders, &Holder{Process: process, FDs: []uint32{fd}})
+}
+
+// bpfObjectKind tells the kind of BPF object by the anon inode name of a file descriptor
+func bpfObjectKind(link string) string {
+	switch link {
+	case "anon_inode:bpf-map":
+		return "map_id"
+	case "anon_inode:bpf-prog":
+		return "prog_id"
+	case "anon_inode:bpf_link":
+		return "link_id"
+	}
+	return ""
+}
+
+// readFdinfoID reads an ID field (map_id, prog_id, link_id) from /proc/<pid>/fdinfo/<fd>
+func readFdinfoID(path string, field string) (uint32, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found || key != field {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		return uint32(id), true
+	}
+	return 0, false
+}
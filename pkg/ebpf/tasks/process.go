@@ -0,0 +1,194 @@
+package tasks
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProcessInfo describes a process holding BPF objects or attachments
+type ProcessInfo struct {
+	PID     uint32
+	Comm    string
+	Cmdline string
+	Exe     string
+	UID     uint32
+	// StartTime is zero if it can't be read
+	StartTime time.Time
+	// CgroupPath is a cgroup v2 path of the process, or a path in the systemd hierarchy on cgroup v1 hosts
+	CgroupPath string
+	// ContainerID is empty if the process doesn't run in a container
+	ContainerID string
+	// ContainerRuntime is docker, containerd, cri-o or podman, empty if it can't be told by the cgroup path
+	ContainerRuntime string
+}
+
+// clockTicks is USER_HZ, the unit of start time in /proc/<pid>/stat, it's 100 on all supported architectures
+const clockTicks = 100
+
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// containerCgroupPatterns match cgroup naming of container runtimes, with both systemd and cgroupfs drivers
+var containerCgroupPatterns = []struct {
+	runtime string
+	pattern *regexp.Regexp
+}{
+	{"docker", regexp.MustCompile(`(?:docker-|/docker/)([0-9a-f]{64})`)},
+	{"containerd", regexp.MustCompile(`cri-containerd-([0-9a-f]{64})`)},
+	{"cri-o", regexp.MustCompile(`crio-(?:conmon-)?([0-9a-f]{64})`)},
+	{"podman", regexp.MustCompile(`libpod-(?:conmon-)?([0-9a-f]{64})`)},
+}
+
+// readProcess reads process details from procfs, fields that can't be read are left empty
+func readProcess(procDirName string, pid uint32) *ProcessInfo {
+	dir := procDirName + "/" + strconv.Itoa(int(pid))
+	info := &ProcessInfo{
+		PID: pid,
+	}
+	if comm, err := os.ReadFile(dir + "/comm"); err == nil {
+		info.Comm = strings.TrimSuffix(string(comm), "\n")
+	}
+	if cmdline, err := os.ReadFile(dir + "/cmdline"); err == nil {
+		info.Cmdline = string(bytes.TrimRight(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '}), " "))
+	}
+	if exe, err := os.Readlink(dir + "/exe"); err == nil {
+		info.Exe = exe
+	}
+	if uid, ok := readUID(dir + "/status"); ok {
+		info.UID = uid
+	}
+	if startTicks, ok := readStartTicks(dir + "/stat"); ok {
+		if bootTime, ok := readBootTime(procDirName); ok {
+			info.StartTime = bootTime.Add(time.Duration(startTicks) * time.Second / clockTicks)
+		}
+	}
+	if cgroup, err := os.ReadFile(dir + "/cgroup"); err == nil {
+		info.CgroupPath = cgroupPath(string(cgroup))
+		info.ContainerID, info.ContainerRuntime = ContainerIDFromCgroup(info.CgroupPath)
+	}
+	return info
+}
+
+// readUID reads real UID from /proc/<pid>/status
+func readUID(path string) (uint32, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Uid:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Uid:"))
+		if len(fields) == 0 {
+			return 0, false
+		}
+		uid, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		return uint32(uid), true
+	}
+	return 0, false
+}
+
+// readStartTicks reads start time of a process from /proc/<pid>/stat, in clock ticks since boot
+func readStartTicks(statPath string) (uint64, bool) {
+	stat, err := os.ReadFile(statPath)
+	if err != nil {
+		return 0, false
+	}
+	// comm may contain spaces and parentheses, so fields are counted from the last ')'
+	commEnd := bytes.LastIndexByte(stat, ')')
+	if commEnd < 0 {
+		return 0, false
+	}
+	// fields after comm start with state (3rd), starttime is the 22nd field
+	fields := strings.Fields(string(stat[commEnd+1:]))
+	if len(fields) < 20 {
+		return 0, false
+	}
+	startTicks, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return startTicks, true
+}
+
+var (
+	bootTimeOnce sync.Once
+	bootTime     time.Time
+)
+
+// readBootTime reads btime from /proc/stat, it's read once as /proc/stat is large on hosts with many CPUs
+func readBootTime(procDirName string) (time.Time, bool) {
+	bootTimeOnce.Do(func() {
+		file, err := os.Open(procDirName + "/stat")
+		if err != nil {
+			return
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "btime ") {
+				continue
+			}
+			seconds, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "btime ")), 10, 64)
+			if err == nil {
+				bootTime = time.Unix(seconds, 0)
+			}
+			return
+		}
+	})
+	return bootTime, !bootTime.IsZero()
+}
+
+// cgroupPath picks a cgroup path from the content of /proc/<pid>/cgroup:
+// the unified hierarchy if it's there, otherwise the systemd one, otherwise the first listed
+func cgroupPath(content string) string {
+	var systemd, first string
+	for _, line := range strings.Split(content, "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" && parts[2] != "/" {
+			return parts[2]
+		}
+		if parts[1] == "name=systemd" {
+			systemd = parts[2]
+		}
+		if first == "" {
+			first = parts[2]
+		}
+	}
+	if systemd != "" {
+		return systemd
+	}
+	return first
+}
+
+// ContainerIDFromCgroup finds a container ID and a runtime in a cgroup path,
+// e.g. /system.slice/docker-<id>.scope or /kubepods/burstable/pod<uid>/<id>
+func ContainerIDFromCgroup(path string) (string, string) {
+	for _, candidate := range containerCgroupPatterns {
+		if match := candidate.pattern.FindAllStringSubmatch(path, -1); len(match) > 0 {
+			return match[len(match)-1][1], candidate.runtime
+		}
+	}
+	// cgroupfs driver of kubelet names container cgroups by bare IDs, whatever the runtime is
+	if ids := containerIDPattern.FindAllString(path, -1); len(ids) > 0 {
+		return ids[len(ids)-1], ""
+	}
+	return "", ""
+}
@@ -0,0 +1,273 @@
+package tasks
+
+import (
+	"github.com/cilium/ebpf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/ksyms"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/util"
+	"golang.org/x/sys/unix"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// maxCacheAge bounds how long results of a process are reused as is: anonymous descriptors (e.g. eventfd) share
+// an inode with BPF objects and perf events, so an fd closed and reopened as a perf event with the same number
+// can't be told apart without examining it again. Processes holding BPF objects or perf events are always rescanned.
+const maxCacheAge = time.Minute
+
+type taskFdQuery struct {
+	Pid   uint32
+	Fd    uint32
+	Flags uint32
+
+	BufLen uint32
+	Buf    uint64
+
+	ProgId      uint32
+	FdType      TaskFdType
+	ProbeOffset uint64
+	ProbeAddr   uint64
+}
+
+// fdResult is what is known about a file descriptor of a process
+type fdResult struct {
+	ino uint64
+	// kind is map_id, prog_id or link_id for BPF objects, empty for other descriptors
+	kind string
+	id   uint32
+	// task is set if the descriptor is a perf event (or a raw tracepoint link) with a program attached
+	task *TaskInfo
+	// anon is set for anonymous inodes (or if the link couldn't be read), all of them share one inode,
+	// so they are examined again on rescans instead of being reused by inode
+	anon bool
+	// bpfOrPerf is set for BPF objects and perf events
+	bpfOrPerf bool
+}
+
+// processCache keeps results of the last examination of a process
+type processCache struct {
+	pid        uint32
+	startTicks uint64
+	scannedAt  time.Time
+	process    *ProcessInfo
+	fds        map[uint32]*fdResult
+	// bpfOrPerf is set if the process holds BPF objects or perf events, so it's rescanned even if fds are the same
+	bpfOrPerf bool
+}
+
+type scanResult struct {
+	cache *processCache
+	// rescanned is false if the cached results were reused as is
+	rescanned  bool
+	queriedFds int
+}
+
+// tasks lists perf events of the process, ordered by fd
+func (pc *processCache) tasks() []*TaskInfo {
+	var result []*TaskInfo
+	for _, fdr := range pc.fds {
+		if fdr.task == nil {
+			continue
+		}
+		// copied, so the process can be updated on rescan while the previous results are being read
+		task := *fdr.task
+		task.Process = pc.process
+		result = append(result, &task)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].FD < result[j].FD
+	})
+	return result
+}
+
+func (pc *processCache) addHolders(holders *HoldersIndex) {
+	fds := make([]uint32, 0, len(pc.fds))
+	for fd, fdr := range pc.fds {
+		if fdr.kind != "" {
+			fds = append(fds, fd)
+		}
+	}
+	sort.Slice(fds, func(i, j int) bool {
+		return fds[i] < fds[j]
+	})
+	for _, fd := range fds {
+		fdr := pc.fds[fd]
+		switch fdr.kind {
+		case "map_id":
+			holders.Maps[ebpf.MapID(fdr.id)] = addHolder(holders.Maps[ebpf.MapID(fdr.id)], pc.process, fd)
+		case "prog_id":
+			holders.Programs[ebpf.ProgramID(fdr.id)] = addHolder(holders.Programs[ebpf.ProgramID(fdr.id)], pc.process, fd)
+		case "link_id":
+			holders.Links[fdr.id] = addHolder(holders.Links[fdr.id], pc.process, fd)
+		}
+	}
+}
+
+// scanProcess examines file descriptors of a process, cached results are reused if the set of descriptors
+// hasn't changed and there are no BPF objects or perf events among them, and results of descriptors pointing
+// to the same inode are reused otherwise, except for anonymous inodes
+func scanProcess(procDirName string, pid uint32, cached *processCache, symbols *symbolResolver, now time.Time) *scanResult {
+	dir := procDirName + "/" + strconv.Itoa(int(pid))
+	fdDir, err := os.Open(dir + "/fd")
+	if err != nil {
+		return &scanResult{}
+	}
+	fdNames, err := fdDir.Readdirnames(-1)
+	fdDir.Close()
+	if err != nil {
+		return &scanResult{}
+	}
+	startTicks, _ := readStartTicks(dir + "/stat")
+
+	if cached != nil && (cached.startTicks != startTicks || now.Sub(cached.scannedAt) >= maxCacheAge) {
+		// the PID is reused by another process, or the results are too old to trust
+		cached = nil
+	}
+	if cached != nil && !cached.bpfOrPerf && sameFds(cached, fdNames) {
+		return &scanResult{cache: cached}
+	}
+
+	result := &scanResult{
+		rescanned: true,
+		cache: &processCache{
+			pid:        pid,
+			startTicks: startTicks,
+			scannedAt:  now,
+			process:    readProcess(procDirName, pid),
+			fds:        make(map[uint32]*fdResult, len(fdNames)),
+		},
+	}
+	if cached != nil {
+		// the process is the same, only some descriptors changed
+		result.cache.scannedAt = cached.scannedAt
+	}
+	for _, fdName := range fdNames {
+		fdNo, err := strconv.Atoi(fdName)
+		if err != nil {
+			continue
+		}
+		fdPath := dir + "/fd/" + fdName
+		var ino uint64
+		if stat, err := os.Stat(fdPath); err == nil {
+			if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+				ino = sys.Ino
+			}
+		}
+		if cached != nil {
+			if previous, ok := cached.fds[uint32(fdNo)]; ok && !previous.anon && previous.ino == ino {
+				result.cache.fds[uint32(fdNo)] = previous
+				continue
+			}
+		}
+		result.queriedFds++
+		fdr := examineFd(procDirName, pid, uint32(fdNo), ino, symbols)
+		result.cache.fds[uint32(fdNo)] = fdr
+		result.cache.bpfOrPerf = result.cache.bpfOrPerf || fdr.bpfOrPerf
+	}
+	return result
+}
+
+func sameFds(cached *processCache, fdNames []string) bool {
+	if len(cached.fds) != len(fdNames) {
+		return false
+	}
+	for _, fdName := range fdNames {
+		fdNo, err := strconv.Atoi(fdName)
+		if err != nil {
+			return false
+		}
+		if _, ok := cached.fds[uint32(fdNo)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// examineFd tells if a file descriptor is a BPF object or a perf event with a program attached
+func examineFd(procDirName string, pid uint32, fd uint32, ino uint64, symbols *symbolResolver) *fdResult {
+	result := &fdResult{ino: ino, anon: true}
+	dir := procDirName + "/" + strconv.Itoa(int(pid))
+	fdName := strconv.Itoa(int(fd))
+
+	if target, err := os.Readlink(dir + "/fd/" + fdName); err == nil {
+		// perf events and BPF objects are anonymous inodes, regular files and sockets are skipped
+		if !strings.HasPrefix(target, "anon_inode:") {
+			result.anon = false
+			return result
+		}
+		field := bpfObjectKind(target)
+		result.bpfOrPerf = field != "" || target == "anon_inode:[perf_event]"
+		if field != "" {
+			if id, ok := readFdinfoID(dir+"/fdinfo/"+fdName, field); ok {
+				result.kind = field
+				result.id = id
+			}
+			// raw tracepoints are attached through links, so link FDs are queried below as well
+			if field != "link_id" {
+				return result
+			}
+		}
+	}
+
+	bufLen := 4096
+	buf := make([]byte, bufLen)
+
+	taskAttr := &taskFdQuery{
+		Pid:    pid,
+		Fd:     fd,
+		Flags:  0,
+		BufLen: uint32(bufLen),
+		Buf:    uint64(uintptr(unsafe.Pointer(&buf[0]))),
+	}
+
+	_, err := util.CallBPF(unix.BPF_TASK_FD_QUERY, unsafe.Pointer(taskAttr), unsafe.Sizeof(*taskAttr))
+	if err != nil {
+		return result
+	}
+
+	// cut buf to the actual length
+	buf = buf[:taskAttr.BufLen]
+
+	task := &TaskInfo{
+		PID:         taskAttr.Pid,
+		FD:          taskAttr.Fd,
+		ProgramID:   ebpf.ProgramID(taskAttr.ProgId),
+		Type:        taskAttr.FdType,
+		Name:        string(buf),
+		ProbeOffset: taskAttr.ProbeOffset,
+		ProbeAddr:   taskAttr.ProbeAddr,
+	}
+	if task.Type == Uprobe || task.Type == Uretprobe {
+		// name of uprobes is the path of the binary
+		task.BinaryPath = task.Name
+		if symbol, ok := symbols.resolve(procDirName, task.PID, task.BinaryPath, task.ProbeOffset); ok {
+			task.Symbol = symbol
+		}
+	}
+	if task.Type == Kprobe || task.Type == Kretprobe {
+		task.Symbol = kprobeSymbol(task)
+	}
+	result.task = task
+	result.bpfOrPerf = true
+	return result
+}
+
+// kprobeSymbol formats a kprobe target as "symbol+0x10", kprobes attached by address are resolved with kallsyms
+func kprobeSymbol(task *TaskInfo) string {
+	if task.ProbeAddr != 0 {
+		if symbols, err := ksyms.Default(); err == nil {
+			if symbol, ok := symbols.Format(task.ProbeAddr); ok {
+				return symbol
+			}
+		}
+		return ""
+	}
+	if task.Name == "" || task.ProbeOffset == 0 {
+		return task.Name
+	}
+	return task.Name + "+0x" + strconv.FormatUint(task.ProbeOffset, 16)
+}
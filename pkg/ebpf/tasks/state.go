@@ -4,12 +4,14 @@ import (
 	"context"
 	"github.com/cilium/ebpf"
 	"github.com/pkg/errors"
-	"golang.org/x/sys/unix"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
-	"unsafe"
 )
 
 type TaskInfo struct {
@@ -20,18 +22,41 @@ type TaskInfo struct {
 	Name        string
 	ProbeOffset uint64
 	ProbeAddr   uint64
+	// Process is the process holding the perf event
+	Process *ProcessInfo
+	// BinaryPath is a path of the probed binary of uprobes, as the process sees it
+	BinaryPath string
+	// Symbol is a function of a uprobe resolved from ProbeOffset (empty if the binary has no symbols),
+	// or a kernel function of a kprobe, resolved with kallsyms if the kprobe is attached by address
+	Symbol string
 }
 
 type TaskWatcher interface {
 	Run(ctx context.Context, refreshInterval time.Duration)
 	GetTasks() ([]*TaskInfo, error)
+	GetHolders() (*HoldersIndex, error)
+	RegisterMetrics(registry *prometheus.Registry)
 }
 
 type taskWatcher struct {
+	log zerolog.Logger
+	// mu guards results of the last scan, they are replaced by the scanning goroutine while queries read them
+	mu          sync.RWMutex
 	tasks       []*TaskInfo
+	holders     *HoldersIndex
 	error       error
 	isRunning   bool
 	procDirName string
+	// workers is a number of processes scanned in parallel
+	workers int
+
+	// scanMu guards the cache, a scan triggered by a query may overlap with the periodic one
+	scanMu sync.Mutex
+	cache  map[uint32]*processCache
+
+	scanDuration  prometheus.Gauge
+	scanFds       *prometheus.GaugeVec
+	scanProcesses *prometheus.GaugeVec
 }
 
 func (tw *taskWatcher) Run(ctx context.Context, refreshInterval time.Duration) {
@@ -45,7 +70,10 @@ func (tw *taskWatcher) Run(ctx context.Context, refreshInterval time.Duration) {
 		for {
 			select {
 			case <-ticker.C:
-				tw.tasks, tw.error = fetchTasks(tw.procDirName)
+				tasks, holders, err := tw.fetchTasks()
+				tw.mu.Lock()
+				tw.tasks, tw.holders, tw.error = tasks, holders, err
+				tw.mu.Unlock()
 			case <-ctx.Done():
 				tw.isRunning = false
 				return
@@ -55,107 +83,146 @@ func (tw *taskWatcher) Run(ctx context.Context, refreshInterval time.Duration) {
 }
 
 func (tw *taskWatcher) GetTasks() ([]*TaskInfo, error) {
-	if tw.tasks == nil && tw.error == nil {
-		return fetchTasks(tw.procDirName)
+	tw.mu.RLock()
+	tasks, holders, err := tw.tasks, tw.holders, tw.error
+	tw.mu.RUnlock()
+	if holders == nil && err == nil {
+		tasks, _, err = tw.fetchTasks()
 	}
-	return tw.tasks, tw.error
+	return tasks, err
 }
 
-func NewTaskWatcher() TaskWatcher {
-	return &taskWatcher{
-		procDirName: "/proc",
+func (tw *taskWatcher) GetHolders() (*HoldersIndex, error) {
+	tw.mu.RLock()
+	holders, err := tw.holders, tw.error
+	tw.mu.RUnlock()
+	if holders == nil && err == nil {
+		_, holders, err = tw.fetchTasks()
 	}
+	return holders, err
 }
 
-type taskFdQuery struct {
-	Pid   uint32
-	Fd    uint32
-	Flags uint32
-
-	BufLen uint32
-	Buf    uint64
-
-	ProgId      uint32
-	FdType      TaskFdType
-	ProbeOffset uint64
-	ProbeAddr   uint64
+func (tw *taskWatcher) RegisterMetrics(registry *prometheus.Registry) {
+	err := registry.Register(tw.scanDuration)
+	if err != nil {
+		tw.log.Err(err).Msg("failed to register task_scan_duration_seconds metric")
+	}
+	err = registry.Register(tw.scanFds)
+	if err != nil {
+		tw.log.Err(err).Msg("failed to register task_scan_fds metric")
+	}
+	err = registry.Register(tw.scanProcesses)
+	if err != nil {
+		tw.log.Err(err).Msg("failed to register task_scan_processes metric")
+	}
 }
 
-func fetchTasks(procDirName string) ([]*TaskInfo, error) {
-	procDir, err := os.ReadDir(procDirName)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to open "+procDirName)
+func NewTaskWatcher(logger zerolog.Logger) TaskWatcher {
+	scanDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "task_scan_duration_seconds",
+		Help:      "Duration of the last scan of process file descriptors",
+	})
+	scanFds := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "task_scan_fds",
+		Help:      "Number of file descriptors seen by the last scan (total) and examined rather than taken from cache (queried)",
+	}, []string{"state"})
+	scanProcesses := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "task_scan_processes",
+		Help:      "Number of processes seen by the last scan (total) and rescanned because their file descriptors changed or include BPF objects (rescanned)",
+	}, []string{"state"})
+
+	workers := runtime.NumCPU()
+	if workers > maxScanWorkers {
+		workers = maxScanWorkers
+	}
+	return &taskWatcher{
+		log:           logger,
+		procDirName:   "/proc",
+		workers:       workers,
+		cache:         make(map[uint32]*processCache),
+		scanDuration:  scanDuration,
+		scanFds:       scanFds,
+		scanProcesses: scanProcesses,
 	}
+}
 
-	var tasks []*TaskInfo
+// maxScanWorkers bounds parallel scanning, procfs reads are mostly served by kernel under per-process locks
+const maxScanWorkers = 8
 
-	for _, procDirEntry := range procDir {
-		pid, err := strconv.Atoi(procDirEntry.Name())
-		if err != nil {
-			continue
-		}
+// fetchTasks scans file descriptors of all processes for perf events with BPF programs attached
+// and for BPF objects (maps, programs, links) held by the processes;
+// only processes which file descriptors changed since the previous scan are examined
+func (tw *taskWatcher) fetchTasks() ([]*TaskInfo, *HoldersIndex, error) {
+	tw.scanMu.Lock()
+	defer tw.scanMu.Unlock()
 
-		fdDir, err := os.ReadDir(procDirName + "/" + procDirEntry.Name() + "/fd")
-		if err != nil {
-			continue
-		}
+	started := time.Now()
+	procDir, err := os.ReadDir(tw.procDirName)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to open "+tw.procDirName)
+	}
 
-		for _, fdDirEntry := range fdDir {
-			fdNo, err := strconv.Atoi(fdDirEntry.Name())
-			if err != nil {
-				continue
+	jobs := make(chan uint32)
+	results := make(chan *scanResult)
+	symbols := newSymbolResolver()
+	var wg sync.WaitGroup
+	for i := 0; i < tw.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pid := range jobs {
+				results <- scanProcess(tw.procDirName, pid, tw.cache[pid], symbols, started)
 			}
-			bufLen := 4096
-			buf := make([]byte, bufLen)
-
-			taskAttr := &taskFdQuery{
-				Pid:    uint32(pid),
-				Fd:     uint32(fdNo),
-				Flags:  0,
-				BufLen: uint32(bufLen),
-				Buf:    uint64(uintptr(unsafe.Pointer(&buf[0]))),
-			}
-
-			_, err = callBPF(unix.BPF_TASK_FD_QUERY, unsafe.Pointer(taskAttr), unsafe.Sizeof(*taskAttr))
+		}()
+	}
+	go func() {
+		for _, procDirEntry := range procDir {
+			pid, err := strconv.Atoi(procDirEntry.Name())
 			if err != nil {
 				continue
 			}
-
-			// cut buf to the actual length
-			buf = buf[:taskAttr.BufLen]
-
-			tasks = append(tasks, &TaskInfo{
-				PID:         taskAttr.Pid,
-				FD:          taskAttr.Fd,
-				ProgramID:   ebpf.ProgramID(taskAttr.ProgId),
-				Type:        taskAttr.FdType,
-				Name:        string(buf),
-				ProbeOffset: taskAttr.ProbeOffset,
-				ProbeAddr:   taskAttr.ProbeAddr,
-			})
-
+			jobs <- uint32(pid)
 		}
-	}
-
-	return tasks, nil
-}
-
-func callBPF(cmd int, attr unsafe.Pointer, size uintptr) (uintptr, error) {
-	for {
-		r1, _, errNo := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
-		runtime.KeepAlive(attr)
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
 
-		// As of ~4.20 the verifier can be interrupted by a signal,
-		// and returns EAGAIN in that case.
-		if errNo == unix.EAGAIN && cmd == unix.BPF_PROG_LOAD {
+	var tasks []*TaskInfo
+	holders := newHoldersIndex()
+	cache := make(map[uint32]*processCache, len(tw.cache))
+	var totalFds, queriedFds, totalProcesses, rescannedProcesses int
+	for result := range results {
+		if result.cache == nil {
+			// the process has gone or its fds are not readable
 			continue
 		}
-
-		var err error
-		if errNo != 0 {
-			err = errors.New("bpf syscall failed: " + errNo.Error())
+		cache[result.cache.pid] = result.cache
+		totalProcesses++
+		totalFds += len(result.cache.fds)
+		queriedFds += result.queriedFds
+		if result.rescanned {
+			rescannedProcesses++
 		}
-
-		return r1, err
+		tasks = append(tasks, result.cache.tasks()...)
+		result.cache.addHolders(holders)
 	}
+	// processes that have gone are dropped from the cache here
+	tw.cache = cache
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].PID < tasks[j].PID
+	})
+
+	tw.scanDuration.Set(time.Since(started).Seconds())
+	tw.scanFds.WithLabelValues("total").Set(float64(totalFds))
+	tw.scanFds.WithLabelValues("queried").Set(float64(queriedFds))
+	tw.scanProcesses.WithLabelValues("total").Set(float64(totalProcesses))
+	tw.scanProcesses.WithLabelValues("rescanned").Set(float64(rescannedProcesses))
+	return tasks, holders, nil
 }
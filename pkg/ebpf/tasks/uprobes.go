@@ -0,0 +1,100 @@
+package tasks
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// elfSymbols are function symbols of a binary, sorted by address
+type elfSymbols struct {
+	progs   []elf.ProgHeader
+	symbols []elf.Symbol
+}
+
+func readElfSymbols(path string) (*elfSymbols, error) {
+	file, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := &elfSymbols{}
+	for _, prog := range file.Progs {
+		if prog.Type == elf.PT_LOAD {
+			result.progs = append(result.progs, prog.ProgHeader)
+		}
+	}
+	symbols, _ := file.Symbols()
+	dynamicSymbols, _ := file.DynamicSymbols()
+	for _, symbol := range append(symbols, dynamicSymbols...) {
+		if elf.ST_TYPE(symbol.Info) == elf.STT_FUNC && symbol.Value != 0 {
+			result.symbols = append(result.symbols, symbol)
+		}
+	}
+	if len(result.symbols) == 0 {
+		return nil, errors.New("no function symbols in " + path)
+	}
+	sort.Slice(result.symbols, func(i, j int) bool {
+		return result.symbols[i].Value < result.symbols[j].Value
+	})
+	return result, nil
+}
+
+// resolve finds a function by a file offset of a uprobe, the result is "symbol" or "symbol+0x10"
+func (es *elfSymbols) resolve(offset uint64) (string, bool) {
+	// uprobe offsets are file offsets, symbols are virtual addresses
+	address, ok := uint64(0), false
+	for _, prog := range es.progs {
+		if offset >= prog.Off && offset < prog.Off+prog.Filesz {
+			address, ok = offset-prog.Off+prog.Vaddr, true
+			break
+		}
+	}
+	if !ok {
+		return "", false
+	}
+	i := sort.Search(len(es.symbols), func(i int) bool {
+		return es.symbols[i].Value > address
+	}) - 1
+	if i < 0 {
+		return "", false
+	}
+	symbol := es.symbols[i]
+	if symbol.Size != 0 && address >= symbol.Value+symbol.Size {
+		return "", false
+	}
+	if address == symbol.Value {
+		return symbol.Name, true
+	}
+	return fmt.Sprintf("%s+%#x", symbol.Name, address-symbol.Value), true
+}
+
+// symbolResolver caches symbols of binaries during a scan, it's shared by scan workers
+type symbolResolver struct {
+	mu       sync.Mutex
+	binaries map[string]*elfSymbols
+}
+
+func newSymbolResolver() *symbolResolver {
+	return &symbolResolver{binaries: make(map[string]*elfSymbols)}
+}
+
+// resolve finds a symbol of a uprobe, the binary is looked up in the mount namespace of the process
+func (sr *symbolResolver) resolve(procDirName string, pid uint32, path string, offset uint64) (string, bool) {
+	binaryPath := fmt.Sprintf("%s/%d/root%s", procDirName, pid, path)
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	symbols, ok := sr.binaries[binaryPath]
+	if !ok {
+		// unreadable binaries are remembered as nil, so they are not reopened for every probe
+		symbols, _ = readElfSymbols(binaryPath)
+		sr.binaries[binaryPath] = symbols
+	}
+	if symbols == nil {
+		return "", false
+	}
+	return symbols.resolve(offset)
+}
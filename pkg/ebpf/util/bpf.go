@@ -0,0 +1,170 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"runtime"
+	"unsafe"
+)
+
+func CallBPF(cmd int, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+	for {
+		r1, _, errNo := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+		runtime.KeepAlive(attr)
+
+		// As of ~4.20 the verifier can be interrupted by a signal,
+		// and returns EAGAIN in that case.
+		if errNo == unix.EAGAIN && cmd == unix.BPF_PROG_LOAD {
+			continue
+		}
+
+		var err error
+		if errNo != 0 {
+			err = fmt.Errorf("bpf syscall failed: %w", errNo)
+		}
+
+		return r1, err
+	}
+}
+
+type objGetInfoByFdAttr struct {
+	BpfFd   uint32
+	InfoLen uint32
+	Info    uint64
+}
+
+// ObjGetInfoByFD fills info (a pointer to bpf_*_info structure of the given size) with BPF_OBJ_GET_INFO_BY_FD
+func ObjGetInfoByFD(fd int, info unsafe.Pointer, size uintptr) error {
+	attr := &objGetInfoByFdAttr{
+		BpfFd:   uint32(fd),
+		InfoLen: uint32(size),
+		Info:    uint64(uintptr(info)),
+	}
+	_, err := CallBPF(unix.BPF_OBJ_GET_INFO_BY_FD, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	runtime.KeepAlive(info)
+	return err
+}
+
+type objPinAttr struct {
+	Pathname  uint64
+	BpfFd     uint32
+	FileFlags uint32
+}
+
+// ObjPin pins a BPF object (program, map or link) referred by fd to the path on bpffs
+func ObjPin(fd int, path string) error {
+	pathname, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	attr := &objPinAttr{
+		Pathname: uint64(uintptr(unsafe.Pointer(pathname))),
+		BpfFd:    uint32(fd),
+	}
+	_, err = CallBPF(unix.BPF_OBJ_PIN, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	runtime.KeepAlive(pathname)
+	return err
+}
+
+// ObjGet opens a pinned BPF object, caller is responsible to close the returned fd
+func ObjGet(path string) (int, error) {
+	pathname, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return -1, err
+	}
+	attr := &objPinAttr{
+		Pathname: uint64(uintptr(unsafe.Pointer(pathname))),
+	}
+	fd, err := CallBPF(unix.BPF_OBJ_GET, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	runtime.KeepAlive(pathname)
+	if err != nil {
+		return -1, err
+	}
+	return int(fd), nil
+}
+
+type progQueryAttr struct {
+	TargetFd        uint32
+	AttachType      uint32
+	QueryFlags      uint32
+	AttachFlags     uint32
+	ProgIDs         uint64
+	Count           uint32
+	_               uint32
+	ProgAttachFlags uint64
+	LinkIDs         uint64
+	LinkAttachFlags uint64
+	Revision        uint64
+}
+
+type ProgQueryResult struct {
+	AttachFlags uint32
+	ProgIDs     []uint32
+	// ProgAttachFlags are reported for cgroups when BPF_F_QUERY_EFFECTIVE is not set
+	ProgAttachFlags []uint32
+	// LinkIDs are reported for tcx, 0 for programs attached without a link
+	LinkIDs  []uint32
+	Revision uint64
+}
+
+// ProgQuery lists programs attached to a target (cgroup fd or ifindex for tcx) with BPF_PROG_QUERY,
+// withLinks requests link IDs, which older kernels don't support
+func ProgQuery(target uint32, attachType uint32, queryFlags uint32, withLinks bool) (*ProgQueryResult, error) {
+	attr := &progQueryAttr{
+		TargetFd:   target,
+		AttachType: attachType,
+		QueryFlags: queryFlags,
+	}
+	if _, err := CallBPF(unix.BPF_PROG_QUERY, unsafe.Pointer(attr), unsafe.Sizeof(*attr)); err != nil {
+		return nil, err
+	}
+	result := &ProgQueryResult{
+		AttachFlags: attr.AttachFlags,
+		Revision:    attr.Revision,
+	}
+	if attr.Count == 0 {
+		return result, nil
+	}
+
+	// programs may be attached between the calls, so the buffers have some room
+	count := attr.Count + 16
+	result.ProgIDs = make([]uint32, count)
+	result.ProgAttachFlags = make([]uint32, count)
+	attr2 := &progQueryAttr{
+		TargetFd:        target,
+		AttachType:      attachType,
+		QueryFlags:      queryFlags,
+		ProgIDs:         uint64(uintptr(unsafe.Pointer(&result.ProgIDs[0]))),
+		Count:           count,
+		ProgAttachFlags: uint64(uintptr(unsafe.Pointer(&result.ProgAttachFlags[0]))),
+	}
+	if withLinks {
+		result.LinkIDs = make([]uint32, count)
+		attr2.LinkIDs = uint64(uintptr(unsafe.Pointer(&result.LinkIDs[0])))
+	}
+	_, err := CallBPF(unix.BPF_PROG_QUERY, unsafe.Pointer(attr2), unsafe.Sizeof(*attr2))
+	if errors.Is(err, unix.EINVAL) {
+		// kernels before 6.0 don't know prog_attach_flags and link_ids
+		attr2.Count = count
+		attr2.ProgAttachFlags = 0
+		attr2.LinkIDs = 0
+		result.ProgAttachFlags = nil
+		result.LinkIDs = nil
+		_, err = CallBPF(unix.BPF_PROG_QUERY, unsafe.Pointer(attr2), unsafe.Sizeof(*attr2))
+	}
+	runtime.KeepAlive(result)
+	if err != nil {
+		return nil, err
+	}
+	result.AttachFlags = attr2.AttachFlags
+	result.Revision = attr2.Revision
+	result.ProgIDs = result.ProgIDs[:attr2.Count]
+	if result.ProgAttachFlags != nil {
+		result.ProgAttachFlags = result.ProgAttachFlags[:attr2.Count]
+	}
+	if result.LinkIDs != nil {
+		result.LinkIDs = result.LinkIDs[:attr2.Count]
+	}
+	return result, nil
+}
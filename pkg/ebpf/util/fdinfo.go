@@ -0,0 +1,37 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Fdinfo holds key-value pairs of /proc/self/fdinfo/<fd>,
+// BPF objects report there what BPF_OBJ_GET_INFO_BY_FD doesn't, e.g. memlock of maps and programs
+type Fdinfo map[string]string
+
+func ReadFdinfo(fd int) (Fdinfo, error) {
+	content, err := os.ReadFile(fmt.Sprintf("/proc/self/fdinfo/%d", fd))
+	if err != nil {
+		return nil, err
+	}
+	result := make(Fdinfo)
+	for _, line := range strings.Split(string(content), "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if found {
+			result[key] = strings.TrimSpace(value)
+		}
+	}
+	return result, nil
+}
+
+// Uint parses a decimal or a 0x-prefixed hex value, it returns false if the key is missing, e.g. on older kernels
+func (fi Fdinfo) Uint(key string) (uint64, bool) {
+	value, ok := fi[key]
+	if !ok {
+		return 0, false
+	}
+	parsed, err := strconv.ParseUint(value, 0, 64)
+	return parsed, err == nil
+}
@@ -1,12 +1,23 @@
 package graph
 
 import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"github.com/cilium/ebpf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/btfs"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/cgroups"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/links"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/maps"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/netdevs"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/pins"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/progs"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/tasks"
 	"github.com/ebpfdev/dev-agent/pkg/graph/model"
+	"github.com/ebpfdev/dev-agent/pkg/k8s"
+	"golang.org/x/sys/unix"
 	"strconv"
+	"time"
 )
 
 func progInfoToModel(prog *progs.ProgInfo) *model.Program {
@@ -33,17 +44,92 @@ func progInfoToModel(prog *progs.ProgInfo) *model.Program {
 		}
 	}
 
+	jitedSize := int(prog.JitedSize)
+	xlatedSize := int(prog.XlatedSize)
+	jitedFunctionCount := int(prog.JitedFunctions)
+	memlock := int(prog.MemlockBytes)
+
 	return &model.Program{
-		ID:          int(prog.ID),
-		Name:        &prog.Info.Name,
-		Type:        prog.Type.String(),
-		Tag:         &prog.Info.Tag,
-		RunTime:     &runTimeSec,
-		RunCount:    &runCountInt,
-		BtfID:       &btfIDInt,
-		VerifierLog: &prog.VerifierLog,
-		IsPinned:    &prog.IsPinned,
-		Maps:        emaps,
+		ID:                 int(prog.ID),
+		Name:               &prog.Info.Name,
+		Type:               prog.Type.String(),
+		Tag:                &prog.Info.Tag,
+		RunTime:            &runTimeSec,
+		RunCount:           &runCountInt,
+		BtfID:              &btfIDInt,
+		VerifierLog:        &prog.VerifierLog,
+		IsPinned:           &prog.IsPinned,
+		Maps:               emaps,
+		JitedSize:          &jitedSize,
+		MemlockBytes:       &memlock,
+		XlatedSize:         &xlatedSize,
+		JitedFunctionCount: &jitedFunctionCount,
+	}
+}
+
+func (r *Resolver) programInstructions(obj *model.Program) ([]*progs.Instruction, error) {
+	prog, err := r.ProgsRepository.GetProg(ebpf.ProgramID(obj.ID))
+	if err != nil {
+		return nil, err
+	}
+	if prog.Info == nil {
+		return nil, prog.Error
+	}
+	return progs.GetInstructions(prog.Info)
+}
+
+func (r *Resolver) programCallsAnalysis(obj *model.Program) (*progs.CallsAnalysis, error) {
+	prog, err := r.ProgsRepository.GetProg(ebpf.ProgramID(obj.ID))
+	if err != nil {
+		return nil, err
+	}
+	if prog.Info == nil {
+		return nil, prog.Error
+	}
+	return progs.AnalyzeCalls(prog.Info)
+}
+
+func functionUsagesToModel(usages []*progs.FunctionUsage) []*model.FunctionUsage {
+	result := make([]*model.FunctionUsage, len(usages))
+	for i, usage := range usages {
+		result[i] = &model.FunctionUsage{
+			Name:  usage.Name,
+			Count: usage.Count,
+		}
+	}
+	return result
+}
+
+func instructionToModel(ins *progs.Instruction) *model.Instruction {
+	result := &model.Instruction{
+		Offset:     ins.Offset,
+		Opcode:     int(ins.OpCode),
+		OpcodeName: ins.OpCode.String(),
+		Dst:        int(ins.Dst),
+		Src:        int(ins.Src),
+		Off:        int(ins.Off),
+		Imm:        strconv.FormatInt(ins.Imm, 10),
+		Text:       ins.Text,
+	}
+	if ins.MapID != 0 {
+		mapID := int(ins.MapID)
+		result.MapID = &mapID
+		result.MapName = &ins.MapName
+	}
+	if ins.Function != "" {
+		result.Function = &ins.Function
+	}
+	return result
+}
+
+func sourceLineToModel(line *progs.LineInfo) *model.SourceLine {
+	return &model.SourceLine{
+		Offset:           line.Offset,
+		File:             line.File,
+		Line:             line.Line,
+		Column:           line.Column,
+		Text:             line.Text,
+		InstructionCount: line.InstructionCount,
 	}
 }
 
@@ -51,19 +137,32 @@ func mapInfoToModel(m *maps.MapInfo) *model.Map {
 	if m.Error != nil {
 		errString := m.Error.Error()
 		return &model.Map{
-			ID:    int(m.ID),
-			Error: &errString,
+			ID:        int(m.ID),
+			Error:     &errString,
+			FlagNames: []string{},
 		}
 	}
 	flags := int(m.Flags)
 	keySize := int(m.KeySize)
 	valueSize := int(m.ValueSize)
 	maxEntries := int(m.MaxEntries)
+	memlock := int(m.MemlockBytes)
+	mapExtra := int(m.MapExtra)
+	var ownerProgType *string
+	if m.OwnerProgType != ebpf.UnspecifiedProgram {
+		typeName := m.OwnerProgType.String()
+		ownerProgType = &typeName
+	}
 	return &model.Map{
 		ID:                int(m.ID),
 		Name:              &m.Name,
 		Type:              m.Type.String(),
 		Flags:             &flags,
+		FlagNames:         maps.FlagNames(m.Flags),
+		Frozen:            m.Frozen,
+		MemlockBytes:      &memlock,
+		MapExtra:          &mapExtra,
+		OwnerProgramType:  ownerProgType,
 		IsPinned:          len(m.Pins) > 0,
 		Pins:              m.Pins,
 		KeySize:           &keySize,
@@ -71,7 +170,102 @@ func mapInfoToModel(m *maps.MapInfo) *model.Map {
 		MaxEntries:        &maxEntries,
 		IsPerCPU:          maps.IsPerCPU(m.Type),
 		IsLookupSupported: maps.IsLookupSupported(m.Type),
+
+		BtfID:                 optBtfID(m.BtfID),
+		BtfKeyTypeID:          optBtfID(m.BtfKeyTypeID),
+		BtfValueTypeID:        optBtfID(m.BtfValueTypeID),
+		BtfVmlinuxValueTypeID: optBtfID(m.BtfVmlinuxValueTypeID),
+	}
+}
+
+// optBtfID returns nil for 0, which means there is no BTF object or type
+func optBtfID(id uint32) *int {
+	if id == 0 {
+		return nil
 	}
+	result := int(id)
+	return &result
+}
+
+func btfInfoToModel(bi *btfs.BtfInfo) *model.Btf {
+	result := &model.Btf{
+		ID:       int(bi.ID),
+		Size:     int(bi.Size),
+		IsKernel: bi.IsKernel,
+	}
+	if bi.Name != "" {
+		result.Name = &bi.Name
+	}
+	return result
+}
+
+func btfTypeToModel(ti *btfs.TypeInfo) *model.BtfType {
+	result := &model.BtfType{
+		BtfID:       int(ti.BtfID),
+		ID:          int(ti.ID),
+		Kind:        btfs.Kind(ti.Type),
+		Declaration: btfs.CDeclaration(ti.Type, ""),
+	}
+	if name := ti.Type.TypeName(); name != "" {
+		result.Name = &name
+	}
+	return result
+}
+
+func (r *Resolver) searchBtfTypes(btfID *uint32, name string, limit *int) ([]*model.BtfType, error) {
+	maxTypes := 100
+	if limit != nil {
+		maxTypes = *limit
+	}
+	types, err := r.BtfRepository.SearchTypes(btfID, name, maxTypes)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.BtfType, len(types))
+	for i, typ := range types {
+		result[i] = btfTypeToModel(typ)
+	}
+	return result, nil
+}
+
+func datasecToModel(ds *maps.Datasec) *model.MapDatasec {
+	result := &model.MapDatasec{
+		Name:      ds.Name,
+		Frozen:    ds.Frozen,
+		Variables: make([]*model.MapVariable, len(ds.Variables)),
+	}
+	for i, variable := range ds.Variables {
+		result.Variables[i] = &model.MapVariable{
+			Name:   variable.Name,
+			Type:   btfs.CDeclaration(variable.Type, ""),
+			Offset: int(variable.Offset),
+			Size:   int(variable.Size),
+			Value:  btfs.FormatValue(variable.Type, variable.Value),
+			Hex:    maps.FormatBytes(maps.DisplayFormatHex, variable.Value),
+		}
+	}
+	return result
+}
+
+func capacityToModel(c *maps.Capacity) *model.MapCapacity {
+	result := &model.MapCapacity{
+		Entries:    int(c.Entries),
+		MaxEntries: int(c.MaxEntries),
+		FillRatio:  c.FillRatio,
+		GrowthRate: c.GrowthRate,
+		Samples:    make([]*model.MapCapacitySample, len(c.Samples)),
+	}
+	if c.TimeToFull != nil {
+		seconds := c.TimeToFull.Seconds()
+		result.TimeToFull = &seconds
+	}
+	for i, sample := range c.Samples {
+		result.Samples[i] = &model.MapCapacitySample{
+			Time:    sample.Time.Format(time.RFC3339),
+			Entries: int(sample.Entries),
+		}
+	}
+	return result
 }
 
 func formatValue(format model.MapEntryFormat, value []byte) string {
@@ -104,14 +298,254 @@ func taskInfoToModel(ti *tasks.TaskInfo) *model.Task {
 	probeOffsetStr := "0x" + strconv.FormatUint(ti.ProbeOffset, 16)
 	probeAddrStr := "0x" + strconv.FormatUint(ti.ProbeAddr, 16)
 
-	return &model.Task{
+	task := &model.Task{
 		Pid:         int(ti.PID),
 		Fd:          int(ti.FD),
+		ProgramID:   int(ti.ProgramID),
 		Type:        ti.Type.String(),
 		Name:        &ti.Name,
 		ProbeOffset: &probeOffsetStr,
 		ProbeAddr:   &probeAddrStr,
 	}
+	if ti.Process != nil {
+		task.Process = processInfoToModel(ti.Process)
+	}
+	if ti.BinaryPath != "" {
+		task.BinaryPath = &ti.BinaryPath
+	}
+	if ti.Symbol != "" {
+		task.Symbol = &ti.Symbol
+	}
+	return task
+}
+
+func attachTargetToModel(at *progs.AttachTarget, err error) *model.AttachTarget {
+	result := &model.AttachTarget{
+		Error:            errorToModel(err),
+		BtfObjID:         int(at.BtfObjID),
+		BtfID:            int(at.BtfID),
+		IsKernel:         at.IsKernel,
+		TargetProgramIds: make([]int, len(at.TargetProgramIDs)),
+	}
+	if at.Function != "" {
+		result.Function = &at.Function
+	}
+	if at.Module != "" {
+		result.Module = &at.Module
+	}
+	for i, id := range at.TargetProgramIDs {
+		result.TargetProgramIds[i] = int(id)
+	}
+	return result
+}
+
+func holdersToModel(holders []*tasks.Holder) []*model.Holder {
+	result := make([]*model.Holder, 0, len(holders))
+	for _, holder := range holders {
+		fds := make([]int, len(holder.FDs))
+		for i, fd := range holder.FDs {
+			fds[i] = int(fd)
+		}
+		result = append(result, &model.Holder{
+			Process: processInfoToModel(holder.Process),
+			Fds:     fds,
+		})
+	}
+	return result
+}
+
+func processInfoToModel(pi *tasks.ProcessInfo) *model.Process {
+	process := &model.Process{
+		Pid:        int(pi.PID),
+		Comm:       pi.Comm,
+		Cmdline:    pi.Cmdline,
+		Exe:        pi.Exe,
+		UID:        int(pi.UID),
+		CgroupPath: pi.CgroupPath,
+	}
+	if !pi.StartTime.IsZero() {
+		startTime := pi.StartTime.Format(time.RFC3339)
+		process.StartTime = &startTime
+	}
+	if pi.ContainerID != "" {
+		process.ContainerID = &pi.ContainerID
+	}
+	if pi.ContainerRuntime != "" {
+		process.ContainerRuntime = &pi.ContainerRuntime
+	}
+	return process
+}
+
+func podInfoToModel(pi *k8s.PodInfo) *model.Pod {
+	if pi == nil {
+		return nil
+	}
+	pod := &model.Pod{
+		UID: pi.UID,
+	}
+	if pi.Namespace != "" {
+		pod.Namespace = &pi.Namespace
+	}
+	if pi.Name != "" {
+		pod.Name = &pi.Name
+	}
+	if pi.Container != "" {
+		pod.Container = &pi.Container
+	}
+	return pod
+}
+
+func linkInfoToModel(li *links.LinkInfo) *model.Link {
+	if li.Error != nil {
+		errString := li.Error.Error()
+		return &model.Link{
+			ID:    int(li.ID),
+			Error: &errString,
+		}
+	}
+
+	optString := func(value string) *string {
+		if value == "" {
+			return nil
+		}
+		return &value
+	}
+	optInt := func(value int) *int {
+		if value == 0 {
+			return nil
+		}
+		return &value
+	}
+	hexList := func(values []uint64) []string {
+		if values == nil {
+			return nil
+		}
+		result := make([]string, len(values))
+		for i, value := range values {
+			result[i] = "0x" + strconv.FormatUint(value, 16)
+		}
+		return result
+	}
+
+	result := &model.Link{
+		ID:          int(li.ID),
+		Type:        li.Type.String(),
+		ProgramID:   int(li.ProgramID),
+		Target:      li.Target(),
+		Tracepoint:  optString(li.TracepointName),
+		TargetObjID: optInt(int(li.TargetObjID)),
+		TargetBtfID: optInt(int(li.TargetBtfID)),
+		IterTarget:  optString(li.IterTarget),
+		Ifindex:     optInt(int(li.Ifindex)),
+		Ifname:      optString(li.Ifname()),
+		MapID:       optInt(int(li.MapID)),
+		Function:    optString(li.FuncName),
+		Path:        optString(li.Path),
+		Addresses:   hexList(li.Addresses),
+		Offsets:     hexList(li.Offsets),
+		Pid:         optInt(int(li.PID)),
+		Flags:       optInt(int(li.Flags)),
+	}
+	if li.HasAttachType() {
+		result.AttachType = optString(links.AttachTypeName(li.AttachType))
+	}
+	switch li.Type {
+	case links.PerfEvent:
+		result.PerfEventType = optString(li.PerfEventType.String())
+		if li.PerfEventType != links.PerfEventTracepoint && li.PerfEventType != links.PerfEventEvent {
+			result.Offset = optString("0x" + strconv.FormatUint(li.Offset, 16))
+		}
+	case links.Netfilter:
+		pf := int(li.NetfilterPf)
+		hooknum := int(li.NetfilterHooknum)
+		priority := int(li.NetfilterPriority)
+		result.NetfilterPf = &pf
+		result.NetfilterHooknum = &hooknum
+		result.NetfilterPriority = &priority
+	}
+	if li.Type == links.Cgroup {
+		result.CgroupID = optString(strconv.FormatUint(li.CgroupID, 10))
+	}
+	if li.Type == links.NetNs {
+		result.NetnsIno = optString(strconv.FormatUint(uint64(li.NetnsIno), 10))
+	}
+	return result
+}
+
+// attachedProgram resolves a program for attachment records, nil if it's not found (e.g. unloaded since)
+func (r *Resolver) attachedProgram(id ebpf.ProgramID) *model.Program {
+	prog, err := r.ProgsRepository.GetProg(id)
+	if err != nil {
+		return nil
+	}
+	return progInfoToModel(prog)
+}
+
+func (r *Resolver) interfaceInfoToModel(ii *netdevs.InterfaceInfo) *model.NetworkInterface {
+	result := &model.NetworkInterface{
+		Ifindex:      ii.Ifindex,
+		Name:         ii.Name,
+		Netns:        strconv.FormatUint(ii.NetnsIno, 10),
+		IsAgentNetns: ii.IsAgentNetns,
+		Xdp:          make([]*model.XdpAttachment, len(ii.XDP)),
+		TcFilters:    make([]*model.TcFilter, len(ii.TC)),
+		Tcx:          make([]*model.TcxAttachment, len(ii.TCX)),
+	}
+	for i, xdp := range ii.XDP {
+		result.Xdp[i] = &model.XdpAttachment{
+			Mode:      xdp.Mode.String(),
+			ProgramID: int(xdp.ProgramID),
+			Program:   r.attachedProgram(xdp.ProgramID),
+		}
+	}
+	for i, filter := range ii.TC {
+		result.TcFilters[i] = &model.TcFilter{
+			Direction:    string(filter.Direction),
+			ProgramID:    int(filter.ProgramID),
+			Program:      r.attachedProgram(filter.ProgramID),
+			Name:         filter.Name,
+			Handle:       int(filter.Handle),
+			Priority:     int(filter.Priority),
+			Protocol:     int(filter.Protocol),
+			Chain:        int(filter.Chain),
+			DirectAction: filter.DirectAction,
+		}
+	}
+	for i, tcx := range ii.TCX {
+		result.Tcx[i] = &model.TcxAttachment{
+			Direction: string(tcx.Direction),
+			ProgramID: int(tcx.ProgramID),
+			Program:   r.attachedProgram(tcx.ProgramID),
+		}
+		if tcx.LinkID != 0 {
+			if link, err := r.LinksRepository.GetLink(links.LinkID(tcx.LinkID)); err == nil {
+				result.Tcx[i].Link = linkInfoToModel(link)
+			}
+		}
+	}
+	return result
+}
+
+// cgroupInfoToModel converts a cgroup with attachments matching the filter only
+func (r *Resolver) cgroupInfoToModel(ci *cgroups.CgroupInfo, filter func(*cgroups.Attachment) bool) *model.Cgroup {
+	result := &model.Cgroup{
+		ID:          strconv.FormatUint(ci.ID, 10),
+		Path:        ci.Path,
+		Attachments: make([]*model.CgroupAttachment, 0),
+	}
+	for _, attachment := range ci.Attachments {
+		if !filter(attachment) {
+			continue
+		}
+		result.Attachments = append(result.Attachments, &model.CgroupAttachment{
+			AttachType: links.AttachTypeName(attachment.AttachType),
+			ProgramID:  int(attachment.ProgramID),
+			Program:    r.attachedProgram(attachment.ProgramID),
+			Direct:     attachment.Direct,
+			Flags:      cgroups.FlagNames(attachment.Flags),
+		})
+	}
+	return result
 }
 
 func buildConnectedGraph(progsMap map[ebpf.ProgramID]*progs.ProgInfo, mapsMap map[ebpf.MapID]*maps.MapInfo) *model.ConnectedGraph {
@@ -124,3 +558,361 @@ func buildConnectedGraph(progsMap map[ebpf.ProgramID]*progs.ProgInfo, mapsMap ma
 	}
 	return result
 }
+
+// statsStateToModel reports current stats state, with actionErr being an error of the preceding mutation (if any)
+func (r *Resolver) statsStateToModel(actionErr error) *model.BpfStats {
+	state, err := r.StatsRepository.GetState()
+	if actionErr != nil {
+		err = actionErr
+	}
+	result := &model.BpfStats{
+		Enabled:        state.Enabled,
+		EnabledByAgent: state.EnabledByAgent,
+	}
+	if state.ExpiresAt != nil {
+		expiresAt := state.ExpiresAt.Format(time.RFC3339)
+		result.ExpiresAt = &expiresAt
+	}
+	if err != nil {
+		errMsg := err.Error()
+		result.Error = &errMsg
+	}
+	return result
+}
+
+// checkConfirmation guards mutations that change state of the system, dry-run requests are always allowed
+func (r *Resolver) checkConfirmation(confirm *string, dryRun bool) error {
+	if dryRun {
+		return nil
+	}
+	if r.ConfirmationToken == "" {
+		return errors.New("the agent is started without --confirmation-token, only dryRun is allowed")
+	}
+	if confirm == nil || subtle.ConstantTimeCompare([]byte(*confirm), []byte(r.ConfirmationToken)) != 1 {
+		return errors.New("confirmation token doesn't match")
+	}
+	return nil
+}
+
+func errorToModel(err error) *string {
+	if err == nil {
+		return nil
+	}
+	errMsg := err.Error()
+	return &errMsg
+}
+
+// linkMutationResult reports the link state after a mutation, with actionErr being an error of the mutation (if any)
+func (r *Resolver) linkMutationResult(id int, dryRun bool, actionErr error) *model.LinkMutationResult {
+	result := &model.LinkMutationResult{
+		DryRun: dryRun,
+		Error:  errorToModel(actionErr),
+	}
+	if link, err := r.LinksRepository.GetLink(links.LinkID(id)); err == nil {
+		result.Link = linkInfoToModel(link)
+	}
+	return result
+}
+
+func (r *Resolver) mapMutationResult(id int, dryRun bool, actionErr error) *model.MapMutationResult {
+	result := &model.MapMutationResult{
+		DryRun:    dryRun,
+		Error:     errorToModel(actionErr),
+		ErrorCode: mapErrorCode(actionErr),
+	}
+	if emap, err := r.MapsRepository.GetMap(ebpf.MapID(id)); err == nil {
+		result.Map = mapInfoToModel(emap)
+	}
+	return result
+}
+
+func mapSpecFromModel(spec *model.MapSpecInput) (*maps.CreateSpec, error) {
+	mapType, err := maps.ParseMapType(spec.Type)
+	if err != nil {
+		return nil, err
+	}
+	result := &maps.CreateSpec{
+		Type:        mapType,
+		MaxEntries:  uint32(spec.MaxEntries),
+		Flags:       spec.Flags,
+		KeyLayout:   layoutFromModel(spec.KeyLayout),
+		ValueLayout: layoutFromModel(spec.ValueLayout),
+	}
+	if spec.KeySize != nil {
+		result.KeySize = uint32(*spec.KeySize)
+	}
+	if spec.ValueSize != nil {
+		result.ValueSize = uint32(*spec.ValueSize)
+	}
+	if spec.Name != nil {
+		result.Name = *spec.Name
+	}
+	if spec.InnerMap != nil {
+		if result.InnerMap, err = mapSpecFromModel(spec.InnerMap); err != nil {
+			return nil, fmt.Errorf("inner map: %w", err)
+		}
+	}
+	return result, nil
+}
+
+func layoutFromModel(fields []*model.MapLayoutFieldInput) []*maps.LayoutField {
+	if fields == nil {
+		return nil
+	}
+	result := make([]*maps.LayoutField, len(fields))
+	for i, field := range fields {
+		result[i] = &maps.LayoutField{Type: field.Type}
+		if field.Name != nil {
+			result[i].Name = *field.Name
+		}
+	}
+	return result
+}
+
+var mapOpKinds = map[model.MapOpKind]maps.OpKind{
+	model.MapOpKindCreate: maps.OpCreate,
+	model.MapOpKindUpdate: maps.OpUpdate,
+	model.MapOpKindDelete: maps.OpDelete,
+}
+
+var mapOpStatuses = map[maps.OpStatus]model.MapOpStatus{
+	maps.OpOK:       model.MapOpStatusOk,
+	maps.OpNotFound: model.MapOpStatusNotFound,
+	maps.OpExists:   model.MapOpStatusExists,
+	maps.OpFailed:   model.MapOpStatusError,
+	maps.OpSkipped:  model.MapOpStatusSkipped,
+}
+
+func mapOpFromModel(op *model.MapOpInput) *maps.Op {
+	return &maps.Op{
+		Kind:   mapOpKinds[op.Kind],
+		Key:    op.Key,
+		Values: op.Values,
+		CPU:    op.CPU,
+	}
+}
+
+func mapBatchResultToModel(ops []*model.MapOpInput, result *maps.BatchResult) *model.MapBatchResult {
+	results := make([]*model.MapOpResult, len(result.Results))
+	for i, opResult := range result.Results {
+		results[i] = &model.MapOpResult{
+			Kind:       ops[i].Kind,
+			Key:        ops[i].Key,
+			Status:     mapOpStatuses[opResult.Status],
+			Error:      errorToModel(opResult.Err),
+			RolledBack: opResult.RolledBack,
+		}
+	}
+	return &model.MapBatchResult{
+		Results:       results,
+		Failed:        result.Failed,
+		Batched:       result.Batched,
+		RolledBack:    result.RolledBack,
+		RollbackError: errorToModel(result.RollbackErr),
+	}
+}
+
+func valueTarget(cpu *int, field *string, retries *int) *maps.ValueTarget {
+	target := &maps.ValueTarget{CPU: cpu, Retries: 3}
+	if field != nil {
+		target.Field = *field
+	}
+	if retries != nil {
+		target.Retries = *retries
+	}
+	return target
+}
+
+func valueChangeToModel(change *maps.ValueChange, err error, format maps.DisplayFormat) *model.MapValueChangeResult {
+	result := &model.MapValueChangeResult{
+		Error:     errorToModel(err),
+		ErrorCode: mapErrorCode(err),
+		Values:    []string{},
+	}
+	if change == nil {
+		return result
+	}
+	result.Swapped = change.Swapped
+	result.Attempts = change.Attempts
+	result.RaceWindow = change.Window.Seconds()
+	for _, value := range change.Values {
+		// BTF tells signedness of numbers, which plain number format doesn't know
+		if format == maps.DisplayFormatNumber && change.Type != nil {
+			result.Values = append(result.Values, btfs.FormatValue(change.Type, value))
+		} else {
+			result.Values = append(result.Values, maps.FormatBytes(format, value))
+		}
+	}
+	return result
+}
+
+func mutationToModel(mutation *maps.Mutation, keyFormat maps.DisplayFormat, valueFormat maps.DisplayFormat) *model.MapMutation {
+	result := &model.MapMutation{
+		ID:       int(mutation.ID),
+		MapID:    int(mutation.MapID),
+		MapName:  mutation.MapName,
+		Time:     mutation.Time.Format(time.RFC3339),
+		Kind:     mutation.Kind,
+		Key:      maps.FormatBytes(keyFormat, mutation.Key),
+		Previous: formatSlots(mutation.Previous, valueFormat),
+		Written:  formatSlots(mutation.Written, valueFormat),
+		Undone:   mutation.Undone,
+	}
+	if mutation.UndoOf != 0 {
+		undoOf := int(mutation.UndoOf)
+		result.UndoOf = &undoOf
+	}
+	return result
+}
+
+func formatSlots(slots [][]byte, format maps.DisplayFormat) []string {
+	if slots == nil {
+		return nil
+	}
+	result := make([]string, len(slots))
+	for i, slot := range slots {
+		result[i] = maps.FormatBytes(format, slot)
+	}
+	return result
+}
+
+func (r *Resolver) mapClearResult(id int, dryRun bool, affected int, actionErr error) *model.MapClearResult {
+	result := &model.MapClearResult{
+		DryRun:    dryRun,
+		Affected:  affected,
+		Error:     errorToModel(actionErr),
+		ErrorCode: mapErrorCode(actionErr),
+	}
+	if emap, err := r.MapsRepository.GetMap(ebpf.MapID(id)); err == nil {
+		result.Map = mapInfoToModel(emap)
+	}
+	return result
+}
+
+func mapUpdateResult(err error) *model.MapUpdateValueResult {
+	return &model.MapUpdateValueResult{
+		Error:     errorToModel(err),
+		ErrorCode: mapErrorCode(err),
+	}
+}
+
+func mapErrorCode(err error) *model.MapErrorCode {
+	var code model.MapErrorCode
+	switch {
+	case errors.Is(err, maps.ErrFrozen):
+		code = model.MapErrorCodeFrozen
+	case errors.Is(err, maps.ErrReadOnly):
+		code = model.MapErrorCodeReadOnly
+	case errors.Is(err, maps.ErrConflict):
+		code = model.MapErrorCodeConflict
+	default:
+		return nil
+	}
+	return &code
+}
+
+func (r *Resolver) programMutationResult(id int, dryRun bool, actionErr error) *model.ProgramMutationResult {
+	result := &model.ProgramMutationResult{
+		DryRun: dryRun,
+		Error:  errorToModel(actionErr),
+	}
+	if prog, err := r.ProgsRepository.GetProg(ebpf.ProgramID(id)); err == nil {
+		result.Program = progInfoToModel(prog)
+	}
+	return result
+}
+
+// fillUnpinnedObject sets state of an object after its pin is removed,
+// it's left empty if the kernel has destroyed the object
+func (r *Resolver) fillUnpinnedObject(result *model.UnpinResult, obj *pins.PinnedObject) {
+	switch obj.Type {
+	case pins.ObjectTypeProgram:
+		prog, err := ebpf.NewProgramFromID(ebpf.ProgramID(obj.ID))
+		if err != nil {
+			return
+		}
+		prog.Close()
+		if info, err := r.ProgsRepository.GetProg(ebpf.ProgramID(obj.ID)); err == nil {
+			result.Program = progInfoToModel(info)
+		}
+	case pins.ObjectTypeMap:
+		emap, err := ebpf.NewMapFromID(ebpf.MapID(obj.ID))
+		if err != nil {
+			return
+		}
+		emap.Close()
+		if info, err := r.MapsRepository.GetMap(ebpf.MapID(obj.ID)); err == nil {
+			result.Map = mapInfoToModel(info)
+			if !result.DryRun {
+				// pins are refreshed with the next scan of bpf_dir
+				remaining := make([]string, 0, len(result.Map.Pins))
+				for _, pin := range result.Map.Pins {
+					if pin != obj.Path {
+						remaining = append(remaining, pin)
+					}
+				}
+				result.Map.Pins = remaining
+				result.Map.IsPinned = len(remaining) > 0
+			}
+		}
+	case pins.ObjectTypeLink:
+		fd, err := links.NewLinkFDFromID(links.LinkID(obj.ID))
+		if err != nil {
+			return
+		}
+		unix.Close(fd)
+		if info, err := r.LinksRepository.GetLink(links.LinkID(obj.ID)); err == nil {
+			result.Link = linkInfoToModel(info)
+		}
+	}
+}
+
+var mapChangeKinds = map[model.MapChangeKind]maps.ChangeKind{
+	model.MapChangeKindAdded:    maps.ChangeAdded,
+	model.MapChangeKindRemoved:  maps.ChangeRemoved,
+	model.MapChangeKindModified: maps.ChangeModified,
+}
+
+func changesFilterFromModel(filter *model.MapChangesFilter, keySize uint32, keyFormat maps.DisplayFormat) (*maps.ChangesFilter, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	result := &maps.ChangesFilter{}
+	for _, kind := range filter.Kinds {
+		result.Kinds = append(result.Kinds, mapChangeKinds[kind])
+	}
+	for _, key := range filter.Keys {
+		keyBytes, err := maps.RestoreBytes(keyFormat, key, keySize)
+		if err != nil {
+			return nil, fmt.Errorf("filter key %s: %w", key, err)
+		}
+		result.Keys = append(result.Keys, keyBytes)
+	}
+	return result, nil
+}
+
+func changeSetToModel(set *maps.ChangeSet, keyFormat maps.DisplayFormat, valueFormat maps.DisplayFormat) *model.MapChangeSet {
+	result := &model.MapChangeSet{
+		Time:    set.Time.Format(time.RFC3339Nano),
+		Error:   errorToModel(set.Err),
+		Changes: []*model.MapEntryChange{},
+	}
+	for _, change := range set.Changes {
+		entry := &model.MapEntryChange{
+			Key:      maps.FormatBytes(keyFormat, change.Key),
+			Previous: formatSlots(change.Previous, valueFormat),
+			Value:    formatSlots(change.Value, valueFormat),
+			Deltas:   []*model.MapValueDelta{},
+		}
+		for kind, mapsKind := range mapChangeKinds {
+			if mapsKind == change.Kind {
+				entry.Kind = kind
+			}
+		}
+		for _, delta := range change.Deltas {
+			entry.Deltas = append(entry.Deltas, &model.MapValueDelta{Field: delta.Field, Delta: float64(delta.Delta)})
+		}
+		result.Changes = append(result.Changes, entry)
+	}
+	return result
+}
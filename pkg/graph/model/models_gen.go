@@ -8,27 +8,210 @@ import (
 	"strconv"
 )
 
+type AttachTarget struct {
+	Error            *string `json:"error,omitempty"`
+	BtfObjID         int     `json:"btfObjId"`
+	BtfID            int     `json:"btfId"`
+	Function         *string `json:"function,omitempty"`
+	Module           *string `json:"module,omitempty"`
+	IsKernel         bool    `json:"isKernel"`
+	TargetProgramIds []int   `json:"targetProgramIds"`
+}
+
+type BpfStats struct {
+	Error          *string `json:"error,omitempty"`
+	Enabled        bool    `json:"enabled"`
+	EnabledByAgent bool    `json:"enabledByAgent"`
+	ExpiresAt      *string `json:"expiresAt,omitempty"`
+}
+
+type Btf struct {
+	ID       int        `json:"id"`
+	Name     *string    `json:"name,omitempty"`
+	Size     int        `json:"size"`
+	IsKernel bool       `json:"isKernel"`
+	Programs []*Program `json:"programs"`
+	Maps     []*Map     `json:"maps"`
+	Types    []*BtfType `json:"types"`
+}
+
+type BtfType struct {
+	BtfID       int     `json:"btfId"`
+	ID          int     `json:"id"`
+	Kind        string  `json:"kind"`
+	Name        *string `json:"name,omitempty"`
+	Declaration string  `json:"declaration"`
+	C           string  `json:"c"`
+}
+
+type Cgroup struct {
+	ID          string              `json:"id"`
+	Path        string              `json:"path"`
+	Attachments []*CgroupAttachment `json:"attachments"`
+	Pod         *Pod                `json:"pod,omitempty"`
+}
+
+type CgroupAttachment struct {
+	AttachType string   `json:"attachType"`
+	ProgramID  int      `json:"programId"`
+	Program    *Program `json:"program,omitempty"`
+	Direct     bool     `json:"direct"`
+	Flags      []string `json:"flags"`
+}
+
 type ConnectedGraph struct {
 	Programs []*Program `json:"programs"`
 	Maps     []*Map     `json:"maps"`
 }
 
+type FunctionUsage struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type Holder struct {
+	Process *Process `json:"process"`
+	Fds     []int    `json:"fds"`
+}
+
+type Instruction struct {
+	Offset     int         `json:"offset"`
+	Opcode     int         `json:"opcode"`
+	OpcodeName string      `json:"opcodeName"`
+	Dst        int         `json:"dst"`
+	Src        int         `json:"src"`
+	Off        int         `json:"off"`
+	Imm        string      `json:"imm"`
+	MapID      *int        `json:"mapId,omitempty"`
+	MapName    *string     `json:"mapName,omitempty"`
+	Function   *string     `json:"function,omitempty"`
+	Source     *SourceLine `json:"source,omitempty"`
+	Text       string      `json:"text"`
+}
+
+type JitedFunction struct {
+	Address string  `json:"address"`
+	Symbol  *string `json:"symbol,omitempty"`
+	Size    int     `json:"size"`
+}
+
+type Link struct {
+	ID                int       `json:"id"`
+	Error             *string   `json:"error,omitempty"`
+	Type              string    `json:"type"`
+	ProgramID         int       `json:"programId"`
+	Program           *Program  `json:"program,omitempty"`
+	AttachType        *string   `json:"attachType,omitempty"`
+	Target            string    `json:"target"`
+	Tracepoint        *string   `json:"tracepoint,omitempty"`
+	TargetObjID       *int      `json:"targetObjId,omitempty"`
+	TargetBtfID       *int      `json:"targetBtfId,omitempty"`
+	CgroupID          *string   `json:"cgroupId,omitempty"`
+	IterTarget        *string   `json:"iterTarget,omitempty"`
+	NetnsIno          *string   `json:"netnsIno,omitempty"`
+	Ifindex           *int      `json:"ifindex,omitempty"`
+	Ifname            *string   `json:"ifname,omitempty"`
+	MapID             *int      `json:"mapId,omitempty"`
+	PerfEventType     *string   `json:"perfEventType,omitempty"`
+	Function          *string   `json:"function,omitempty"`
+	Path              *string   `json:"path,omitempty"`
+	Offset            *string   `json:"offset,omitempty"`
+	Addresses         []string  `json:"addresses,omitempty"`
+	Offsets           []string  `json:"offsets,omitempty"`
+	Pid               *int      `json:"pid,omitempty"`
+	Flags             *int      `json:"flags,omitempty"`
+	NetfilterPf       *int      `json:"netfilterPf,omitempty"`
+	NetfilterHooknum  *int      `json:"netfilterHooknum,omitempty"`
+	NetfilterPriority *int      `json:"netfilterPriority,omitempty"`
+	Holders           []*Holder `json:"holders"`
+}
+
+type LinkMutationResult struct {
+	Error  *string `json:"error,omitempty"`
+	DryRun bool    `json:"dryRun"`
+	Link   *Link   `json:"link,omitempty"`
+}
+
 type Map struct {
-	ID                int         `json:"id"`
-	Error             *string     `json:"error,omitempty"`
-	Name              *string     `json:"name,omitempty"`
-	Type              string      `json:"type"`
-	Flags             *int        `json:"flags,omitempty"`
-	IsPinned          bool        `json:"isPinned"`
-	Pins              []string    `json:"pins,omitempty"`
-	KeySize           *int        `json:"keySize,omitempty"`
-	ValueSize         *int        `json:"valueSize,omitempty"`
-	MaxEntries        *int        `json:"maxEntries,omitempty"`
-	IsPerCPU          bool        `json:"isPerCPU"`
-	IsLookupSupported bool        `json:"isLookupSupported"`
-	Entries           []*MapEntry `json:"entries"`
-	EntriesCount      int         `json:"entriesCount"`
-	Programs          []*Program  `json:"programs"`
+	ID                    int          `json:"id"`
+	Error                 *string      `json:"error,omitempty"`
+	Name                  *string      `json:"name,omitempty"`
+	Type                  string       `json:"type"`
+	Flags                 *int         `json:"flags,omitempty"`
+	FlagNames             []string     `json:"flagNames"`
+	Frozen                bool         `json:"frozen"`
+	MemlockBytes          *int         `json:"memlockBytes,omitempty"`
+	MapExtra              *int         `json:"mapExtra,omitempty"`
+	OwnerProgramType      *string      `json:"ownerProgramType,omitempty"`
+	IsPinned              bool         `json:"isPinned"`
+	Pins                  []string     `json:"pins,omitempty"`
+	KeySize               *int         `json:"keySize,omitempty"`
+	ValueSize             *int         `json:"valueSize,omitempty"`
+	MaxEntries            *int         `json:"maxEntries,omitempty"`
+	IsPerCPU              bool         `json:"isPerCPU"`
+	IsLookupSupported     bool         `json:"isLookupSupported"`
+	Entries               []*MapEntry  `json:"entries"`
+	EntriesCount          int          `json:"entriesCount"`
+	Programs              []*Program   `json:"programs"`
+	Holders               []*Holder    `json:"holders"`
+	BtfID                 *int         `json:"btfId,omitempty"`
+	BtfKeyTypeID          *int         `json:"btfKeyTypeId,omitempty"`
+	BtfValueTypeID        *int         `json:"btfValueTypeId,omitempty"`
+	BtfVmlinuxValueTypeID *int         `json:"btfVmlinuxValueTypeId,omitempty"`
+	Btf                   *Btf         `json:"btf,omitempty"`
+	KeyType               *BtfType     `json:"keyType,omitempty"`
+	ValueType             *BtfType     `json:"valueType,omitempty"`
+	Datasec               *MapDatasec  `json:"datasec,omitempty"`
+	Capacity              *MapCapacity `json:"capacity,omitempty"`
+}
+
+type MapBatchResult struct {
+	Error         *string        `json:"error,omitempty"`
+	ErrorCode     *MapErrorCode  `json:"errorCode,omitempty"`
+	Results       []*MapOpResult `json:"results"`
+	Failed        int            `json:"failed"`
+	Batched       int            `json:"batched"`
+	RolledBack    bool           `json:"rolledBack"`
+	RollbackError *string        `json:"rollbackError,omitempty"`
+}
+
+type MapCapacity struct {
+	Entries    int                  `json:"entries"`
+	MaxEntries int                  `json:"maxEntries"`
+	FillRatio  float64              `json:"fillRatio"`
+	GrowthRate float64              `json:"growthRate"`
+	TimeToFull *float64             `json:"timeToFull,omitempty"`
+	Samples    []*MapCapacitySample `json:"samples"`
+}
+
+type MapCapacitySample struct {
+	Time    string `json:"time"`
+	Entries int    `json:"entries"`
+}
+
+type MapChangeSet struct {
+	Time    string            `json:"time"`
+	Error   *string           `json:"error,omitempty"`
+	Changes []*MapEntryChange `json:"changes"`
+}
+
+type MapChangesFilter struct {
+	Kinds []MapChangeKind `json:"kinds,omitempty"`
+	Keys  []string        `json:"keys,omitempty"`
+}
+
+type MapClearResult struct {
+	Error     *string       `json:"error,omitempty"`
+	ErrorCode *MapErrorCode `json:"errorCode,omitempty"`
+	DryRun    bool          `json:"dryRun"`
+	Affected  int           `json:"affected"`
+	Map       *Map          `json:"map,omitempty"`
+}
+
+type MapDatasec struct {
+	Name      string         `json:"name"`
+	Frozen    bool           `json:"frozen"`
+	Variables []*MapVariable `json:"variables"`
 }
 
 type MapEntry struct {
@@ -37,36 +220,276 @@ type MapEntry struct {
 	CPUValues []string `json:"cpuValues"`
 }
 
+type MapEntryChange struct {
+	Kind     MapChangeKind    `json:"kind"`
+	Key      string           `json:"key"`
+	Previous []string         `json:"previous,omitempty"`
+	Value    []string         `json:"value,omitempty"`
+	Deltas   []*MapValueDelta `json:"deltas"`
+}
+
+type MapLayoutFieldInput struct {
+	Name *string `json:"name,omitempty"`
+	Type string  `json:"type"`
+}
+
+type MapMutation struct {
+	ID       int      `json:"id"`
+	MapID    int      `json:"mapId"`
+	MapName  string   `json:"mapName"`
+	Time     string   `json:"time"`
+	Kind     string   `json:"kind"`
+	Key      string   `json:"key"`
+	Previous []string `json:"previous,omitempty"`
+	Written  []string `json:"written,omitempty"`
+	Undone   bool     `json:"undone"`
+	UndoOf   *int     `json:"undoOf,omitempty"`
+}
+
+type MapMutationResult struct {
+	Error     *string       `json:"error,omitempty"`
+	ErrorCode *MapErrorCode `json:"errorCode,omitempty"`
+	DryRun    bool          `json:"dryRun"`
+	Map       *Map          `json:"map,omitempty"`
+}
+
+type MapOpInput struct {
+	Kind   MapOpKind `json:"kind"`
+	Key    string    `json:"key"`
+	Values []string  `json:"values,omitempty"`
+	CPU    *int      `json:"cpu,omitempty"`
+}
+
+type MapOpResult struct {
+	Kind       MapOpKind   `json:"kind"`
+	Key        string      `json:"key"`
+	Status     MapOpStatus `json:"status"`
+	Error      *string     `json:"error,omitempty"`
+	RolledBack bool        `json:"rolledBack"`
+}
+
 type MapPinningResult struct {
 	Error *string `json:"error,omitempty"`
 }
 
+type MapSpecInput struct {
+	Type        string                 `json:"type"`
+	KeySize     *int                   `json:"keySize,omitempty"`
+	ValueSize   *int                   `json:"valueSize,omitempty"`
+	MaxEntries  int                    `json:"maxEntries"`
+	Flags       []string               `json:"flags,omitempty"`
+	Name        *string                `json:"name,omitempty"`
+	InnerMap    *MapSpecInput          `json:"innerMap,omitempty"`
+	KeyLayout   []*MapLayoutFieldInput `json:"keyLayout,omitempty"`
+	ValueLayout []*MapLayoutFieldInput `json:"valueLayout,omitempty"`
+}
+
+type MapUndoResult struct {
+	Error     *string       `json:"error,omitempty"`
+	ErrorCode *MapErrorCode `json:"errorCode,omitempty"`
+	Mutation  *MapMutation  `json:"mutation,omitempty"`
+}
+
 type MapUpdateValueResult struct {
-	Error *string `json:"error,omitempty"`
+	Error     *string       `json:"error,omitempty"`
+	ErrorCode *MapErrorCode `json:"errorCode,omitempty"`
+}
+
+type MapValueChangeResult struct {
+	Error      *string       `json:"error,omitempty"`
+	ErrorCode  *MapErrorCode `json:"errorCode,omitempty"`
+	Swapped    bool          `json:"swapped"`
+	Attempts   int           `json:"attempts"`
+	Values     []string      `json:"values"`
+	RaceWindow float64       `json:"raceWindow"`
+}
+
+type MapValueDelta struct {
+	Field string  `json:"field"`
+	Delta float64 `json:"delta"`
+}
+
+type MapVariable struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Size   int    `json:"size"`
+	Value  string `json:"value"`
+	Hex    string `json:"hex"`
+}
+
+type MemlockObject struct {
+	ObjectType IDType   `json:"objectType"`
+	ID         int      `json:"id"`
+	Bytes      int      `json:"bytes"`
+	Program    *Program `json:"program,omitempty"`
+	Map        *Map     `json:"map,omitempty"`
+}
+
+type MemlockSummary struct {
+	TotalBytes    int                 `json:"totalBytes"`
+	MapsBytes     int                 `json:"mapsBytes"`
+	ProgramsBytes int                 `json:"programsBytes"`
+	ByType        []*MemlockTypeTotal `json:"byType"`
+	Largest       []*MemlockObject    `json:"largest"`
+}
+
+type MemlockTypeTotal struct {
+	ObjectType IDType `json:"objectType"`
+	Type       string `json:"type"`
+	Count      int    `json:"count"`
+	Bytes      int    `json:"bytes"`
+}
+
+type NetworkInterface struct {
+	Ifindex      int              `json:"ifindex"`
+	Name         string           `json:"name"`
+	Netns        string           `json:"netns"`
+	IsAgentNetns bool             `json:"isAgentNetns"`
+	Xdp          []*XdpAttachment `json:"xdp"`
+	TcFilters    []*TcFilter      `json:"tcFilters"`
+	Tcx          []*TcxAttachment `json:"tcx"`
+}
+
+type Pod struct {
+	UID       string  `json:"uid"`
+	Namespace *string `json:"namespace,omitempty"`
+	Name      *string `json:"name,omitempty"`
+	Container *string `json:"container,omitempty"`
+}
+
+type Process struct {
+	Pid              int     `json:"pid"`
+	Comm             string  `json:"comm"`
+	Cmdline          string  `json:"cmdline"`
+	Exe              string  `json:"exe"`
+	UID              int     `json:"uid"`
+	StartTime        *string `json:"startTime,omitempty"`
+	CgroupPath       string  `json:"cgroupPath"`
+	ContainerID      *string `json:"containerId,omitempty"`
+	ContainerRuntime *string `json:"containerRuntime,omitempty"`
+	Pod              *Pod    `json:"pod,omitempty"`
 }
 
 type Program struct {
-	ID          int      `json:"id"`
-	Error       *string  `json:"error,omitempty"`
-	Name        *string  `json:"name,omitempty"`
-	Type        string   `json:"type"`
-	Tag         *string  `json:"tag,omitempty"`
-	RunTime     *float64 `json:"runTime,omitempty"`
-	RunCount    *int     `json:"runCount,omitempty"`
-	BtfID       *int     `json:"btfId,omitempty"`
-	VerifierLog *string  `json:"verifierLog,omitempty"`
-	IsPinned    *bool    `json:"isPinned,omitempty"`
-	Maps        []*Map   `json:"maps"`
-	Tasks       []*Task  `json:"tasks"`
+	ID                 int                 `json:"id"`
+	Error              *string             `json:"error,omitempty"`
+	Name               *string             `json:"name,omitempty"`
+	Type               string              `json:"type"`
+	Tag                *string             `json:"tag,omitempty"`
+	RunTime            *float64            `json:"runTime,omitempty"`
+	RunCount           *int                `json:"runCount,omitempty"`
+	RunStatsEnabled    bool                `json:"runStatsEnabled"`
+	BtfID              *int                `json:"btfId,omitempty"`
+	VerifierLog        *string             `json:"verifierLog,omitempty"`
+	IsPinned           *bool               `json:"isPinned,omitempty"`
+	Maps               []*Map              `json:"maps"`
+	Tasks              []*Task             `json:"tasks"`
+	Instructions       []*Instruction      `json:"instructions"`
+	Disassembly        *string             `json:"disassembly,omitempty"`
+	Functions          []*ProgramFunction  `json:"functions"`
+	SourceLines        []*SourceLine       `json:"sourceLines"`
+	JitedSize          *int                `json:"jitedSize,omitempty"`
+	XlatedSize         *int                `json:"xlatedSize,omitempty"`
+	JitedFunctionCount *int                `json:"jitedFunctionCount,omitempty"`
+	JitedFunctions     []*JitedFunction    `json:"jitedFunctions"`
+	JitedImage         *string             `json:"jitedImage,omitempty"`
+	JitedDisassembly   *string             `json:"jitedDisassembly,omitempty"`
+	Helpers            []*FunctionUsage    `json:"helpers"`
+	Kfuncs             []*FunctionUsage    `json:"kfuncs"`
+	UnresolvedCalls    int                 `json:"unresolvedCalls"`
+	Links              []*Link             `json:"links"`
+	Interfaces         []*NetworkInterface `json:"interfaces"`
+	Cgroups            []*Cgroup           `json:"cgroups"`
+	Holders            []*Holder           `json:"holders"`
+	AttachTarget       *AttachTarget       `json:"attachTarget,omitempty"`
+	MemlockBytes       *int                `json:"memlockBytes,omitempty"`
+	Btf                *Btf                `json:"btf,omitempty"`
+}
+
+type ProgramFunction struct {
+	Offset           int    `json:"offset"`
+	Name             string `json:"name"`
+	Prototype        string `json:"prototype"`
+	InstructionCount int    `json:"instructionCount"`
+}
+
+type ProgramMutationResult struct {
+	Error   *string  `json:"error,omitempty"`
+	DryRun  bool     `json:"dryRun"`
+	Program *Program `json:"program,omitempty"`
+}
+
+type ProgramSecurityFinding struct {
+	Program         *Program         `json:"program"`
+	Helpers         []*FunctionUsage `json:"helpers"`
+	UnresolvedCalls int              `json:"unresolvedCalls"`
+	Error           *string          `json:"error,omitempty"`
+}
+
+type SecuritySummary struct {
+	DangerousHelpers []string                  `json:"dangerousHelpers"`
+	Programs         []*ProgramSecurityFinding `json:"programs"`
+	Complete         bool                      `json:"complete"`
+}
+
+type SourceLine struct {
+	Offset           int    `json:"offset"`
+	File             string `json:"file"`
+	Line             int    `json:"line"`
+	Column           int    `json:"column"`
+	Text             string `json:"text"`
+	InstructionCount int    `json:"instructionCount"`
 }
 
 type Task struct {
-	Pid         int     `json:"pid"`
-	Fd          int     `json:"fd"`
-	Type        string  `json:"type"`
-	Name        *string `json:"name,omitempty"`
-	ProbeOffset *string `json:"probeOffset,omitempty"`
-	ProbeAddr   *string `json:"probeAddr,omitempty"`
+	Pid         int      `json:"pid"`
+	Fd          int      `json:"fd"`
+	ProgramID   int      `json:"programId"`
+	Program     *Program `json:"program,omitempty"`
+	Type        string   `json:"type"`
+	Name        *string  `json:"name,omitempty"`
+	ProbeOffset *string  `json:"probeOffset,omitempty"`
+	ProbeAddr   *string  `json:"probeAddr,omitempty"`
+	Process     *Process `json:"process,omitempty"`
+	BinaryPath  *string  `json:"binaryPath,omitempty"`
+	Symbol      *string  `json:"symbol,omitempty"`
+}
+
+type TcFilter struct {
+	Direction    string   `json:"direction"`
+	ProgramID    int      `json:"programId"`
+	Program      *Program `json:"program,omitempty"`
+	Name         string   `json:"name"`
+	Handle       int      `json:"handle"`
+	Priority     int      `json:"priority"`
+	Protocol     int      `json:"protocol"`
+	Chain        int      `json:"chain"`
+	DirectAction bool     `json:"directAction"`
+}
+
+type TcxAttachment struct {
+	Direction string   `json:"direction"`
+	ProgramID int      `json:"programId"`
+	Program   *Program `json:"program,omitempty"`
+	Link      *Link    `json:"link,omitempty"`
+}
+
+type UnpinResult struct {
+	Error      *string  `json:"error,omitempty"`
+	DryRun     bool     `json:"dryRun"`
+	Path       string   `json:"path"`
+	ObjectType *string  `json:"objectType,omitempty"`
+	ObjectID   *int     `json:"objectId,omitempty"`
+	Program    *Program `json:"program,omitempty"`
+	Map        *Map     `json:"map,omitempty"`
+	Link       *Link    `json:"link,omitempty"`
+}
+
+type XdpAttachment struct {
+	Mode      string   `json:"mode"`
+	ProgramID int      `json:"programId"`
+	Program   *Program `json:"program,omitempty"`
 }
 
 type IDType string
@@ -110,6 +533,49 @@ func (e IDType) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
+type MapChangeKind string
+
+const (
+	MapChangeKindAdded    MapChangeKind = "ADDED"
+	MapChangeKindRemoved  MapChangeKind = "REMOVED"
+	MapChangeKindModified MapChangeKind = "MODIFIED"
+)
+
+var AllMapChangeKind = []MapChangeKind{
+	MapChangeKindAdded,
+	MapChangeKindRemoved,
+	MapChangeKindModified,
+}
+
+func (e MapChangeKind) IsValid() bool {
+	switch e {
+	case MapChangeKindAdded, MapChangeKindRemoved, MapChangeKindModified:
+		return true
+	}
+	return false
+}
+
+func (e MapChangeKind) String() string {
+	return string(e)
+}
+
+func (e *MapChangeKind) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MapChangeKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MapChangeKind", str)
+	}
+	return nil
+}
+
+func (e MapChangeKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type MapEntryFormat string
 
 const (
@@ -152,3 +618,177 @@ func (e *MapEntryFormat) UnmarshalGQL(v interface{}) error {
 func (e MapEntryFormat) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
+
+type MapErrorCode string
+
+const (
+	MapErrorCodeFrozen   MapErrorCode = "FROZEN"
+	MapErrorCodeReadOnly MapErrorCode = "READ_ONLY"
+	MapErrorCodeConflict MapErrorCode = "CONFLICT"
+)
+
+var AllMapErrorCode = []MapErrorCode{
+	MapErrorCodeFrozen,
+	MapErrorCodeReadOnly,
+	MapErrorCodeConflict,
+}
+
+func (e MapErrorCode) IsValid() bool {
+	switch e {
+	case MapErrorCodeFrozen, MapErrorCodeReadOnly, MapErrorCodeConflict:
+		return true
+	}
+	return false
+}
+
+func (e MapErrorCode) String() string {
+	return string(e)
+}
+
+func (e *MapErrorCode) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MapErrorCode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MapErrorCode", str)
+	}
+	return nil
+}
+
+func (e MapErrorCode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type MapErrorPolicy string
+
+const (
+	MapErrorPolicyStopOnError MapErrorPolicy = "STOP_ON_ERROR"
+	MapErrorPolicyContinue    MapErrorPolicy = "CONTINUE"
+)
+
+var AllMapErrorPolicy = []MapErrorPolicy{
+	MapErrorPolicyStopOnError,
+	MapErrorPolicyContinue,
+}
+
+func (e MapErrorPolicy) IsValid() bool {
+	switch e {
+	case MapErrorPolicyStopOnError, MapErrorPolicyContinue:
+		return true
+	}
+	return false
+}
+
+func (e MapErrorPolicy) String() string {
+	return string(e)
+}
+
+func (e *MapErrorPolicy) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MapErrorPolicy(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MapErrorPolicy", str)
+	}
+	return nil
+}
+
+func (e MapErrorPolicy) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type MapOpKind string
+
+const (
+	MapOpKindCreate MapOpKind = "CREATE"
+	MapOpKindUpdate MapOpKind = "UPDATE"
+	MapOpKindDelete MapOpKind = "DELETE"
+)
+
+var AllMapOpKind = []MapOpKind{
+	MapOpKindCreate,
+	MapOpKindUpdate,
+	MapOpKindDelete,
+}
+
+func (e MapOpKind) IsValid() bool {
+	switch e {
+	case MapOpKindCreate, MapOpKindUpdate, MapOpKindDelete:
+		return true
+	}
+	return false
+}
+
+func (e MapOpKind) String() string {
+	return string(e)
+}
+
+func (e *MapOpKind) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MapOpKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MapOpKind", str)
+	}
+	return nil
+}
+
+func (e MapOpKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type MapOpStatus string
+
+const (
+	MapOpStatusOk       MapOpStatus = "OK"
+	MapOpStatusNotFound MapOpStatus = "NOT_FOUND"
+	MapOpStatusExists   MapOpStatus = "EXISTS"
+	MapOpStatusError    MapOpStatus = "ERROR"
+	MapOpStatusSkipped  MapOpStatus = "SKIPPED"
+)
+
+var AllMapOpStatus = []MapOpStatus{
+	MapOpStatusOk,
+	MapOpStatusNotFound,
+	MapOpStatusExists,
+	MapOpStatusError,
+	MapOpStatusSkipped,
+}
+
+func (e MapOpStatus) IsValid() bool {
+	switch e {
+	case MapOpStatusOk, MapOpStatusNotFound, MapOpStatusExists, MapOpStatusError, MapOpStatusSkipped:
+		return true
+	}
+	return false
+}
+
+func (e MapOpStatus) String() string {
+	return string(e)
+}
+
+func (e *MapOpStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MapOpStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MapOpStatus", str)
+	}
+	return nil
+}
+
+func (e MapOpStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
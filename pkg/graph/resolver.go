@@ -1,9 +1,15 @@
 package graph
 
 import (
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/btfs"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/cgroups"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/links"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/maps"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/netdevs"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/progs"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/stats"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/tasks"
+	"github.com/ebpfdev/dev-agent/pkg/k8s"
 )
 
 //go:generate rm -f generated/generated.go
@@ -14,7 +20,19 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	ProgsRepository progs.ProgWatcher
-	MapsRepository  maps.MapsWatcher
-	TasksRepository tasks.TaskWatcher
+	ProgsRepository   progs.ProgWatcher
+	MapsRepository    maps.MapsWatcher
+	TasksRepository   tasks.TaskWatcher
+	StatsRepository   stats.StatsController
+	LinksRepository   links.LinkWatcher
+	NetdevsRepository netdevs.InterfaceWatcher
+	CgroupsRepository cgroups.CgroupWatcher
+	PodsRepository    k8s.PodResolver
+	BtfRepository     btfs.BtfWatcher
+
+	// ConfirmationToken is required by mutations that detach or (un)pin objects, they only allow dry-run if it's empty
+	ConfirmationToken string
+
+	// DangerousHelpers are reported in the security summary, progs.DefaultDangerousHelpers are used if nil
+	DangerousHelpers []string
 }
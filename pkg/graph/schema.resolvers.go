@@ -6,15 +6,100 @@ package graph
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/btfs"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/cgroups"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/links"
 	"github.com/ebpfdev/dev-agent/pkg/ebpf/maps"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/pins"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/progs"
 	"github.com/ebpfdev/dev-agent/pkg/graph/generated"
 	"github.com/ebpfdev/dev-agent/pkg/graph/model"
 )
 
+// Programs is the resolver for the programs field.
+func (r *btfResolver) Programs(ctx context.Context, obj *model.Btf) ([]*model.Program, error) {
+	progs, err := r.ProgsRepository.GetProgs()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Program, 0)
+	for _, prog := range progs {
+		if prog.Info == nil {
+			continue
+		}
+		if btfID, ok := prog.Info.BTFID(); ok && int(btfID) == obj.ID {
+			result = append(result, progInfoToModel(&prog))
+		}
+	}
+	return result, nil
+}
+
+// Maps is the resolver for the maps field.
+func (r *btfResolver) Maps(ctx context.Context, obj *model.Btf) ([]*model.Map, error) {
+	emaps, err := r.MapsRepository.GetMaps()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Map, 0)
+	for _, m := range emaps {
+		if m.Error == nil && int(m.BtfID) == obj.ID {
+			result = append(result, mapInfoToModel(m))
+		}
+	}
+	return result, nil
+}
+
+// Types is the resolver for the types field.
+func (r *btfResolver) Types(ctx context.Context, obj *model.Btf, name string, limit *int) ([]*model.BtfType, error) {
+	btfID := uint32(obj.ID)
+	return r.searchBtfTypes(&btfID, name, limit)
+}
+
+// C is the resolver for the c field.
+func (r *btfTypeResolver) C(ctx context.Context, obj *model.BtfType) (string, error) {
+	typ, err := r.BtfRepository.GetType(uint32(obj.BtfID), btf.TypeID(obj.ID))
+	if err != nil {
+		return "", err
+	}
+	return btfs.FormatC(typ.Type), nil
+}
+
+// Pod is the resolver for the pod field.
+func (r *cgroupResolver) Pod(ctx context.Context, obj *model.Cgroup) (*model.Pod, error) {
+	if r.PodsRepository == nil || obj.Path == "" {
+		return nil, nil
+	}
+	return podInfoToModel(r.PodsRepository.ForCgroup(obj.Path)), nil
+}
+
+// Program is the resolver for the program field.
+func (r *linkResolver) Program(ctx context.Context, obj *model.Link) (*model.Program, error) {
+	prog, err := r.ProgsRepository.GetProg(ebpf.ProgramID(obj.ProgramID))
+	if err != nil {
+		return nil, nil
+	}
+	return progInfoToModel(prog), nil
+}
+
+// Holders is the resolver for the holders field.
+func (r *linkResolver) Holders(ctx context.Context, obj *model.Link) ([]*model.Holder, error) {
+	holders, err := r.TasksRepository.GetHolders()
+	if err != nil {
+		return nil, err
+	}
+	return holdersToModel(holders.Links[uint32(obj.ID)]), nil
+}
+
 // Entries is the resolver for the entries field.
 func (r *mapResolver) Entries(ctx context.Context, obj *model.Map, offset *int, limit *int, keyFormat *model.MapEntryFormat, valueFormat *model.MapEntryFormat) ([]*model.MapEntry, error) {
 	mapEntries, err := maps.GetEntries(ebpf.MapID(obj.ID), false)
@@ -87,6 +172,64 @@ func (r *mapResolver) Programs(ctx context.Context, obj *model.Map) ([]*model.Pr
 	return result, nil
 }
 
+// Holders is the resolver for the holders field.
+func (r *mapResolver) Holders(ctx context.Context, obj *model.Map) ([]*model.Holder, error) {
+	holders, err := r.TasksRepository.GetHolders()
+	if err != nil {
+		return nil, err
+	}
+	return holdersToModel(holders.Maps[ebpf.MapID(obj.ID)]), nil
+}
+
+// Btf is the resolver for the btf field.
+func (r *mapResolver) Btf(ctx context.Context, obj *model.Map) (*model.Btf, error) {
+	if obj.BtfID == nil {
+		return nil, nil
+	}
+	return r.Query().Btf(ctx, *obj.BtfID)
+}
+
+// KeyType is the resolver for the keyType field.
+func (r *mapResolver) KeyType(ctx context.Context, obj *model.Map) (*model.BtfType, error) {
+	if obj.BtfID == nil || obj.BtfKeyTypeID == nil {
+		return nil, nil
+	}
+	return r.Query().BtfType(ctx, *obj.BtfID, *obj.BtfKeyTypeID)
+}
+
+// ValueType is the resolver for the valueType field.
+func (r *mapResolver) ValueType(ctx context.Context, obj *model.Map) (*model.BtfType, error) {
+	if obj.BtfVmlinuxValueTypeID != nil {
+		vmlinuxID, err := btfs.VmlinuxID()
+		if err != nil {
+			return nil, err
+		}
+		return r.Query().BtfType(ctx, int(vmlinuxID), *obj.BtfVmlinuxValueTypeID)
+	}
+	if obj.BtfID == nil || obj.BtfValueTypeID == nil {
+		return nil, nil
+	}
+	return r.Query().BtfType(ctx, *obj.BtfID, *obj.BtfValueTypeID)
+}
+
+// Datasec is the resolver for the datasec field.
+func (r *mapResolver) Datasec(ctx context.Context, obj *model.Map) (*model.MapDatasec, error) {
+	datasec, err := maps.GetDatasec(ebpf.MapID(obj.ID))
+	if datasec == nil {
+		return nil, err
+	}
+	return datasecToModel(datasec), nil
+}
+
+// Capacity is the resolver for the capacity field.
+func (r *mapResolver) Capacity(ctx context.Context, obj *model.Map) (*model.MapCapacity, error) {
+	capacity := r.MapsRepository.GetCapacity(ebpf.MapID(obj.ID))
+	if capacity == nil {
+		return nil, nil
+	}
+	return capacityToModel(capacity), nil
+}
+
 // PinMap is the resolver for the pinMap field.
 func (r *mutationResolver) PinMap(ctx context.Context, id int, path string) (*model.MapPinningResult, error) {
 	err := r.MapsRepository.PinMap(ebpf.MapID(id), path)
@@ -100,33 +243,285 @@ func (r *mutationResolver) PinMap(ctx context.Context, id int, path string) (*mo
 // UpdateMapValue is the resolver for the updateMapValue field.
 func (r *mutationResolver) UpdateMapValue(ctx context.Context, mapID int, key string, cpu *int, value string, keyFormat model.MapEntryFormat, valueFormat model.MapEntryFormat) (*model.MapUpdateValueResult, error) {
 	err := r.MapsRepository.UpdateMapValue(ebpf.MapID(mapID), key, cpu, value, toMapsFormat(keyFormat), toMapsFormat(valueFormat))
-	if err != nil {
-		errMsg := err.Error()
-		return &model.MapUpdateValueResult{Error: &errMsg}, nil
-	}
-	return &model.MapUpdateValueResult{}, nil
+	return mapUpdateResult(err), nil
 }
 
 // CreateMapValue is the resolver for the createMapValue field.
 func (r *mutationResolver) CreateMapValue(ctx context.Context, mapID int, key string, values []string, keyFormat model.MapEntryFormat, valueFormat model.MapEntryFormat) (*model.MapUpdateValueResult, error) {
 	err := r.MapsRepository.CreateMapValue(ebpf.MapID(mapID), key, values, toMapsFormat(keyFormat), toMapsFormat(valueFormat))
+	return mapUpdateResult(err), nil
+}
+
+// DeleteMapValues is the resolver for the deleteMapValues field.
+func (r *mutationResolver) DeleteMapValues(ctx context.Context, mapID int, keys []string, keyFormat model.MapEntryFormat, rollback *bool) (*model.MapUpdateValueResult, error) {
+	ops := make([]*maps.Op, len(keys))
+	for i, key := range keys {
+		ops[i] = &maps.Op{Kind: maps.OpDelete, Key: key}
+	}
+	result, err := r.MapsRepository.ApplyMapOps(ebpf.MapID(mapID), ops, &maps.BatchOptions{
+		KeyFormat:   toMapsFormat(keyFormat),
+		StopOnError: true,
+		Rollback:    rollback != nil && *rollback,
+	})
 	if err != nil {
-		errMsg := err.Error()
-		return &model.MapUpdateValueResult{Error: &errMsg}, nil
+		return mapUpdateResult(err), nil
+	}
+	for i, opResult := range result.Results {
+		if opResult.Err != nil {
+			err = fmt.Errorf("key %s: %w", keys[i], opResult.Err)
+			if result.RolledBack {
+				err = fmt.Errorf("%w, deleted keys are restored", err)
+			}
+			if result.RollbackErr != nil {
+				err = fmt.Errorf("%w, rollback failed: %v", err, result.RollbackErr)
+			}
+			return mapUpdateResult(err), nil
+		}
 	}
 	return &model.MapUpdateValueResult{}, nil
 }
 
-// DeleteMapValues is the resolver for the deleteMapValues field.
-func (r *mutationResolver) DeleteMapValues(ctx context.Context, mapID int, keys []string, keyFormat model.MapEntryFormat) (*model.MapUpdateValueResult, error) {
-	for _, key := range keys {
-		err := r.MapsRepository.DeleteMapValue(ebpf.MapID(mapID), key, toMapsFormat(keyFormat))
-		if err != nil {
-			errMsg := err.Error()
-			return &model.MapUpdateValueResult{Error: &errMsg}, nil
+// ApplyMapOps is the resolver for the applyMapOps field.
+func (r *mutationResolver) ApplyMapOps(ctx context.Context, mapID int, ops []*model.MapOpInput, keyFormat model.MapEntryFormat, valueFormat *model.MapEntryFormat, onError *model.MapErrorPolicy, rollback *bool) (*model.MapBatchResult, error) {
+	mapsOps := make([]*maps.Op, len(ops))
+	for i, op := range ops {
+		mapsOps[i] = mapOpFromModel(op)
+	}
+	valueFormatValue := model.MapEntryFormatHex
+	if valueFormat != nil {
+		valueFormatValue = *valueFormat
+	}
+	onErrorValue := model.MapErrorPolicyStopOnError
+	if onError != nil {
+		onErrorValue = *onError
+	}
+	result, err := r.MapsRepository.ApplyMapOps(ebpf.MapID(mapID), mapsOps, &maps.BatchOptions{
+		KeyFormat:   toMapsFormat(keyFormat),
+		ValueFormat: toMapsFormat(valueFormatValue),
+		StopOnError: onErrorValue == model.MapErrorPolicyStopOnError,
+		Rollback:    rollback != nil && *rollback,
+	})
+	if err != nil {
+		return &model.MapBatchResult{
+			Error:     errorToModel(err),
+			ErrorCode: mapErrorCode(err),
+			Results:   []*model.MapOpResult{},
+		}, nil
+	}
+	return mapBatchResultToModel(ops, result), nil
+}
+
+// CompareAndSetMapValue is the resolver for the compareAndSetMapValue field.
+func (r *mutationResolver) CompareAndSetMapValue(ctx context.Context, mapID int, key string, expected string, value string, cpu *int, field *string, keyFormat model.MapEntryFormat, valueFormat model.MapEntryFormat, retries *int) (*model.MapValueChangeResult, error) {
+	change, err := r.MapsRepository.CompareAndSetMapValue(ebpf.MapID(mapID), key, expected, value, valueTarget(cpu, field, retries), toMapsFormat(keyFormat), toMapsFormat(valueFormat))
+	return valueChangeToModel(change, err, toMapsFormat(valueFormat)), nil
+}
+
+// IncrementMapValue is the resolver for the incrementMapValue field.
+func (r *mutationResolver) IncrementMapValue(ctx context.Context, mapID int, key string, delta int, cpu *int, field *string, keyFormat model.MapEntryFormat, valueFormat *model.MapEntryFormat, retries *int) (*model.MapValueChangeResult, error) {
+	valueFormatValue := model.MapEntryFormatNumber
+	if valueFormat != nil {
+		valueFormatValue = *valueFormat
+	}
+	change, err := r.MapsRepository.IncrementMapValue(ebpf.MapID(mapID), key, int64(delta), valueTarget(cpu, field, retries), toMapsFormat(keyFormat))
+	return valueChangeToModel(change, err, toMapsFormat(valueFormatValue)), nil
+}
+
+// UndoMapMutation is the resolver for the undoMapMutation field.
+func (r *mutationResolver) UndoMapMutation(ctx context.Context, id int, force *bool, keyFormat *model.MapEntryFormat, valueFormat *model.MapEntryFormat) (*model.MapUndoResult, error) {
+	undo, err := r.MapsRepository.UndoMutation(uint64(id), force != nil && *force)
+	result := &model.MapUndoResult{
+		Error:     errorToModel(err),
+		ErrorCode: mapErrorCode(err),
+	}
+	if undo != nil {
+		keyFormatValue := model.MapEntryFormatHex
+		if keyFormat != nil {
+			keyFormatValue = *keyFormat
+		}
+		valueFormatValue := model.MapEntryFormatHex
+		if valueFormat != nil {
+			valueFormatValue = *valueFormat
 		}
+		result.Mutation = mutationToModel(undo, toMapsFormat(keyFormatValue), toMapsFormat(valueFormatValue))
 	}
-	return &model.MapUpdateValueResult{}, nil
+	return result, nil
+}
+
+// SetMapVariable is the resolver for the setMapVariable field.
+func (r *mutationResolver) SetMapVariable(ctx context.Context, mapID int, name string, value string) (*model.MapUpdateValueResult, error) {
+	err := r.MapsRepository.SetVariable(ebpf.MapID(mapID), name, value)
+	return mapUpdateResult(err), nil
+}
+
+// EnableBpfStats is the resolver for the enableBpfStats field.
+func (r *mutationResolver) EnableBpfStats(ctx context.Context, duration *int) (*model.BpfStats, error) {
+	var window time.Duration
+	if duration != nil {
+		window = time.Duration(*duration) * time.Second
+	}
+	err := r.StatsRepository.Enable(window)
+	return r.statsStateToModel(err), nil
+}
+
+// DisableBpfStats is the resolver for the disableBpfStats field.
+func (r *mutationResolver) DisableBpfStats(ctx context.Context) (*model.BpfStats, error) {
+	err := r.StatsRepository.Disable()
+	return r.statsStateToModel(err), nil
+}
+
+// DetachLink is the resolver for the detachLink field.
+func (r *mutationResolver) DetachLink(ctx context.Context, id int, confirm *string, dryRun *bool) (*model.LinkMutationResult, error) {
+	dry := dryRun != nil && *dryRun
+	if err := r.checkConfirmation(confirm, dry); err != nil {
+		return r.linkMutationResult(id, dry, err), nil
+	}
+	if _, err := r.LinksRepository.GetLink(links.LinkID(id)); err != nil {
+		return r.linkMutationResult(id, dry, err), nil
+	}
+	if dry {
+		return r.linkMutationResult(id, dry, nil), nil
+	}
+	err := r.LinksRepository.DetachLink(links.LinkID(id))
+	return r.linkMutationResult(id, dry, err), nil
+}
+
+// PinLink is the resolver for the pinLink field.
+func (r *mutationResolver) PinLink(ctx context.Context, id int, path string, confirm *string, dryRun *bool) (*model.LinkMutationResult, error) {
+	dry := dryRun != nil && *dryRun
+	if err := r.checkConfirmation(confirm, dry); err != nil {
+		return r.linkMutationResult(id, dry, err), nil
+	}
+	if _, err := r.LinksRepository.GetLink(links.LinkID(id)); err != nil {
+		return r.linkMutationResult(id, dry, err), nil
+	}
+	if err := pins.CheckPinPath(path); err != nil {
+		return r.linkMutationResult(id, dry, err), nil
+	}
+	if dry {
+		return r.linkMutationResult(id, dry, nil), nil
+	}
+	err := r.LinksRepository.PinLink(links.LinkID(id), path)
+	return r.linkMutationResult(id, dry, err), nil
+}
+
+// CreateMap is the resolver for the createMap field.
+func (r *mutationResolver) CreateMap(ctx context.Context, spec model.MapSpecInput, path string, confirm *string, dryRun *bool) (*model.MapMutationResult, error) {
+	dry := dryRun != nil && *dryRun
+	if err := r.checkConfirmation(confirm, dry); err != nil {
+		return r.mapMutationResult(0, dry, err), nil
+	}
+	createSpec, err := mapSpecFromModel(&spec)
+	if err != nil {
+		return r.mapMutationResult(0, dry, err), nil
+	}
+	if dry {
+		_, err := r.MapsRepository.ValidateCreateSpec(createSpec, path)
+		return r.mapMutationResult(0, dry, err), nil
+	}
+	id, err := r.MapsRepository.CreateMap(createSpec, path)
+	return r.mapMutationResult(int(id), dry, err), nil
+}
+
+// ClearMap is the resolver for the clearMap field.
+func (r *mutationResolver) ClearMap(ctx context.Context, id int, confirm *string, dryRun *bool) (*model.MapClearResult, error) {
+	dry := dryRun != nil && *dryRun
+	if err := r.checkConfirmation(confirm, dry); err != nil {
+		return r.mapClearResult(id, dry, 0, err), nil
+	}
+	affected, err := r.MapsRepository.ClearMap(ebpf.MapID(id), dry)
+	return r.mapClearResult(id, dry, affected, err), nil
+}
+
+// ResetCounters is the resolver for the resetCounters field.
+func (r *mutationResolver) ResetCounters(ctx context.Context, id int, fields []string, confirm *string, dryRun *bool) (*model.MapClearResult, error) {
+	dry := dryRun != nil && *dryRun
+	if err := r.checkConfirmation(confirm, dry); err != nil {
+		return r.mapClearResult(id, dry, 0, err), nil
+	}
+	affected, err := r.MapsRepository.ResetCounters(ebpf.MapID(id), fields, dry)
+	return r.mapClearResult(id, dry, affected, err), nil
+}
+
+// FreezeMap is the resolver for the freezeMap field.
+func (r *mutationResolver) FreezeMap(ctx context.Context, id int, confirm *string, dryRun *bool) (*model.MapMutationResult, error) {
+	dry := dryRun != nil && *dryRun
+	if err := r.checkConfirmation(confirm, dry); err != nil {
+		return r.mapMutationResult(id, dry, err), nil
+	}
+	emap, err := r.MapsRepository.GetMap(ebpf.MapID(id))
+	if err != nil {
+		return r.mapMutationResult(id, dry, err), nil
+	}
+	if dry {
+		if emap.Frozen {
+			return r.mapMutationResult(id, dry, maps.ErrFrozen), nil
+		}
+		return r.mapMutationResult(id, dry, nil), nil
+	}
+	err = r.MapsRepository.FreezeMap(ebpf.MapID(id))
+	return r.mapMutationResult(id, dry, err), nil
+}
+
+// PinProgram is the resolver for the pinProgram field.
+func (r *mutationResolver) PinProgram(ctx context.Context, id int, path string, confirm *string, dryRun *bool) (*model.ProgramMutationResult, error) {
+	dry := dryRun != nil && *dryRun
+	if err := r.checkConfirmation(confirm, dry); err != nil {
+		return r.programMutationResult(id, dry, err), nil
+	}
+	if _, err := r.ProgsRepository.GetProg(ebpf.ProgramID(id)); err != nil {
+		return r.programMutationResult(id, dry, err), nil
+	}
+	if err := pins.CheckPinPath(path); err != nil {
+		return r.programMutationResult(id, dry, err), nil
+	}
+	if dry {
+		return r.programMutationResult(id, dry, nil), nil
+	}
+	err := r.ProgsRepository.PinProg(ebpf.ProgramID(id), path)
+	return r.programMutationResult(id, dry, err), nil
+}
+
+// UnpinObject is the resolver for the unpinObject field.
+func (r *mutationResolver) UnpinObject(ctx context.Context, path string, confirm *string, dryRun *bool) (*model.UnpinResult, error) {
+	dry := dryRun != nil && *dryRun
+	result := &model.UnpinResult{
+		DryRun: dry,
+		Path:   path,
+	}
+	if err := r.checkConfirmation(confirm, dry); err != nil {
+		result.Error = errorToModel(err)
+		return result, nil
+	}
+	obj, err := pins.Inspect(path)
+	if err != nil {
+		result.Error = errorToModel(err)
+		return result, nil
+	}
+	objectType := string(obj.Type)
+	objectID := int(obj.ID)
+	result.ObjectType = &objectType
+	result.ObjectID = &objectID
+	if !dry {
+		if err := pins.Unpin(path); err != nil {
+			result.Error = errorToModel(err)
+		}
+	}
+	r.fillUnpinnedObject(result, obj)
+	return result, nil
+}
+
+// Pod is the resolver for the pod field.
+func (r *processResolver) Pod(ctx context.Context, obj *model.Process) (*model.Pod, error) {
+	if r.PodsRepository == nil || obj.CgroupPath == "" {
+		return nil, nil
+	}
+	return podInfoToModel(r.PodsRepository.ForCgroup(obj.CgroupPath)), nil
+}
+
+// RunStatsEnabled is the resolver for the runStatsEnabled field.
+func (r *programResolver) RunStatsEnabled(ctx context.Context, obj *model.Program) (bool, error) {
+	return r.StatsRepository.IsEnabled(), nil
 }
 
 // Maps is the resolver for the maps field.
@@ -170,6 +565,224 @@ func (r *programResolver) Tasks(ctx context.Context, obj *model.Program) ([]*mod
 	return result, nil
 }
 
+// Instructions is the resolver for the instructions field.
+func (r *programResolver) Instructions(ctx context.Context, obj *model.Program) ([]*model.Instruction, error) {
+	insns, err := r.programInstructions(obj)
+	if err != nil {
+		return nil, err
+	}
+	// source lines are optional, so instructions are returned even if BTF is not available
+	lines := make(map[int]*model.SourceLine)
+	if source, err := progs.GetSourceInfo(ebpf.ProgramID(obj.ID)); err == nil {
+		for _, line := range source.Lines {
+			if _, ok := lines[line.Offset]; !ok {
+				lines[line.Offset] = sourceLineToModel(line)
+			}
+		}
+	}
+	result := make([]*model.Instruction, len(insns))
+	for i, ins := range insns {
+		result[i] = instructionToModel(ins)
+		result[i].Source = lines[ins.Offset]
+	}
+	return result, nil
+}
+
+// Disassembly is the resolver for the disassembly field.
+func (r *programResolver) Disassembly(ctx context.Context, obj *model.Program) (*string, error) {
+	insns, err := r.programInstructions(obj)
+	if err != nil {
+		return nil, err
+	}
+	source, _ := progs.GetSourceInfo(ebpf.ProgramID(obj.ID))
+	disassembly := progs.Disassemble(insns, source)
+	return &disassembly, nil
+}
+
+// Functions is the resolver for the functions field.
+func (r *programResolver) Functions(ctx context.Context, obj *model.Program) ([]*model.ProgramFunction, error) {
+	source, err := progs.GetSourceInfo(ebpf.ProgramID(obj.ID))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.ProgramFunction, len(source.Functions))
+	for i, fn := range source.Functions {
+		result[i] = &model.ProgramFunction{
+			Offset:           fn.Offset,
+			Name:             fn.Name,
+			Prototype:        fn.Prototype,
+			InstructionCount: fn.InstructionCount,
+		}
+	}
+	return result, nil
+}
+
+// SourceLines is the resolver for the sourceLines field.
+func (r *programResolver) SourceLines(ctx context.Context, obj *model.Program) ([]*model.SourceLine, error) {
+	source, err := progs.GetSourceInfo(ebpf.ProgramID(obj.ID))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.SourceLine, len(source.Lines))
+	for i, line := range source.Lines {
+		result[i] = sourceLineToModel(line)
+	}
+	return result, nil
+}
+
+// JitedFunctions is the resolver for the jitedFunctions field.
+func (r *programResolver) JitedFunctions(ctx context.Context, obj *model.Program) ([]*model.JitedFunction, error) {
+	jited, err := progs.GetJitedImage(ebpf.ProgramID(obj.ID), false)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.JitedFunction, len(jited.Functions))
+	for i, fn := range jited.Functions {
+		result[i] = &model.JitedFunction{
+			Address: "0x" + strconv.FormatUint(fn.Address, 16),
+			Size:    int(fn.Size),
+		}
+		if fn.Symbol != "" {
+			result[i].Symbol = &jited.Functions[i].Symbol
+		}
+	}
+	return result, nil
+}
+
+// JitedImage is the resolver for the jitedImage field.
+func (r *programResolver) JitedImage(ctx context.Context, obj *model.Program) (*string, error) {
+	jited, err := progs.GetJitedImage(ebpf.ProgramID(obj.ID), true)
+	if err != nil {
+		return nil, err
+	}
+	if len(jited.Image) == 0 {
+		return nil, nil
+	}
+	image := base64.StdEncoding.EncodeToString(jited.Image)
+	return &image, nil
+}
+
+// JitedDisassembly is the resolver for the jitedDisassembly field.
+func (r *programResolver) JitedDisassembly(ctx context.Context, obj *model.Program) (*string, error) {
+	jited, err := progs.GetJitedImage(ebpf.ProgramID(obj.ID), true)
+	if err != nil {
+		return nil, err
+	}
+	if len(jited.Image) == 0 {
+		return nil, nil
+	}
+	disassembly, err := progs.DisassembleJited(jited)
+	if err != nil {
+		return nil, err
+	}
+	return &disassembly, nil
+}
+
+// Helpers is the resolver for the helpers field.
+func (r *programResolver) Helpers(ctx context.Context, obj *model.Program) ([]*model.FunctionUsage, error) {
+	analysis, err := r.programCallsAnalysis(obj)
+	if err != nil {
+		return nil, err
+	}
+	return functionUsagesToModel(analysis.Helpers), nil
+}
+
+// Kfuncs is the resolver for the kfuncs field.
+func (r *programResolver) Kfuncs(ctx context.Context, obj *model.Program) ([]*model.FunctionUsage, error) {
+	analysis, err := r.programCallsAnalysis(obj)
+	if err != nil {
+		return nil, err
+	}
+	return functionUsagesToModel(analysis.Kfuncs), nil
+}
+
+// UnresolvedCalls is the resolver for the unresolvedCalls field.
+func (r *programResolver) UnresolvedCalls(ctx context.Context, obj *model.Program) (int, error) {
+	analysis, err := r.programCallsAnalysis(obj)
+	if err != nil {
+		return 0, err
+	}
+	return analysis.Unresolved, nil
+}
+
+// Links is the resolver for the links field.
+func (r *programResolver) Links(ctx context.Context, obj *model.Program) ([]*model.Link, error) {
+	linksList, err := r.LinksRepository.GetLinks()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Link, 0)
+	for _, link := range linksList {
+		if link.Error == nil && link.ProgramID == ebpf.ProgramID(obj.ID) {
+			result = append(result, linkInfoToModel(link))
+		}
+	}
+	return result, nil
+}
+
+// Interfaces is the resolver for the interfaces field.
+func (r *programResolver) Interfaces(ctx context.Context, obj *model.Program) ([]*model.NetworkInterface, error) {
+	interfaces, err := r.NetdevsRepository.GetInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.NetworkInterface, 0)
+	for _, iface := range interfaces {
+		for _, id := range iface.ProgramIDs() {
+			if id == ebpf.ProgramID(obj.ID) {
+				result = append(result, r.interfaceInfoToModel(iface))
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// Cgroups is the resolver for the cgroups field.
+func (r *programResolver) Cgroups(ctx context.Context, obj *model.Program, effective *bool) ([]*model.Cgroup, error) {
+	cgroupsList, err := r.CgroupsRepository.GetCgroups()
+	if err != nil {
+		return nil, err
+	}
+	withInherited := effective != nil && *effective
+	result := make([]*model.Cgroup, 0)
+	for _, cgroup := range cgroupsList {
+		modelCgroup := r.cgroupInfoToModel(cgroup, func(attachment *cgroups.Attachment) bool {
+			return attachment.ProgramID == ebpf.ProgramID(obj.ID) && (attachment.Direct || withInherited)
+		})
+		if len(modelCgroup.Attachments) > 0 {
+			result = append(result, modelCgroup)
+		}
+	}
+	return result, nil
+}
+
+// Holders is the resolver for the holders field.
+func (r *programResolver) Holders(ctx context.Context, obj *model.Program) ([]*model.Holder, error) {
+	holders, err := r.TasksRepository.GetHolders()
+	if err != nil {
+		return nil, err
+	}
+	return holdersToModel(holders.Programs[ebpf.ProgramID(obj.ID)]), nil
+}
+
+// AttachTarget is the resolver for the attachTarget field.
+func (r *programResolver) AttachTarget(ctx context.Context, obj *model.Program) (*model.AttachTarget, error) {
+	target, err := progs.GetAttachTarget(ebpf.ProgramID(obj.ID))
+	if target == nil {
+		return nil, err
+	}
+	return attachTargetToModel(target, err), nil
+}
+
+// Btf is the resolver for the btf field.
+func (r *programResolver) Btf(ctx context.Context, obj *model.Program) (*model.Btf, error) {
+	if obj.BtfID == nil || *obj.BtfID == 0 {
+		return nil, nil
+	}
+	return r.Query().Btf(ctx, *obj.BtfID)
+}
+
 // Program is the resolver for the program field.
 func (r *queryResolver) Program(ctx context.Context, id int) (*model.Program, error) {
 	prog, err := r.ProgsRepository.GetProg(ebpf.ProgramID(id))
@@ -223,19 +836,370 @@ func (r *queryResolver) ConnectedGraph(ctx context.Context, from int, fromType m
 	return buildConnectedGraph(progsMap, mapsMap), nil
 }
 
+// BpfStats is the resolver for the bpfStats field.
+func (r *queryResolver) BpfStats(ctx context.Context) (*model.BpfStats, error) {
+	return r.statsStateToModel(nil), nil
+}
+
+// ProgramsUsingHelper is the resolver for the programsUsingHelper field.
+func (r *queryResolver) ProgramsUsingHelper(ctx context.Context, name string) ([]*model.Program, error) {
+	progsList, err := r.ProgsRepository.GetProgs()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Program, 0)
+	unknown := 0
+	for i, prog := range progsList {
+		if prog.Info == nil {
+			continue
+		}
+		analysis, err := progs.AnalyzeCalls(prog.Info)
+		if err != nil || analysis.Unresolved > 0 {
+			unknown++
+		}
+		if err != nil {
+			continue
+		}
+		if _, ok := analysis.Uses(name); ok {
+			result = append(result, progInfoToModel(&progsList[i]))
+		}
+	}
+	// the list is still returned, but it may miss programs which calls couldn't be resolved
+	if unknown > 0 {
+		graphql.AddErrorf(ctx, "calls of %d programs couldn't be resolved, they may use %s too", unknown, name)
+	}
+	return result, nil
+}
+
+// SecuritySummary is the resolver for the securitySummary field.
+func (r *queryResolver) SecuritySummary(ctx context.Context) (*model.SecuritySummary, error) {
+	dangerousHelpers := r.DangerousHelpers
+	if dangerousHelpers == nil {
+		dangerousHelpers = progs.DefaultDangerousHelpers
+	}
+	progsList, err := r.ProgsRepository.GetProgs()
+	if err != nil {
+		return nil, err
+	}
+	result := &model.SecuritySummary{
+		DangerousHelpers: dangerousHelpers,
+		Programs:         make([]*model.ProgramSecurityFinding, 0),
+		Complete:         true,
+	}
+	for i, prog := range progsList {
+		if prog.Info == nil {
+			continue
+		}
+		analysis, err := progs.AnalyzeCalls(prog.Info)
+		if err != nil {
+			result.Complete = false
+			result.Programs = append(result.Programs, &model.ProgramSecurityFinding{
+				Program: progInfoToModel(&progsList[i]),
+				Helpers: []*model.FunctionUsage{},
+				Error:   errorToModel(err),
+			})
+			continue
+		}
+		if analysis.Unresolved > 0 {
+			result.Complete = false
+		}
+		if dangerous := analysis.Dangerous(dangerousHelpers); len(dangerous) > 0 || analysis.Unresolved > 0 {
+			result.Programs = append(result.Programs, &model.ProgramSecurityFinding{
+				Program:         progInfoToModel(&progsList[i]),
+				Helpers:         functionUsagesToModel(dangerous),
+				UnresolvedCalls: analysis.Unresolved,
+			})
+		}
+	}
+	return result, nil
+}
+
+// MemlockSummary is the resolver for the memlockSummary field.
+func (r *queryResolver) MemlockSummary(ctx context.Context, limit *int) (*model.MemlockSummary, error) {
+	progsList, err := r.ProgsRepository.GetProgs()
+	if err != nil {
+		return nil, err
+	}
+	mapsList, err := r.MapsRepository.GetMaps()
+	if err != nil {
+		return nil, err
+	}
+	result := &model.MemlockSummary{
+		ByType:  make([]*model.MemlockTypeTotal, 0),
+		Largest: make([]*model.MemlockObject, 0),
+	}
+	totals := map[model.IDType]map[string]*model.MemlockTypeTotal{
+		model.IDTypeProgram: {},
+		model.IDTypeMap:     {},
+	}
+	addTotal := func(objectType model.IDType, typeName string, bytes int) {
+		total, ok := totals[objectType][typeName]
+		if !ok {
+			total = &model.MemlockTypeTotal{ObjectType: objectType, Type: typeName}
+			totals[objectType][typeName] = total
+			result.ByType = append(result.ByType, total)
+		}
+		total.Count++
+		total.Bytes += bytes
+	}
+	for i, prog := range progsList {
+		if prog.Error != nil {
+			continue
+		}
+		bytes := int(prog.MemlockBytes)
+		result.ProgramsBytes += bytes
+		addTotal(model.IDTypeProgram, prog.Type.String(), bytes)
+		result.Largest = append(result.Largest, &model.MemlockObject{
+			ObjectType: model.IDTypeProgram,
+			ID:         int(prog.ID),
+			Bytes:      bytes,
+			Program:    progInfoToModel(&progsList[i]),
+		})
+	}
+	for _, emap := range mapsList {
+		if emap.Error != nil {
+			continue
+		}
+		bytes := int(emap.MemlockBytes)
+		result.MapsBytes += bytes
+		addTotal(model.IDTypeMap, emap.Type.String(), bytes)
+		result.Largest = append(result.Largest, &model.MemlockObject{
+			ObjectType: model.IDTypeMap,
+			ID:         int(emap.ID),
+			Bytes:      bytes,
+			Map:        mapInfoToModel(emap),
+		})
+	}
+	result.TotalBytes = result.ProgramsBytes + result.MapsBytes
+
+	sort.SliceStable(result.ByType, func(i, j int) bool {
+		return result.ByType[i].Bytes > result.ByType[j].Bytes
+	})
+	sort.SliceStable(result.Largest, func(i, j int) bool {
+		return result.Largest[i].Bytes > result.Largest[j].Bytes
+	})
+	maxObjects := 10
+	if limit != nil {
+		maxObjects = *limit
+	}
+	if maxObjects < 0 {
+		return nil, fmt.Errorf("limit must not be negative")
+	}
+	if len(result.Largest) > maxObjects {
+		result.Largest = result.Largest[:maxObjects]
+	}
+	return result, nil
+}
+
+// MapMutationHistory is the resolver for the mapMutationHistory field.
+func (r *queryResolver) MapMutationHistory(ctx context.Context, mapID int, limit *int, keyFormat *model.MapEntryFormat, valueFormat *model.MapEntryFormat) ([]*model.MapMutation, error) {
+	limitValue := 100
+	if limit != nil {
+		limitValue = *limit
+	}
+	keyFormatValue := model.MapEntryFormatHex
+	if keyFormat != nil {
+		keyFormatValue = *keyFormat
+	}
+	valueFormatValue := model.MapEntryFormatHex
+	if valueFormat != nil {
+		valueFormatValue = *valueFormat
+	}
+	result := []*model.MapMutation{}
+	for _, mutation := range r.MapsRepository.GetMutationHistory(ebpf.MapID(mapID), limitValue) {
+		result = append(result, mutationToModel(mutation, toMapsFormat(keyFormatValue), toMapsFormat(valueFormatValue)))
+	}
+	return result, nil
+}
+
+// Link is the resolver for the link field.
+func (r *queryResolver) Link(ctx context.Context, id int) (*model.Link, error) {
+	link, err := r.LinksRepository.GetLink(links.LinkID(id))
+	if err != nil {
+		return nil, err
+	}
+	return linkInfoToModel(link), nil
+}
+
+// Links is the resolver for the links field.
+func (r *queryResolver) Links(ctx context.Context) ([]*model.Link, error) {
+	linksList, err := r.LinksRepository.GetLinks()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Link, len(linksList))
+	for i, link := range linksList {
+		result[i] = linkInfoToModel(link)
+	}
+	return result, nil
+}
+
+// Interfaces is the resolver for the interfaces field.
+func (r *queryResolver) Interfaces(ctx context.Context) ([]*model.NetworkInterface, error) {
+	interfaces, err := r.NetdevsRepository.GetInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.NetworkInterface, len(interfaces))
+	for i, iface := range interfaces {
+		result[i] = r.interfaceInfoToModel(iface)
+	}
+	return result, nil
+}
+
+// Cgroups is the resolver for the cgroups field.
+func (r *queryResolver) Cgroups(ctx context.Context, pathPrefix *string, direct *bool) ([]*model.Cgroup, error) {
+	cgroupsList, err := r.CgroupsRepository.GetCgroups()
+	if err != nil {
+		return nil, err
+	}
+	directOnly := direct != nil && *direct
+	result := make([]*model.Cgroup, 0)
+	for _, cgroup := range cgroupsList {
+		if pathPrefix != nil && !strings.HasPrefix(cgroup.Path, *pathPrefix) {
+			continue
+		}
+		modelCgroup := r.cgroupInfoToModel(cgroup, func(attachment *cgroups.Attachment) bool {
+			return attachment.Direct || !directOnly
+		})
+		if directOnly && len(modelCgroup.Attachments) == 0 {
+			continue
+		}
+		result = append(result, modelCgroup)
+	}
+	return result, nil
+}
+
+// Btfs is the resolver for the btfs field.
+func (r *queryResolver) Btfs(ctx context.Context) ([]*model.Btf, error) {
+	infos, err := r.BtfRepository.GetBtfs()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.Btf, len(infos))
+	for i, info := range infos {
+		result[i] = btfInfoToModel(info)
+	}
+	return result, nil
+}
+
+// Btf is the resolver for the btf field.
+func (r *queryResolver) Btf(ctx context.Context, id int) (*model.Btf, error) {
+	info, err := r.BtfRepository.GetBtf(uint32(id))
+	if err != nil {
+		return nil, err
+	}
+	return btfInfoToModel(info), nil
+}
+
+// BtfTypes is the resolver for the btfTypes field.
+func (r *queryResolver) BtfTypes(ctx context.Context, name string, btfID *int, limit *int) ([]*model.BtfType, error) {
+	if btfID == nil {
+		return r.searchBtfTypes(nil, name, limit)
+	}
+	id := uint32(*btfID)
+	return r.searchBtfTypes(&id, name, limit)
+}
+
+// BtfType is the resolver for the btfType field.
+func (r *queryResolver) BtfType(ctx context.Context, btfID int, id int) (*model.BtfType, error) {
+	typ, err := r.BtfRepository.GetType(uint32(btfID), btf.TypeID(id))
+	if err != nil {
+		return nil, err
+	}
+	return btfTypeToModel(typ), nil
+}
+
+// MapChanges is the resolver for the mapChanges field.
+func (r *subscriptionResolver) MapChanges(ctx context.Context, mapID int, interval *int, filter *model.MapChangesFilter, keyFormat *model.MapEntryFormat, valueFormat *model.MapEntryFormat) (<-chan *model.MapChangeSet, error) {
+	info, err := r.MapsRepository.GetMap(ebpf.MapID(mapID))
+	if err != nil {
+		return nil, err
+	}
+	intervalValue := 1000
+	if interval != nil {
+		intervalValue = *interval
+	}
+	keyFormatValue := model.MapEntryFormatHex
+	if keyFormat != nil {
+		keyFormatValue = *keyFormat
+	}
+	valueFormatValue := model.MapEntryFormatHex
+	if valueFormat != nil {
+		valueFormatValue = *valueFormat
+	}
+	filterSpec, err := changesFilterFromModel(filter, info.KeySize, toMapsFormat(keyFormatValue))
+	if err != nil {
+		return nil, err
+	}
+	changes, err := r.MapsRepository.WatchChanges(ctx, ebpf.MapID(mapID), time.Duration(intervalValue)*time.Millisecond, filterSpec)
+	if err != nil {
+		return nil, err
+	}
+	result := make(chan *model.MapChangeSet)
+	go func() {
+		defer close(result)
+		for set := range changes {
+			select {
+			case result <- changeSetToModel(set, toMapsFormat(keyFormatValue), toMapsFormat(valueFormatValue)):
+			case <-ctx.Done():
+				// changes is closed soon after, it's drained meanwhile
+			}
+		}
+	}()
+	return result, nil
+}
+
+// Program is the resolver for the program field.
+func (r *taskResolver) Program(ctx context.Context, obj *model.Task) (*model.Program, error) {
+	prog, err := r.ProgsRepository.GetProg(ebpf.ProgramID(obj.ProgramID))
+	if err != nil {
+		return nil, nil
+	}
+	return progInfoToModel(prog), nil
+}
+
+// Btf returns generated.BtfResolver implementation.
+func (r *Resolver) Btf() generated.BtfResolver { return &btfResolver{r} }
+
+// BtfType returns generated.BtfTypeResolver implementation.
+func (r *Resolver) BtfType() generated.BtfTypeResolver { return &btfTypeResolver{r} }
+
+// Cgroup returns generated.CgroupResolver implementation.
+func (r *Resolver) Cgroup() generated.CgroupResolver { return &cgroupResolver{r} }
+
+// Link returns generated.LinkResolver implementation.
+func (r *Resolver) Link() generated.LinkResolver { return &linkResolver{r} }
+
 // Map returns generated.MapResolver implementation.
 func (r *Resolver) Map() generated.MapResolver { return &mapResolver{r} }
 
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
+// Process returns generated.ProcessResolver implementation.
+func (r *Resolver) Process() generated.ProcessResolver { return &processResolver{r} }
+
 // Program returns generated.ProgramResolver implementation.
 func (r *Resolver) Program() generated.ProgramResolver { return &programResolver{r} }
 
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// Subscription returns generated.SubscriptionResolver implementation.
+func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
+
+// Task returns generated.TaskResolver implementation.
+func (r *Resolver) Task() generated.TaskResolver { return &taskResolver{r} }
+
+type btfResolver struct{ *Resolver }
+type btfTypeResolver struct{ *Resolver }
+type cgroupResolver struct{ *Resolver }
+type linkResolver struct{ *Resolver }
 type mapResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
+type processResolver struct{ *Resolver }
 type programResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
+type taskResolver struct{ *Resolver }
@@ -0,0 +1,150 @@
+package k8s
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// PodInfo identifies a pod and optionally a container of the pod
+type PodInfo struct {
+	UID       string
+	Namespace string
+	Name      string
+	// Container is a container name, empty if only the pod is known (e.g. for pod-level cgroups)
+	Container string
+}
+
+// podUIDPattern matches pod cgroups of both cgroupfs (pod<uid>) and systemd (kubepods-...-pod<uid with underscores>.slice) drivers
+var podUIDPattern = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+
+// PodUIDFromCgroup finds a pod UID in a cgroup path, it's empty for cgroups outside of kubepods
+func PodUIDFromCgroup(path string) string {
+	if !strings.Contains(path, "kubepods") {
+		return ""
+	}
+	match := podUIDPattern.FindStringSubmatch(path)
+	if match == nil {
+		return ""
+	}
+	return strings.ReplaceAll(match[1], "_", "-")
+}
+
+// index maps pod UIDs and container IDs to pods, it's built from files of kubelet and container runtimes
+type index struct {
+	pods       map[string]*PodInfo
+	containers map[string]*PodInfo
+}
+
+func newIndex() *index {
+	return &index{
+		pods:       make(map[string]*PodInfo),
+		containers: make(map[string]*PodInfo),
+	}
+}
+
+// scanPodLogs reads kubelet pod log directories: /var/log/pods/<namespace>_<name>_<uid>/<container>
+func (idx *index) scanPodLogs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		// namespaces, pod names and UIDs can't contain underscores
+		parts := strings.Split(entry.Name(), "_")
+		if len(parts) != 3 {
+			continue
+		}
+		idx.pods[parts[2]] = &PodInfo{
+			UID:       parts[2],
+			Namespace: parts[0],
+			Name:      parts[1],
+		}
+	}
+}
+
+// scanContainerLogs reads kubelet container log symlinks: /var/log/containers/<name>_<namespace>_<container>-<id>.log,
+// they point to /var/log/pods/<namespace>_<name>_<uid>/<container>/<restart>.log
+func (idx *index) scanContainerLogs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".log")
+		dash := strings.LastIndexByte(name, '-')
+		if dash < 0 {
+			continue
+		}
+		containerID := name[dash+1:]
+		parts := strings.Split(name[:dash], "_")
+		if len(parts) != 3 {
+			continue
+		}
+		pod := &PodInfo{
+			Namespace: parts[1],
+			Name:      parts[0],
+			Container: parts[2],
+		}
+		if target, err := os.Readlink(filepath.Join(dir, entry.Name())); err == nil {
+			podDir := filepath.Base(filepath.Dir(filepath.Dir(target)))
+			if podParts := strings.Split(podDir, "_"); len(podParts) == 3 {
+				pod.UID = podParts[2]
+			}
+		}
+		idx.containers[containerID] = pod
+	}
+}
+
+// ociSpec is a part of config.json of an OCI bundle
+type ociSpec struct {
+	Annotations map[string]string `json:"annotations"`
+}
+
+// annotation keys of pod metadata set by containerd and cri-o respectively
+var annotationKeys = []struct {
+	uid, namespace, name, container string
+}{
+	{"io.kubernetes.cri.sandbox-uid", "io.kubernetes.cri.sandbox-namespace", "io.kubernetes.cri.sandbox-name", "io.kubernetes.cri.container-name"},
+	{"io.kubernetes.pod.uid", "io.kubernetes.pod.namespace", "io.kubernetes.pod.name", "io.kubernetes.container.name"},
+}
+
+// scanBundles reads annotations of OCI bundles of running containers, the pattern is a glob of config.json files
+// with the container ID as the name of the directory matched by the first wildcard
+func (idx *index) scanBundles(pattern string) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+	prefix := pattern[:strings.IndexByte(pattern, '*')]
+	for _, path := range paths {
+		containerID, _, _ := strings.Cut(strings.TrimPrefix(path, prefix), "/")
+		if _, ok := idx.containers[containerID]; ok {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var spec ociSpec
+		if err := json.Unmarshal(content, &spec); err != nil {
+			continue
+		}
+		for _, keys := range annotationKeys {
+			uid, ok := spec.Annotations[keys.uid]
+			if !ok {
+				continue
+			}
+			idx.containers[containerID] = &PodInfo{
+				UID:       uid,
+				Namespace: spec.Annotations[keys.namespace],
+				Name:      spec.Annotations[keys.name],
+				// it's empty for sandboxes (pause containers)
+				Container: spec.Annotations[keys.container],
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package k8s
+
+import (
+	"github.com/rs/zerolog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testPodUID      = "0f4c2b8e-6a1d-4c3e-9b7a-2d5e8f1a3c6b"
+	testContainerID = "3b1f0a9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a"
+	testBundleID    = "9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b7a6f5e4d3c2b1a0f9e8d"
+	testCrioID      = "a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b2"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixtureRoot lays out kubelet logs of a pod with a container, a containerd bundle of its sandbox
+// and a cri-o bundle of another pod, relative to a temporary root
+func fixtureRoot(t *testing.T) string {
+	root := t.TempDir()
+	podDir := filepath.Join(root, "var/log/pods", "kube-system_coredns-abc_"+testPodUID)
+	writeFile(t, filepath.Join(podDir, "coredns/0.log"), "")
+	// directories not named <namespace>_<name>_<uid> are skipped
+	writeFile(t, filepath.Join(root, "var/log/pods", "stray/0.log"), "")
+
+	containersDir := filepath.Join(root, "var/log/containers")
+	if err := os.MkdirAll(containersDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(containersDir, "coredns-abc_kube-system_coredns-"+testContainerID+".log")
+	if err := os.Symlink(filepath.Join(podDir, "coredns/0.log"), link); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(containersDir, "no-container-id.log"), "")
+
+	writeFile(t, filepath.Join(root, "run/containerd/io.containerd.runtime.v2.task/k8s.io", testBundleID, "config.json"), `{
+		"annotations": {
+			"io.kubernetes.cri.sandbox-uid": "`+testPodUID+`",
+			"io.kubernetes.cri.sandbox-namespace": "kube-system",
+			"io.kubernetes.cri.sandbox-name": "coredns-abc"
+		}
+	}`)
+	writeFile(t, filepath.Join(root, "run/containers/storage/overlay-containers", testCrioID, "userdata/config.json"), `{
+		"annotations": {
+			"io.kubernetes.pod.uid": "5d4c3b2a-1f0e-4d9c-8b7a-6f5e4d3c2b1a",
+			"io.kubernetes.pod.namespace": "default",
+			"io.kubernetes.pod.name": "web-0",
+			"io.kubernetes.container.name": "nginx"
+		}
+	}`)
+	writeFile(t, filepath.Join(root, "run/containers/storage/overlay-containers", "broken/userdata/config.json"), `{`)
+	return root
+}
+
+func TestScanPodLogs(t *testing.T) {
+	root := fixtureRoot(t)
+	idx := newIndex()
+	idx.scanPodLogs(filepath.Join(root, "var/log/pods"))
+
+	if len(idx.pods) != 1 {
+		t.Fatalf("expected 1 pod, got %d: %v", len(idx.pods), idx.pods)
+	}
+	expected := PodInfo{UID: testPodUID, Namespace: "kube-system", Name: "coredns-abc"}
+	if pod := idx.pods[testPodUID]; pod == nil || *pod != expected {
+		t.Errorf("expected %+v, got %+v", expected, pod)
+	}
+
+	// a missing directory is not an error, the host is just not a kubernetes node
+	idx.scanPodLogs(filepath.Join(root, "missing"))
+}
+
+func TestScanContainerLogs(t *testing.T) {
+	root := fixtureRoot(t)
+	idx := newIndex()
+	idx.scanContainerLogs(filepath.Join(root, "var/log/containers"))
+
+	if len(idx.containers) != 1 {
+		t.Fatalf("expected 1 container, got %d: %v", len(idx.containers), idx.containers)
+	}
+	expected := PodInfo{UID: testPodUID, Namespace: "kube-system", Name: "coredns-abc", Container: "coredns"}
+	if pod := idx.containers[testContainerID]; pod == nil || *pod != expected {
+		t.Errorf("expected %+v, got %+v", expected, pod)
+	}
+}
+
+func TestScanBundles(t *testing.T) {
+	root := fixtureRoot(t)
+	idx := newIndex()
+	idx.scanBundles(filepath.Join(root, "run/containerd/io.containerd.runtime.v2.task/k8s.io/*/config.json"))
+	idx.scanBundles(filepath.Join(root, "run/containers/storage/overlay-containers/*/userdata/config.json"))
+
+	tests := []struct {
+		containerID string
+		expected    PodInfo
+	}{
+		{testBundleID, PodInfo{UID: testPodUID, Namespace: "kube-system", Name: "coredns-abc"}},
+		{testCrioID, PodInfo{UID: "5d4c3b2a-1f0e-4d9c-8b7a-6f5e4d3c2b1a", Namespace: "default", Name: "web-0", Container: "nginx"}},
+	}
+	for _, test := range tests {
+		if pod := idx.containers[test.containerID]; pod == nil || *pod != test.expected {
+			t.Errorf("container %s: expected %+v, got %+v", test.containerID, test.expected, pod)
+		}
+	}
+	if _, ok := idx.containers["broken"]; ok {
+		t.Errorf("bundle with invalid config.json is indexed")
+	}
+
+	// containers known from logs are not overwritten by their bundles
+	known := &PodInfo{UID: testPodUID, Container: "known"}
+	idx.containers[testCrioID] = known
+	idx.scanBundles(filepath.Join(root, "run/containers/storage/overlay-containers/*/userdata/config.json"))
+	if idx.containers[testCrioID] != known {
+		t.Errorf("indexed container is overwritten")
+	}
+}
+
+func TestPodUIDFromCgroup(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{
+			"cgroupfs pod",
+			"/kubepods/burstable/pod" + testPodUID,
+			testPodUID,
+		},
+		{
+			"cgroupfs container",
+			"/kubepods/besteffort/pod" + testPodUID + "/" + testContainerID,
+			testPodUID,
+		},
+		{
+			"systemd pod",
+			"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0f4c2b8e_6a1d_4c3e_9b7a_2d5e8f1a3c6b.slice",
+			testPodUID,
+		},
+		{
+			"systemd container",
+			"/kubepods.slice/kubepods-pod0f4c2b8e_6a1d_4c3e_9b7a_2d5e8f1a3c6b.slice/cri-containerd-" + testContainerID + ".scope",
+			testPodUID,
+		},
+		{
+			"outside of kubepods",
+			"/system.slice/pod" + testPodUID + ".service",
+			"",
+		},
+		{
+			"kubepods without pod",
+			"/kubepods.slice/kubepods-burstable.slice",
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if uid := PodUIDFromCgroup(test.path); uid != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, uid)
+			}
+		})
+	}
+}
+
+func TestForCgroup(t *testing.T) {
+	pr := &podResolver{log: zerolog.Nop(), root: fixtureRoot(t)}
+
+	containerPath := "/kubepods.slice/kubepods-pod0f4c2b8e_6a1d_4c3e_9b7a_2d5e8f1a3c6b.slice/cri-containerd-" + testContainerID + ".scope"
+	expected := PodInfo{UID: testPodUID, Namespace: "kube-system", Name: "coredns-abc", Container: "coredns"}
+	if pod := pr.ForCgroup(containerPath); pod == nil || *pod != expected {
+		t.Errorf("container cgroup: expected %+v, got %+v", expected, pod)
+	}
+
+	expected = PodInfo{UID: testPodUID, Namespace: "kube-system", Name: "coredns-abc"}
+	if pod := pr.ForCgroup("/kubepods/burstable/pod" + testPodUID); pod == nil || *pod != expected {
+		t.Errorf("pod cgroup: expected %+v, got %+v", expected, pod)
+	}
+
+	unknownUID := "11111111-2222-3333-4444-555555555555"
+	expected = PodInfo{UID: unknownUID}
+	if pod := pr.ForCgroup("/kubepods/pod" + unknownUID); pod == nil || *pod != expected {
+		t.Errorf("unknown pod cgroup: expected %+v, got %+v", expected, pod)
+	}
+
+	if pod := pr.ForCgroup("/system.slice/docker.service"); pod != nil {
+		t.Errorf("non-pod cgroup: expected nil, got %+v", pod)
+	}
+}
@@ -0,0 +1,210 @@
+package k8s
+
+import (
+	"context"
+	"github.com/ebpfdev/dev-agent/pkg/ebpf/tasks"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PodResolver attributes cgroups and processes to Kubernetes pods
+type PodResolver interface {
+	Run(ctx context.Context, refreshInterval time.Duration)
+	// ForCgroup finds a pod (and a container if possible) by a cgroup path, nil if it's not a pod cgroup
+	ForCgroup(path string) *PodInfo
+	// ForProcess finds a pod of a process by its cgroup path
+	ForProcess(process *tasks.ProcessInfo) *PodInfo
+	// RegisterMetrics registers info metrics mapping programs and maps to pods of processes holding them
+	RegisterMetrics(registry *prometheus.Registry)
+}
+
+type podResolver struct {
+	log zerolog.Logger
+	// index is replaced by the refresh loop while resolvers read it
+	indexMu   sync.Mutex
+	index     *index
+	isRunning bool
+	// root is a mount point of the host filesystem, kubelet and runtime files are read relative to it
+	root      string
+	tasksRepo tasks.TaskWatcher
+
+	metricsEnabled bool
+	progPodInfo    *prometheus.GaugeVec
+	mapPodInfo     *prometheus.GaugeVec
+	// progSeries and mapSeries are label values set by the previous update, they are used by the refresh loop only
+	progSeries map[podSeries]bool
+	mapSeries  map[podSeries]bool
+}
+
+// podSeries are label values of pod info metrics: id, namespace, pod, container and pod_uid
+type podSeries [5]string
+
+func NewResolver(logger zerolog.Logger, root string, tasksRepo tasks.TaskWatcher) PodResolver {
+	progPodInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "prog_pod_info",
+		Help:      "Pods of processes holding an eBPF program, always 1",
+	}, []string{"id", "namespace", "pod", "container", "pod_uid"})
+	mapPodInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "devagent",
+		Subsystem: "ebpf",
+		Name:      "map_pod_info",
+		Help:      "Pods of processes holding an eBPF map, always 1",
+	}, []string{"id", "namespace", "pod", "container", "pod_uid"})
+
+	return &podResolver{
+		log:         logger,
+		root:        root,
+		tasksRepo:   tasksRepo,
+		progPodInfo: progPodInfo,
+		mapPodInfo:  mapPodInfo,
+	}
+}
+
+func (pr *podResolver) Run(ctx context.Context, refreshInterval time.Duration) {
+	if pr.isRunning {
+		return
+	}
+	// the index is built before the first tick, so resolvers don't have to build it themselves
+	pr.setIndex(pr.buildIndex())
+	go func() {
+		pr.isRunning = true
+		ticker := time.NewTicker(refreshInterval)
+		for {
+			select {
+			case <-ticker.C:
+				pr.setIndex(pr.buildIndex())
+				if pr.metricsEnabled {
+					pr.updateMetrics()
+				}
+			case <-ctx.Done():
+				pr.isRunning = false
+				return
+			}
+		}
+	}()
+}
+
+func (pr *podResolver) RegisterMetrics(registry *prometheus.Registry) {
+	err := registry.Register(pr.progPodInfo)
+	if err != nil {
+		pr.log.Err(err).Msg("failed to register prog_pod_info metric")
+	}
+	err = registry.Register(pr.mapPodInfo)
+	if err != nil {
+		pr.log.Err(err).Msg("failed to register map_pod_info metric")
+	}
+	pr.metricsEnabled = true
+}
+
+func (pr *podResolver) buildIndex() *index {
+	pr.log.Debug().Msg("indexing pods")
+	idx := newIndex()
+	idx.scanPodLogs(filepath.Join(pr.root, "var/log/pods"))
+	idx.scanContainerLogs(filepath.Join(pr.root, "var/log/containers"))
+	idx.scanBundles(filepath.Join(pr.root, "run/containerd/io.containerd.runtime.v2.task/k8s.io/*/config.json"))
+	idx.scanBundles(filepath.Join(pr.root, "run/containers/storage/overlay-containers/*/userdata/config.json"))
+	return idx
+}
+
+func (pr *podResolver) setIndex(idx *index) {
+	pr.indexMu.Lock()
+	defer pr.indexMu.Unlock()
+	pr.index = idx
+}
+
+// getIndex returns the current index, it's built once here if the resolver is not running (e.g. for CLI commands)
+func (pr *podResolver) getIndex() *index {
+	pr.indexMu.Lock()
+	defer pr.indexMu.Unlock()
+	if pr.index == nil {
+		pr.index = pr.buildIndex()
+	}
+	return pr.index
+}
+
+func (pr *podResolver) ForCgroup(path string) *PodInfo {
+	idx := pr.getIndex()
+	uid := PodUIDFromCgroup(path)
+	if containerID, _ := tasks.ContainerIDFromCgroup(path); containerID != "" {
+		if pod, ok := idx.containers[containerID]; ok {
+			result := *pod
+			if result.UID == "" {
+				result.UID = uid
+			}
+			return &result
+		}
+	}
+	if uid == "" {
+		return nil
+	}
+	if pod, ok := idx.pods[uid]; ok {
+		result := *pod
+		return &result
+	}
+	// the pod is known by its cgroup only
+	return &PodInfo{UID: uid}
+}
+
+func (pr *podResolver) ForProcess(process *tasks.ProcessInfo) *PodInfo {
+	if process == nil || process.CgroupPath == "" {
+		return nil
+	}
+	return pr.ForCgroup(process.CgroupPath)
+}
+
+func (pr *podResolver) updateMetrics() {
+	holders, err := pr.tasksRepo.GetHolders()
+	if err != nil {
+		pr.log.Debug().Err(err).Msg("failed to get holders for pod metrics")
+		return
+	}
+	progSeries := make(map[podSeries]bool)
+	for id, progHolders := range holders.Programs {
+		for _, pod := range pr.holderPods(progHolders) {
+			progSeries[podSeries{strconv.Itoa(int(id)), pod.Namespace, pod.Name, pod.Container, pod.UID}] = true
+		}
+	}
+	mapSeries := make(map[podSeries]bool)
+	for id, mapHolders := range holders.Maps {
+		for _, pod := range pr.holderPods(mapHolders) {
+			mapSeries[podSeries{strconv.Itoa(int(id)), pod.Namespace, pod.Name, pod.Container, pod.UID}] = true
+		}
+	}
+	// series are not reset, so scrapes during an update don't miss them
+	updatePodSeries(pr.progPodInfo, pr.progSeries, progSeries)
+	updatePodSeries(pr.mapPodInfo, pr.mapSeries, mapSeries)
+	pr.progSeries, pr.mapSeries = progSeries, mapSeries
+}
+
+// updatePodSeries sets series of current label values, and deletes ones set by the previous update only
+func updatePodSeries(gauge *prometheus.GaugeVec, previous map[podSeries]bool, current map[podSeries]bool) {
+	for series := range current {
+		gauge.WithLabelValues(series[:]...).Set(1)
+	}
+	for series := range previous {
+		if !current[series] {
+			gauge.DeleteLabelValues(series[:]...)
+		}
+	}
+}
+
+// holderPods lists distinct pods of processes holding an object
+func (pr *podResolver) holderPods(holders []*tasks.Holder) []*PodInfo {
+	var result []*PodInfo
+	seen := make(map[PodInfo]bool)
+	for _, holder := range holders {
+		pod := pr.ForProcess(holder.Process)
+		if pod == nil || seen[*pod] {
+			continue
+		}
+		seen[*pod] = true
+		result = append(result, pod)
+	}
+	return result
+}